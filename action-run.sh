@@ -3,7 +3,7 @@ set -e
 # build docker image form Dockerfile
 echo "Build fresh docker image for newrelic/infrastructure-publish-action"
 # @TODO add --no-cache
-docker build --platform linux/amd64 -t newrelic/infrastructure-publish-action -f $GITHUB_ACTION_PATH/Dockerfile $GITHUB_ACTION_PATH
+docker build --platform linux/amd64 --build-arg PUBLISHER_VERSION="${GITHUB_ACTION_REF:-dev}" -t newrelic/infrastructure-publish-action -f $GITHUB_ACTION_PATH/Dockerfile $GITHUB_ACTION_PATH
 
 if [ "${CI}" = "true" ]; then
   # avoid container network errors in GHA runners
@@ -31,6 +31,11 @@ fi
 # and therefore as LOCAL_PACKAGES_PATH will refer to path
 # inside the docker container it should be `/srv/*`
 echo "Run docker container with action logic inside"
+# the markdown report is appended to the summary of the workflow run
+step_summary_args=()
+if [ -n "${GITHUB_STEP_SUMMARY}" ]; then
+  step_summary_args=(-v "${GITHUB_STEP_SUMMARY}:/home/gha/step_summary.md" -e GITHUB_STEP_SUMMARY=/home/gha/step_summary.md)
+fi
 docker run --platform linux/amd64 --rm \
         --name=infrastructure-publish-action\
         --security-opt apparmor:unconfined \
@@ -54,6 +59,8 @@ docker run --platform linux/amd64 --rm \
         -e ARTIFACTS_SRC_FOLDER=/home/gha/assets \
         -e SCHEMA \
         -e SCHEMA_URL \
+        -e SCHEMA_SHA256 \
+        -e GITHUB_TOKEN \
         -e SCHEMA_PATH=$( realpath --canonicalize-missing "$SCHEMA_PATH" | sed -e "s|$PWD|/srv|" ) \
         -e GPG_PRIVATE_KEY_BASE64 \
         -e GPG_PASSPHRASE \
@@ -62,5 +69,18 @@ docker run --platform linux/amd64 --rm \
         -e DEST_PREFIX \
         -e LOCAL_PACKAGES_PATH \
         -e APT_SKIP_MIRROR \
+        -e SCHEMA_UNKNOWN_FIELDS \
+        -e WEBHOOK_URLS \
+        -e WEBHOOK_SECRET \
+        -e WEBHOOK_TEMPLATE=$( [ -n "$WEBHOOK_TEMPLATE" ] && realpath --canonicalize-missing "$WEBHOOK_TEMPLATE" | sed -e "s|$PWD|/srv|" ) \
+        -e REPORT_PATH=$( [ -n "$REPORT_PATH" ] && realpath --canonicalize-missing "$REPORT_PATH" | sed -e "s|$PWD|/srv|" ) \
+        -e LOG_FORMAT \
+        -e LOG_LEVEL \
+        -e METRICS_PATH=$( [ -n "$METRICS_PATH" ] && realpath --canonicalize-missing "$METRICS_PATH" | sed -e "s|$PWD|/srv|" ) \
+        -e METRICS_PUSHGATEWAY_URL \
+        -e OTLP_ENDPOINT \
+        -e OTLP_HEADERS \
+        -e TRACEPARENT \
+        "${step_summary_args[@]}" \
         newrelic/infrastructure-publish-action \
         "$@"
@@ -0,0 +1,327 @@
+// Copyright 2021 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/config"
+	"github.com/newrelic/infrastructure-publish-action/publisher/registry"
+	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+	"github.com/newrelic/infrastructure-publish-action/publisher/upload"
+	"github.com/spf13/pflag"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+// commands available, the first one is the default when no command is provided.
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "publish", description: "download and publish the artifacts described by the schema (default)", run: publish},
+		{name: "config print", description: "print the effective configuration, masking secrets", run: configPrint},
+		{name: "schema lint", description: "check schema files reporting every problem with its line", run: schemaLint},
+		{name: "schema resolve", description: "print a schema with its includes and set references expanded", run: schemaResolve},
+		{name: "schema plan", description: "print the uploads the schema publishes for the configured release", run: schemaPlan},
+		{name: "schema list", description: "list the schemas bundled in the registry with their versions", run: schemaList},
+		{name: "schema show", description: "print a schema of the registry, i.e. ohi or ohi@2", run: schemaShow},
+		{name: "schema jsonschema", description: "print the JSON Schema of the schema files, for editor support", run: schemaJSONSchema},
+		{name: "markers list", description: "list the release marks, filtered by app name, tag, start and status", run: markersList},
+		{name: "markers migrate", description: "copy the marks of the legacy releases.json to one object per release", run: markersMigrate},
+		{name: "markers view", description: "write releases.json with every release mark, for the tools reading it", run: markersView},
+		{name: "help", description: "show this help", run: help},
+	}
+}
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// findCommand matches the longest command whose words prefix the arguments, returning the remaining ones.
+// Arguments starting with flags are left for the default one, any other word not matching a command fails, so a
+// misspelled command never publishes.
+func findCommand(args []string) (command, []string, error) {
+	found, rest, foundWords := commands[0], args, 0
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(words) <= foundWords || len(words) > len(args) {
+			continue
+		}
+		matches := true
+		for i, word := range words {
+			if args[i] != word {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found, rest, foundWords = cmd, args[len(words):], len(words)
+		}
+	}
+	if foundWords == 0 && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return command{}, nil, fmt.Errorf("%w '%s'", ErrUnknownCommand, args[0])
+	}
+	return found, rest, nil
+}
+
+func help(_ []string) error {
+	fmt.Fprintln(os.Stderr, "Usage: publisher [command] [flags]\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'publisher <command> --help' for the flags of a command.")
+	return nil
+}
+
+// loadConfig parses the configuration flags for the named command and resolves the configuration.
+func loadConfig(name string, args []string) (config.Config, error) {
+	flags := config.Flags(name)
+	if err := parseFlagsOnly(flags, args); err != nil {
+		return config.Config{}, err
+	}
+
+	conf, err := config.Load(flags)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("loading config: %w", err)
+	}
+	return conf, setupLogger(conf)
+}
+
+// parseFlags parses the arguments exiting cleanly when help is requested.
+func parseFlags(flags *pflag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if errors.Is(err, pflag.ErrHelp) {
+		os.Exit(0)
+	}
+	return err
+}
+
+// parseFlagsOnly parses the arguments of the commands taking only flags, like parseFlags. Arguments left after
+// the flags, like the words of a misspelled subcommand, fail.
+func parseFlagsOnly(flags *pflag.FlagSet, args []string) error {
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w, unexpected arguments '%s'", ErrUnknownCommand, strings.Join(flags.Args(), " "))
+	}
+	return nil
+}
+
+func configPrint(args []string) error {
+	conf, err := loadConfig("config print", args)
+	if err != nil {
+		return err
+	}
+	return config.Print(os.Stdout, conf)
+}
+
+func schemaLint(args []string) error {
+	flags := pflag.NewFlagSet("schema lint", pflag.ContinueOnError)
+	appName := flags.String("app-name", "", "check the sources are prefixed by the app name")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: publisher schema lint [--app-name NAME] FILE...")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no schema files to lint")
+	}
+
+	problems := 0
+	for _, file := range flags.Args() {
+		diags, err := config.LintSchemaFile(file, *appName)
+		if err != nil {
+			return err
+		}
+		for _, diag := range diags {
+			fmt.Println(diag)
+		}
+		problems += len(diags)
+	}
+	if problems > 0 {
+		return fmt.Errorf("schema lint found %d problem(s)", problems)
+	}
+	return nil
+}
+
+func schemaResolve(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: publisher schema resolve FILE|URL")
+	}
+	content, err := config.ResolveSchemaFile(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(content)
+	return err
+}
+
+func schemaList(_ []string) error {
+	schemas, err := registry.List()
+	if err != nil {
+		return err
+	}
+	for _, schema := range schemas {
+		fmt.Println(schema)
+	}
+	return nil
+}
+
+func schemaShow(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: publisher schema show NAME[@VERSION]")
+	}
+	schema, err := registry.Lookup(args[0])
+	if err != nil {
+		return err
+	}
+	content, err := registry.ReadFile(schema.Location())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(content)
+	return err
+}
+
+// schemaPlan prints the uploads of the schema after applying the matrix rules and the prerelease routing,
+// without downloading nor publishing anything.
+func schemaPlan(args []string) error {
+	conf, err := loadConfig("schema plan", args)
+	if err != nil {
+		return err
+	}
+
+	uploadSchemas, err := parseSchema(&conf)
+	if err != nil {
+		return err
+	}
+	if err = config.ValidateSchemas(conf.AppName, uploadSchemas); err != nil {
+		return err
+	}
+
+	plan, err := upload.Plan(conf, uploadSchemas.ForRelease(conf.IsPrerelease()))
+	if err != nil {
+		return err
+	}
+	for _, planned := range plan {
+		fmt.Println(planned)
+	}
+	return nil
+}
+
+func schemaJSONSchema(_ []string) error {
+	content, err := config.JSONSchema()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(content)
+	return err
+}
+
+// newMarkerMigrator loads the configuration of the bucket holding the release markers.
+func newMarkerMigrator(name string, args []string) (release.Migrator, error) {
+	flags := config.Flags(name)
+	if err := parseFlagsOnly(flags, args); err != nil {
+		return nil, err
+	}
+	conf, err := config.LoadBucket(flags)
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	if err = setupLogger(conf); err != nil {
+		return nil, err
+	}
+	if conf.ReleaseMarker != config.ReleaseMarkerS3 {
+		return nil, fmt.Errorf("only the releases.json of the bucket is migrated, release_marker is %s", conf.ReleaseMarker)
+	}
+	return release.NewMigratorAWS(releaseMarkerS3Config(conf), markerLogger())
+}
+
+// markersList prints the release marks of the bucket, filtered by the app name and tag settings and the flags.
+func markersList(args []string) error {
+	flags := config.Flags("markers list")
+	since := flags.String("since", "", "list releases started since a date or RFC 3339 time")
+	until := flags.String("until", "", "list releases started before a date or RFC 3339 time")
+	status := flags.String("status", "", "list releases with a status: started, succeeded, failed, aborted or ended")
+	format := flags.String("format", release.FormatTable, "output format: table, json or csv")
+	if err := parseFlagsOnly(flags, args); err != nil {
+		return err
+	}
+	conf, err := config.LoadBucket(flags)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if err = setupLogger(conf); err != nil {
+		return err
+	}
+
+	filter := release.Filter{AppName: conf.AppName, Tag: conf.Tag, Status: *status}
+	if filter.Since, err = parseTimeFlag("since", *since); err != nil {
+		return err
+	}
+	if filter.Until, err = parseTimeFlag("until", *until); err != nil {
+		return err
+	}
+
+	marker, err := newReleaseMarker(conf)
+	if err != nil {
+		return err
+	}
+	marks, err := marker.List(filter)
+	if err != nil {
+		return err
+	}
+	return release.WriteMarks(os.Stdout, marks, *format)
+}
+
+// parseTimeFlag parses a date, i.e. 2025-02-26, or an RFC 3339 time, empty values being the zero time.
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s '%s', expected a date or an RFC 3339 time", name, value)
+	}
+	return t, nil
+}
+
+func markersMigrate(args []string) error {
+	migrator, err := newMarkerMigrator("markers migrate", args)
+	if err != nil {
+		return err
+	}
+	migrated, err := migrator.Migrate()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d release marks migrated\n", migrated)
+	return nil
+}
+
+func markersView(args []string) error {
+	migrator, err := newMarkerMigrator("markers view", args)
+	if err != nil {
+		return err
+	}
+	marks, err := migrator.WriteView()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d release marks written to releases.json\n", marks)
+	return nil
+}
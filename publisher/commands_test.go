@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_findCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		name string
+		rest []string
+	}{
+		{nil, "publish", nil},
+		{[]string{"--app-name", "nri-foo"}, "publish", []string{"--app-name", "nri-foo"}},
+		{[]string{"schema", "lint", "schema.yml"}, "schema lint", []string{"schema.yml"}},
+		{[]string{"markers", "list", "--status", "failed"}, "markers list", []string{"--status", "failed"}},
+	}
+	for _, tt := range tests {
+		cmd, rest, err := findCommand(tt.args)
+		require.NoError(t, err)
+		assert.Equal(t, tt.name, cmd.name)
+		assert.Equal(t, tt.rest, rest)
+	}
+}
+
+func Test_findCommand_unknown(t *testing.T) {
+	for _, args := range [][]string{{"releses", "list"}, {"shcema", "lint"}, {"schema"}} {
+		_, _, err := findCommand(args)
+		assert.ErrorIs(t, err, ErrUnknownCommand, args)
+	}
+}
+
+func Test_publish_unexpectedArguments(t *testing.T) {
+	// the words left after the flags fail before the config is loaded, so nothing is published
+	err := publish([]string{"--app-name", "nri-foo", "releses", "list"})
+	assert.ErrorIs(t, err, ErrUnknownCommand)
+	assert.Empty(t, trace.Default.Traceparent(), "the spans started before loading the config are ended")
+}
+
+func Test_schemaLint(t *testing.T) {
+	require.NoError(t, schemaLint([]string{"../schemas/e2e.yml"}))
+	require.NoError(t, schemaLint([]string{"../schemas/e2e.yml", "--app-name", "newrelic-infra"}), "flags can follow the files")
+
+	err := schemaLint(nil)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnknownCommand)
+}
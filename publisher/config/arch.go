@@ -0,0 +1,35 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidArchMap = errors.New("invalid arch map")
+
+// defaultArchMaps are the arch names used by default in the destination of each upload type.
+var defaultArchMaps = map[string]map[string]string{
+	TypeYum:  {"arm64": "aarch64"},
+	TypeZypp: {"arm64": "aarch64"},
+}
+
+// DestArch returns the name of an arch in the destination of the upload: the one in its arch_map, or the
+// default one for its type, or the arch itself.
+func (u Upload) DestArch(arch string) string {
+	if mapped, ok := u.ArchMap[arch]; ok {
+		return mapped
+	}
+	if mapped, ok := defaultArchMaps[u.Type][arch]; ok {
+		return mapped
+	}
+	return arch
+}
+
+func validateArchMap(upload Upload) error {
+	for arch, mapped := range upload.ArchMap {
+		if arch == "" || mapped == "" {
+			return fmt.Errorf("%w: empty arch in '%s: %s' of %s upload", ErrInvalidArchMap, arch, mapped, upload.Type)
+		}
+	}
+	return nil
+}
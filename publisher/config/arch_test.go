@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpload_DestPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		upload   Upload
+		arch     string
+		expected string
+	}{
+		{
+			name:     "not mapped",
+			upload:   Upload{Type: TypeFile, Dest: "/{arch}/{dest_arch}"},
+			arch:     "arm64",
+			expected: "/arm64/arm64",
+		},
+		{
+			name:     "arch map",
+			upload:   Upload{Type: TypeApt, Dest: "/{arch}/{dest_arch}", ArchMap: map[string]string{"arm": "armhf"}},
+			arch:     "arm",
+			expected: "/arm/armhf",
+		},
+		{
+			name:     "rpm default",
+			upload:   Upload{Type: TypeYum, Dest: "/{arch}/{dest_arch}"},
+			arch:     "arm64",
+			expected: "/aarch64/aarch64",
+		},
+		{
+			name:     "rpm default overridden",
+			upload:   Upload{Type: TypeZypp, Dest: "/{arch}/{dest_arch}", ArchMap: map[string]string{"arm64": "arm64", "arm": "armv7hl"}},
+			arch:     "arm64",
+			expected: "/arm64/arm64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := tt.upload.DestPath(utils.TemplateContext{Arch: tt.arch}, "foo.tar.gz")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, dest)
+		})
+	}
+}
+
+func TestUpload_SrcRepoURL(t *testing.T) {
+	upload := Upload{Type: TypeApt, SrcRepo: "{access_point_host}/infrastructure_agent/linux/apt"}
+
+	srcRepo, err := upload.SrcRepoURL(utils.TemplateContext{}, "https://download.newrelic.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://download.newrelic.com/infrastructure_agent/linux/apt", srcRepo)
+}
+
+func TestParseSchema_emptyArchMap(t *testing.T) {
+	schema := "- src: foo\n  arch: [arm]\n  uploads:\n    - type: file\n      dest: /tmp\n      arch_map:\n        arm: \"\"\n"
+
+	_, err := parseUploadSchema([]byte(schema), true)
+	require.ErrorIs(t, err, ErrInvalidArchMap)
+	assert.Contains(t, err.Error(), "empty arch in 'arm: ' of file upload in schema entry 'foo'")
+}
@@ -4,12 +4,33 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/newrelic/infrastructure-publish-action/publisher/registry"
+	"github.com/newrelic/infrastructure-publish-action/publisher/semver"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 const (
 	defaultAptlyFolder = "/root/.aptly"
 	defaultLockgroup   = "lockgroup"
+	DefaultLockRetries = 30
+
+	defaultSchemaUnknownFields = UnknownFieldsError
+
+	// ReleaseMarkerS3, ReleaseMarkerDir and ReleaseMarkerMemory record the releases in the bucket, a folder, or
+	// nowhere for publishes not needing to keep track of them
+	ReleaseMarkerS3      = "s3"
+	ReleaseMarkerDir     = "dir"
+	ReleaseMarkerMemory  = "memory"
+	defaultReleaseMarker = ReleaseMarkerS3
+
+	defaultLogFormat = utils.LogFormatText
+	defaultLogLevel  = "info"
+
+	// schemaCustom and schemaCustomLocal select the schema from schema_url or schema_path instead of the registry
+	schemaCustom      = "custom"
+	schemaCustomLocal = "custom-local"
 
 	//Access points
 	accessPointStaging               = "http://nr-downloads-ohai-staging.s3-website-us-east-1.amazonaws.com"
@@ -22,6 +43,11 @@ const (
 )
 
 var ErrMissingConfig = fmt.Errorf("missing required config")
+var ErrInvalidTag = fmt.Errorf("invalid tag")
+var ErrInvalidUnknownFields = fmt.Errorf("invalid schema_unknown_fields")
+var ErrInvalidReleaseMarker = fmt.Errorf("invalid release_marker")
+var ErrInvalidLogFormat = fmt.Errorf("invalid log_format")
+var ErrInvalidLogLevel = fmt.Errorf("invalid log_level")
 
 type Config struct {
 	DestPrefix           string
@@ -36,8 +62,14 @@ type Config struct {
 	ArtifactsSrcFolder   string
 	AptlyFolder          string
 	SchemaURL            string
+	SchemaPath           string
+	SchemaSHA256         string
+	SchemaResolvedSHA256 string // checksum of the schema with its includes resolved, set once parsed
+	SchemaCacheDir       string
+	GithubToken          string
 	Schema               string
 	UploadSchemaFilePath string
+	SchemaUnknownFields  string
 	GpgPassphrase        string
 	GpgKeyRing           string
 	AwsRegion            string
@@ -52,12 +84,157 @@ type Config struct {
 	UseDefLockRetries bool
 	LocalPackagesPath string
 	AptSkipMirror     bool
+	ReleaseMarker     string
+	ReleaseMarkerDir  string
+	// webhooks notified of the start and end of the release
+	WebhookURLs     []string
+	WebhookSecret   string
+	WebhookTemplate string
+	// report of the publishing, as JSON and appended as Markdown to the summary of the workflow run
+	ReportPath        string
+	GithubStepSummary string
+	LogFormat         string
+	LogLevel          string
+	// exports of the telemetry of the publishing
+	MetricsPath           string
+	MetricsPushgatewayURL string
+	OtlpEndpoint          string
+	OtlpHeaders           string
+	Traceparent           string
 }
 
 func (c *Config) LockOwner() string {
 	return fmt.Sprintf("%s_%s_%s", c.AppName, c.Tag, c.RunID)
 }
 
+// IsPrerelease returns true when the tag has semver prerelease identifiers, i.e. v1.2.0-rc.1
+func (c *Config) IsPrerelease() bool {
+	v, err := semver.Parse(c.Tag)
+	return err == nil && v.IsPrerelease()
+}
+
+// SchemaLocation returns where the upload schema is read from: upload_schema_file_path when set, schema_url
+// for the custom schema, schema_path for the custom-local one, or the schema of the registry with that name.
+func (c *Config) SchemaLocation() (string, error) {
+	switch {
+	case c.UploadSchemaFilePath != "":
+		return c.UploadSchemaFilePath, nil
+	case c.Schema == schemaCustom:
+		if c.SchemaURL == "" {
+			return "", missingSettingErr("schema_url", "by the custom schema")
+		}
+		return c.SchemaURL, nil
+	case c.Schema == schemaCustomLocal:
+		if c.SchemaPath == "" {
+			return "", missingSettingErr("schema_path", "by the custom-local schema")
+		}
+		return c.SchemaPath, nil
+	case c.Schema == "":
+		return "", missingSettingErr("schema", "to read the upload schema, or upload_schema_file_path")
+	}
+
+	schema, err := registry.Lookup(c.Schema)
+	if err != nil {
+		return "", err
+	}
+	return schema.Location(), nil
+}
+
+// LoadBucket resolves, like Load, only the settings locating the bucket, for the commands querying or maintaining
+// it instead of publishing. The app name and the tag are optional.
+func LoadBucket(flags *pflag.FlagSet) (Config, error) {
+	v, err := newViper(flags)
+	if err != nil {
+		return Config{}, err
+	}
+
+	releaseMarker, err := releaseMarkerSetting(v)
+	if err != nil {
+		return Config{}, err
+	}
+	logFormat, logLevel, err := logSettings(v)
+	if err != nil {
+		return Config{}, err
+	}
+	if releaseMarker == ReleaseMarkerS3 && v.GetString("aws_s3_bucket_name") == "" {
+		return Config{}, fmt.Errorf("%w: aws_s3_bucket_name", ErrMissingConfig)
+	}
+
+	return Config{
+		DestPrefix:          v.GetString("dest_prefix"),
+		AppName:             v.GetString("app_name"),
+		Tag:                 v.GetString("tag"),
+		ArtifactsDestFolder: v.GetString("artifacts_dest_folder"),
+		AwsBucket:           v.GetString("aws_s3_bucket_name"),
+		AwsRoleARN:          v.GetString("aws_role_arn"),
+		AwsRegion:           v.GetString("aws_region"),
+		ReleaseMarker:       releaseMarker,
+		ReleaseMarkerDir:    v.GetString("release_marker_dir"),
+		LogFormat:           logFormat,
+		LogLevel:            logLevel,
+	}, nil
+}
+
+// newViper binds the settings to their flags and environment variables and reads the config file.
+func newViper(flags *pflag.FlagSet) (*viper.Viper, error) {
+	v := viper.New()
+	for _, s := range settings {
+		v.BindEnv(s.key)
+		if flags != nil {
+			if f := flags.Lookup(s.flagName()); f != nil {
+				v.BindPFlag(s.key, f)
+			}
+		}
+	}
+	v.SetDefault("aptly_folder", defaultAptlyFolder)
+	v.SetDefault("lock_group", defaultLockgroup)
+	v.SetDefault("schema_unknown_fields", defaultSchemaUnknownFields)
+	v.SetDefault("release_marker", defaultReleaseMarker)
+	v.SetDefault("log_format", defaultLogFormat)
+	v.SetDefault("log_level", defaultLogLevel)
+
+	if err := readConfigFile(v, flags); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func releaseMarkerSetting(v *viper.Viper) (string, error) {
+	releaseMarker := v.GetString("release_marker")
+	switch releaseMarker {
+	case ReleaseMarkerS3, ReleaseMarkerDir, ReleaseMarkerMemory:
+		return releaseMarker, nil
+	}
+	return "", fmt.Errorf("%w: '%s', valid values: %s, %s, %s", ErrInvalidReleaseMarker, releaseMarker, ReleaseMarkerS3, ReleaseMarkerDir, ReleaseMarkerMemory)
+}
+
+// logSettings returns the format and level of the logs, validated.
+func logSettings(v *viper.Viper) (string, string, error) {
+	format := strings.ToLower(v.GetString("log_format"))
+	if format != utils.LogFormatText && format != utils.LogFormatJSON {
+		return "", "", fmt.Errorf("%w: '%s', valid values: %s, %s", ErrInvalidLogFormat, format, utils.LogFormatText, utils.LogFormatJSON)
+	}
+	level := strings.ToLower(v.GetString("log_level"))
+	if _, err := utils.ParseLogLevel(level); err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidLogLevel, err)
+	}
+	return format, level, nil
+}
+
+// listSetting returns the values of a setting holding a list, either a comma separated string, as in flags and
+// environment variables, or a list in the config file.
+func listSetting(v *viper.Viper, key string) []string {
+	var list []string
+	for _, value := range v.GetStringSlice(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
 // parseAccessPointHost accessPointHost will be parsed to detect production, staging or testing placeholders
 // and substitute them with their specific real values. Empty will fallback to production and any other value
 // will be considered a different access point and will be return as it is
@@ -76,81 +253,95 @@ func parseAccessPointHost(accessPointHost string) (string, string) {
 	}
 }
 
+// LoadConfig loads the configuration from environment variables only.
 func LoadConfig() (Config, error) {
-	// TODO: make all the config required
-	viper.BindEnv("repo_name")
-	viper.BindEnv("app_name")
-	viper.BindEnv("app_version")
-	viper.BindEnv("tag")
-	viper.BindEnv("access_point_host")
-	viper.BindEnv("run_id")
-	viper.BindEnv("artifacts_dest_folder")
-	viper.BindEnv("artifacts_src_folder")
-	viper.BindEnv("aptly_folder")
-	viper.BindEnv("upload_schema_file_path")
-	viper.BindEnv("schema_url")
-	viper.BindEnv("schema")
-	viper.BindEnv("dest_prefix")
-	viper.BindEnv("gpg_passphrase")
-	viper.BindEnv("gpg_key_ring")
-	viper.BindEnv("aws_s3_bucket_name")
-	viper.BindEnv("aws_s3_lock_bucket_name")
-	viper.BindEnv("aws_role_arn")
-	viper.BindEnv("aws_region")
-	viper.BindEnv("disable_lock")
-	viper.BindEnv("lock_retries")
-	viper.BindEnv("lock_group")
-	viper.BindEnv("local_packages_path")
-	viper.BindEnv("apt_skip_mirror")
-
-	if viper.GetString("app_name") == "" {
+	return Load(nil)
+}
+
+// Load resolves the configuration from command-line flags, environment variables and the config file, in that order of
+// precedence, falling back to defaults. Flags must have been created by Flags and already parsed, nil flags are ignored.
+func Load(flags *pflag.FlagSet) (Config, error) {
+	v, err := newViper(flags)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if v.GetString("app_name") == "" {
 		return Config{}, fmt.Errorf("%w: app_name", ErrMissingConfig)
 	}
 
-	aptlyF := viper.GetString("aptly_folder")
-	if aptlyF == "" {
-		aptlyF = defaultAptlyFolder
+	version := v.GetString("app_version")
+	if version == "" && v.GetString("tag") != "" {
+		tagVersion, err := semver.Parse(v.GetString("tag"))
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: %v, set app_version to publish it", ErrInvalidTag, err)
+		}
+		version = tagVersion.String()
+	}
+
+	unknownFields := v.GetString("schema_unknown_fields")
+	if unknownFields != UnknownFieldsError && unknownFields != UnknownFieldsWarn {
+		return Config{}, fmt.Errorf("%w: '%s', valid values: %s, %s", ErrInvalidUnknownFields, unknownFields, UnknownFieldsError, UnknownFieldsWarn)
 	}
 
-	lockGroup := viper.GetString("lock_group")
-	if lockGroup == "" {
-		lockGroup = defaultLockgroup
+	releaseMarker, err := releaseMarkerSetting(v)
+	if err != nil {
+		return Config{}, err
 	}
 
-	version := viper.GetString("app_version")
-	if version == "" {
-		version = strings.Replace(viper.GetString("tag"), "v", "", -1)
+	logFormat, logLevel, err := logSettings(v)
+	if err != nil {
+		return Config{}, err
 	}
 
-	accessPointHost, mirrorHost := parseAccessPointHost(viper.GetString("access_point_host"))
+	accessPointHost, mirrorHost := parseAccessPointHost(v.GetString("access_point_host"))
 
 	return Config{
-		DestPrefix:           viper.GetString("dest_prefix"),
-		RepoName:             viper.GetString("repo_name"),
-		AppName:              viper.GetString("app_name"),
-		Tag:                  viper.GetString("tag"),
-		MirrorHost:           mirrorHost,
-		AccessPointHost:      accessPointHost,
-		RunID:                viper.GetString("run_id"),
-		Version:              version,
-		ArtifactsDestFolder:  viper.GetString("artifacts_dest_folder"),
-		ArtifactsSrcFolder:   viper.GetString("artifacts_src_folder"),
-		AptlyFolder:          aptlyF,
-		UploadSchemaFilePath: viper.GetString("upload_schema_file_path"),
-		SchemaURL:            viper.GetString("schema_url"),
-		Schema:               viper.GetString("schema"),
-		GpgPassphrase:        viper.GetString("gpg_passphrase"),
-		GpgKeyRing:           viper.GetString("gpg_key_ring"),
-		LockGroup:            lockGroup,
-		AwsLockBucket:        viper.GetString("aws_s3_lock_bucket_name"),
-		AwsBucket:            viper.GetString("aws_s3_bucket_name"),
-		AwsRoleARN:           viper.GetString("aws_role_arn"),
-		AwsRegion:            viper.GetString("aws_region"),
-		AwsTags:              viper.GetString("aws_tags"),
-		DisableLock:          viper.GetBool("disable_lock"),
-		LockRetries:          viper.GetUint("lock_retries"),
-		LocalPackagesPath:    viper.GetString("local_packages_path"),
-		UseDefLockRetries:    !viper.IsSet("lock_retries"),     // when non set: use default value
-		AptSkipMirror:        viper.GetBool("apt_skip_mirror"), // when non set: use default value
+		DestPrefix:            v.GetString("dest_prefix"),
+		RepoName:              v.GetString("repo_name"),
+		AppName:               v.GetString("app_name"),
+		Tag:                   v.GetString("tag"),
+		MirrorHost:            mirrorHost,
+		AccessPointHost:       accessPointHost,
+		RunID:                 v.GetString("run_id"),
+		Version:               version,
+		ArtifactsDestFolder:   v.GetString("artifacts_dest_folder"),
+		ArtifactsSrcFolder:    v.GetString("artifacts_src_folder"),
+		AptlyFolder:           v.GetString("aptly_folder"),
+		UploadSchemaFilePath:  v.GetString("upload_schema_file_path"),
+		SchemaUnknownFields:   unknownFields,
+		SchemaURL:             v.GetString("schema_url"),
+		SchemaPath:            v.GetString("schema_path"),
+		SchemaSHA256:          v.GetString("schema_sha256"),
+		SchemaCacheDir:        v.GetString("schema_cache_dir"),
+		GithubToken:           v.GetString("github_token"),
+		Schema:                v.GetString("schema"),
+		GpgPassphrase:         v.GetString("gpg_passphrase"),
+		GpgKeyRing:            v.GetString("gpg_key_ring"),
+		LockGroup:             v.GetString("lock_group"),
+		AwsLockBucket:         v.GetString("aws_s3_lock_bucket_name"),
+		AwsBucket:             v.GetString("aws_s3_bucket_name"),
+		AwsRoleARN:            v.GetString("aws_role_arn"),
+		AwsRegion:             v.GetString("aws_region"),
+		AwsTags:               v.GetString("aws_tags"),
+		DisableLock:           v.GetBool("disable_lock"),
+		LockRetries:           v.GetUint("lock_retries"),
+		LocalPackagesPath:     v.GetString("local_packages_path"),
+		UseDefLockRetries:     !v.IsSet("lock_retries"),     // when non set: use default value
+		AptSkipMirror:         v.GetBool("apt_skip_mirror"), // when non set: use default value
+		ReleaseMarker:         releaseMarker,
+		ReleaseMarkerDir:      v.GetString("release_marker_dir"),
+		WebhookURLs:           listSetting(v, "webhook_urls"),
+		WebhookSecret:         v.GetString("webhook_secret"),
+		WebhookTemplate:       v.GetString("webhook_template"),
+		ReportPath:            v.GetString("report_path"),
+		GithubStepSummary:     v.GetString("github_step_summary"),
+		LogFormat:             logFormat,
+		LogLevel:              logLevel,
+		MetricsPath:           v.GetString("metrics_path"),
+		MetricsPushgatewayURL: v.GetString("metrics_pushgateway_url"),
+		OtlpEndpoint:          v.GetString("otlp_endpoint"),
+		OtlpHeaders:           v.GetString("otlp_headers"),
+		Traceparent:           v.GetString("traceparent"),
 	}, nil
 }
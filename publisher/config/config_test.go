@@ -4,6 +4,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/newrelic/infrastructure-publish-action/publisher/registry"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,6 +35,66 @@ func Test_requiredValues(t *testing.T) {
 	_, err := LoadConfig()
 	assert.ErrorIs(t, err, ErrMissingConfig)
 }
+func Test_loadConfigInvalidTag(t *testing.T) {
+	t.Setenv("APP_NAME", "foo")
+	t.Setenv("APP_VERSION", "")
+	t.Setenv("TAG", "vFooBar")
+
+	_, err := LoadConfig()
+	assert.ErrorIs(t, err, ErrInvalidTag)
+
+	// an explicit version allows publishing tags not following semver
+	t.Setenv("APP_VERSION", "FooBar")
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "FooBar", config.Version)
+}
+
+func Test_loadBucket(t *testing.T) {
+	_, err := LoadBucket(nil)
+	assert.ErrorIs(t, err, ErrMissingConfig)
+
+	// the settings of a release aren't required
+	t.Setenv("AWS_S3_BUCKET_NAME", "bucket")
+	t.Setenv("DEST_PREFIX", "infrastructure_agent/")
+	t.Setenv("TAG", "not-semver")
+	config, err := LoadBucket(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Config{DestPrefix: "infrastructure_agent/", Tag: "not-semver", AwsBucket: "bucket", ReleaseMarker: ReleaseMarkerS3,
+		LogFormat: utils.LogFormatText, LogLevel: "info"}, config)
+
+	// the bucket is only required to record the releases in it
+	t.Setenv("AWS_S3_BUCKET_NAME", "")
+	t.Setenv("RELEASE_MARKER", "dir")
+	_, err = LoadBucket(nil)
+	assert.NoError(t, err)
+
+	t.Setenv("RELEASE_MARKER", "sqlite")
+	_, err = LoadBucket(nil)
+	assert.ErrorIs(t, err, ErrInvalidReleaseMarker)
+}
+
+func Test_loadConfigLogging(t *testing.T) {
+	clearSettingsEnv(t)
+	t.Setenv("APP_NAME", "foo")
+	t.Setenv("TAG", "v1.0.0")
+	t.Setenv("LOG_FORMAT", "JSON")
+	t.Setenv("LOG_LEVEL", "Debug")
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, utils.LogFormatJSON, config.LogFormat)
+	assert.Equal(t, "debug", config.LogLevel)
+
+	t.Setenv("LOG_LEVEL", "verbose")
+	_, err = LoadConfig()
+	assert.ErrorIs(t, err, ErrInvalidLogLevel)
+
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_FORMAT", "logfmt")
+	_, err = LoadConfig()
+	assert.ErrorIs(t, err, ErrInvalidLogFormat)
+}
+
 func Test_loadConfig(t *testing.T) {
 	tests := []struct {
 		name string
@@ -43,44 +105,61 @@ func Test_loadConfig(t *testing.T) {
 			name: "defaults are applied",
 			env: map[string]string{
 				"APP_NAME": "foo",
-				"TAG":      "vFooBar",
+				"TAG":      "v1.0.0-dev",
 			},
 			want: Config{
-				AppName:           "foo",
-				Tag:               "vFooBar",
-				Version:           "FooBar",
-				AccessPointHost:   accessPointProduction,
-				MirrorHost:        mirrorProduction,
-				AptlyFolder:       defaultAptlyFolder,
-				LockGroup:         defaultLockgroup,
-				UseDefLockRetries: true,
+				AppName:             "foo",
+				Tag:                 "v1.0.0-dev",
+				Version:             "1.0.0-dev",
+				AccessPointHost:     accessPointProduction,
+				MirrorHost:          mirrorProduction,
+				AptlyFolder:         defaultAptlyFolder,
+				LockGroup:           defaultLockgroup,
+				SchemaUnknownFields: UnknownFieldsError,
+				UseDefLockRetries:   true,
+				ReleaseMarker:       ReleaseMarkerS3,
+				LogFormat:           utils.LogFormatText,
+				LogLevel:            "info",
 			},
 		},
 		{
 			name: "custom values",
 			env: map[string]string{
-				"TAG":               "vFooBar",
-				"APP_NAME":          "foo",
-				"APP_VERSION":       "Baz",
-				"APTLY_FOLDER":      "FooFolder",
-				"LOCK_GROUP":        "FooGroup",
-				"ACCESS_POINT_HOST": "FooAPH",
-				"LOCK_RETRIES":      "false",
+				"TAG":                "vFooBar",
+				"APP_NAME":           "foo",
+				"APP_VERSION":        "Baz",
+				"APTLY_FOLDER":       "FooFolder",
+				"LOCK_GROUP":         "FooGroup",
+				"ACCESS_POINT_HOST":  "FooAPH",
+				"LOCK_RETRIES":       "false",
+				"RELEASE_MARKER":     "dir",
+				"RELEASE_MARKER_DIR": "FooMarkers",
+				"WEBHOOK_URLS":       "https://foo.test/hook, https://bar.test/hook",
+				"REPORT_PATH":        "FooReport.json",
 			},
 			want: Config{
-				AppName:           "foo",
-				Tag:               "vFooBar",
-				Version:           "Baz",
-				AccessPointHost:   "FooAPH",
-				MirrorHost:        "FooAPH",
-				AptlyFolder:       "FooFolder",
-				LockGroup:         "FooGroup",
-				UseDefLockRetries: false,
+				AppName:             "foo",
+				Tag:                 "vFooBar",
+				Version:             "Baz",
+				AccessPointHost:     "FooAPH",
+				MirrorHost:          "FooAPH",
+				AptlyFolder:         "FooFolder",
+				LockGroup:           "FooGroup",
+				SchemaUnknownFields: UnknownFieldsError,
+				UseDefLockRetries:   false,
+				ReleaseMarker:       ReleaseMarkerDir,
+				ReleaseMarkerDir:    "FooMarkers",
+				WebhookURLs:         []string{"https://foo.test/hook", "https://bar.test/hook"},
+				ReportPath:          "FooReport.json",
+				LogFormat:           utils.LogFormatText,
+				LogLevel:            "info",
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// i.e. GITHUB_STEP_SUMMARY is set when running in a workflow
+			clearSettingsEnv(t)
 			for k, v := range tt.env {
 				os.Setenv(k, v)
 			}
@@ -90,3 +169,51 @@ func Test_loadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_IsPrerelease(t *testing.T) {
+	tests := []struct {
+		tag        string
+		prerelease bool
+	}{
+		{"v1.2.0", false},
+		{"1.2.0+build.1", false},
+		{"v1.2.0-rc.1", true},
+		{"1.2.0-dev+build.1", true},
+		{"not-semver-rc", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			c := Config{Tag: tt.tag}
+			assert.Equal(t, tt.prerelease, c.IsPrerelease())
+		})
+	}
+}
+
+func TestConfig_SchemaLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     Config
+		expected string
+		err      error
+	}{
+		{"registry", Config{Schema: "ohi"}, "builtin://ohi/1.yml", nil},
+		{"registry version", Config{Schema: "nrjmx@1"}, "builtin://nrjmx/1.yml", nil},
+		{"custom", Config{Schema: "custom", SchemaURL: "github://newrelic/nri-foo@main/schema.yml"}, "github://newrelic/nri-foo@main/schema.yml", nil},
+		{"custom-local", Config{Schema: "custom-local", SchemaPath: "/srv/schema.yml"}, "/srv/schema.yml", nil},
+		{"upload schema file path", Config{Schema: "ohi", UploadSchemaFilePath: "/schemas/ohi.yml"}, "/schemas/ohi.yml", nil},
+		{"custom without url", Config{Schema: "custom"}, "", ErrMissingConfig},
+		{"custom-local without path", Config{Schema: "custom-local"}, "", ErrMissingConfig},
+		{"no schema", Config{}, "", ErrMissingConfig},
+		{"unknown", Config{Schema: "ohi@7"}, "", registry.ErrUnknownSchema},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, err := tt.conf.SchemaLocation()
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expected, location)
+		})
+	}
+}
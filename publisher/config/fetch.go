@@ -0,0 +1,324 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/registry"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+)
+
+const (
+	// githubReferencePrefix marks a schema in a GitHub repository, i.e. github://newrelic/infrastructure-agent@v1.2.3/build/upload-schema.yml
+	githubReferencePrefix = "github://"
+
+	schemaFetchTimeout    = 30 * time.Second
+	schemaFetchRetries    = 3
+	schemaFetchRetryDelay = 5 * time.Second
+
+	githubAPIURL = "https://api.github.com"
+	githubRawURL = "https://raw.githubusercontent.com"
+)
+
+var (
+	ErrSchemaFetch     = errors.New("cannot fetch schema")
+	ErrSchemaChecksum  = errors.New("schema checksum mismatch")
+	ErrGithubReference = errors.New("invalid github schema reference")
+	commitSHARegex     = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	sha256Regex        = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+	defaultSchemaFetcher = NewSchemaFetcher("", "")
+)
+
+// SchemaSource is the content of a schema file with where it was read from.
+type SchemaSource struct {
+	// Location is the schema as configured: a path, a URL or a github:// reference
+	Location string
+	// URL is the URL fetched for remote schemas, github:// references pinned to their commit
+	URL     string
+	SHA256  string
+	Content []byte
+	// pinned is set for schemas checked against a checksum or read from a GitHub commit, their includes must be
+	// pinned as well
+	pinned bool
+}
+
+// location returns where the includes of the schema are relative to.
+func (s SchemaSource) location() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	return s.Location
+}
+
+// SchemaFetcher reads schema files, downloading the remote ones with retries. github:// references are
+// resolved to the commit their ref points to when fetched, so a push to a branch can't change the schema of
+// a release half way, and their relative includes are read from the same commit. When a cache folder is set,
+// downloaded schemas are kept by checksum and the ones pinned with one aren't downloaded again.
+type SchemaFetcher struct {
+	client      *http.Client
+	retries     int
+	retryDelay  time.Duration
+	cacheDir    string
+	githubToken string
+	githubAPI   string
+	githubRaw   string
+}
+
+// NewSchemaFetcher returns a fetcher caching the schemas in cacheDir, none when empty. The GitHub token, when
+// not empty, authenticates the requests resolving github:// references, allowing private repositories.
+func NewSchemaFetcher(cacheDir, githubToken string) *SchemaFetcher {
+	return &SchemaFetcher{
+		client:      &http.Client{Timeout: schemaFetchTimeout},
+		retries:     schemaFetchRetries,
+		retryDelay:  schemaFetchRetryDelay,
+		cacheDir:    cacheDir,
+		githubToken: githubToken,
+		githubAPI:   githubAPIURL,
+		githubRaw:   githubRawURL,
+	}
+}
+
+// Fetch reads a schema file, URL, github:// reference or file of the registry. The content must match the checksum, a hex
+// encoded sha256, when not empty.
+func (f *SchemaFetcher) Fetch(location, checksum string) (SchemaSource, error) {
+	checksum = strings.ToLower(checksum)
+	if checksum != "" && !sha256Regex.MatchString(checksum) {
+		return SchemaSource{}, fmt.Errorf("%w: '%s' is not a hex encoded sha256", ErrSchemaChecksum, checksum)
+	}
+
+	source := SchemaSource{Location: location, pinned: checksum != "" || isGithubReference(location)}
+	var err error
+	switch {
+	case isGithubReference(location):
+		if source.URL, err = f.githubRawURL(location); err != nil {
+			return SchemaSource{}, err
+		}
+		utils.Logger.Info("schema reference resolved", "schema", location, "url", source.URL)
+	case isURL(location):
+		source.URL = location
+	}
+
+	download := false
+	if registry.IsLocation(location) {
+		source.Content, err = registry.ReadFile(location)
+	} else if source.URL == "" {
+		source.Content, err = ioutil.ReadFile(location)
+	} else if cached, ok := f.cached(checksum); ok {
+		source.Content = cached
+	} else {
+		download = true
+		source.Content, err = f.get(source.URL, nil)
+	}
+	if err != nil {
+		return SchemaSource{}, err
+	}
+
+	source.SHA256 = contentSHA256(source.Content)
+	if checksum != "" && source.SHA256 != checksum {
+		return SchemaSource{}, fmt.Errorf("%w: %s has sha256 %s, expected %s", ErrSchemaChecksum, displayLocation(location), source.SHA256, checksum)
+	}
+	if download {
+		f.cache(source)
+	}
+	return source, nil
+}
+
+// read returns the content of an included schema.
+func (f *SchemaFetcher) read(location string) ([]byte, error) {
+	source, err := f.Fetch(location, "")
+	return source.Content, err
+}
+
+// isPinned returns whether the content of a location can't change: a file of the registry, embedded in the
+// publisher, or a file of a GitHub commit, as a github:// reference or a URL resolved from one.
+func (f *SchemaFetcher) isPinned(location string) bool {
+	switch {
+	case registry.IsLocation(location):
+		return true
+	case isGithubReference(location):
+		ref, err := parseGithubReference(location)
+		return err == nil && commitSHARegex.MatchString(ref.ref)
+	case strings.HasPrefix(location, f.githubRaw+"/"):
+		// owner/repo/commit/path
+		parts := strings.SplitN(strings.TrimPrefix(location, f.githubRaw+"/"), "/", 4)
+		return len(parts) == 4 && commitSHARegex.MatchString(parts[2])
+	}
+	return false
+}
+
+// get downloads a URL, retrying server and network errors.
+func (f *SchemaFetcher) get(url string, header http.Header) ([]byte, error) {
+	var content []byte
+	var err error
+	attempt := 0
+	err = utils.Retry("schema fetch", func() error {
+		attempt++
+		var retry bool
+		content, retry, err = f.getOnce(url, header)
+		if err != nil && !retry {
+			return utils.NoRetry(err)
+		}
+		return err
+	}, f.retries, f.retryDelay, func() {
+		if attempt < f.retries {
+			utils.Logger.Warn("cannot fetch schema, retrying", "attempt", attempt, "error", err, "delay", f.retryDelay)
+		}
+	})
+	return content, err
+}
+
+// getOnce downloads a URL, returning whether the request can be retried when failing.
+func (f *SchemaFetcher) getOnce(url string, header http.Header) ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrSchemaFetch, err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if f.githubToken != "" && (strings.HasPrefix(url, f.githubAPI) || strings.HasPrefix(url, f.githubRaw)) {
+		req.Header.Set("Authorization", "Bearer "+f.githubToken)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("%w: %v", ErrSchemaFetch, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("%w: fetching %s: unexpected status %w", ErrSchemaFetch, url, &statusError{code: resp.StatusCode, status: resp.Status})
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("%w: reading %s: %v", ErrSchemaFetch, url, err)
+	}
+	return content, false, nil
+}
+
+// statusError is the unexpected status of a response.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return e.status
+}
+
+// githubRawURL returns the URL of the file of a github:// reference at the commit its ref points to. Refs with
+// slashes, like release/v2, can't be told apart from the path, so the ref is extended with the leading path
+// segments until it names a branch or tag of the repository.
+func (f *SchemaFetcher) githubRawURL(location string) (string, error) {
+	ref, err := parseGithubReference(location)
+	if err != nil {
+		return "", err
+	}
+
+	commit := ref.ref
+	if !commitSHARegex.MatchString(commit) {
+		segments := strings.Split(ref.path, "/")
+		for i := 0; ; i++ {
+			commit, err = f.resolveGithubRef(ref)
+			var status *statusError
+			notFound := errors.As(err, &status) && (status.code == http.StatusNotFound || status.code == http.StatusUnprocessableEntity)
+			if !notFound || i == len(segments)-1 {
+				break
+			}
+			ref.ref, ref.path = ref.ref+"/"+segments[i], strings.Join(segments[i+1:], "/")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%s", f.githubRaw, ref.owner, ref.repo, commit, ref.path), nil
+}
+
+// resolveGithubRef returns the commit SHA the ref of a github:// reference points to.
+func (f *SchemaFetcher) resolveGithubRef(ref githubReference) (string, error) {
+	// the sha media type returns only the commit SHA of the ref
+	commitURL := fmt.Sprintf("%s/repos/%s/%s/commits/%s", f.githubAPI, ref.owner, ref.repo, url.PathEscape(ref.ref))
+	content, err := f.get(commitURL, http.Header{"Accept": {"application/vnd.github.sha"}})
+	if err != nil {
+		return "", fmt.Errorf("resolving ref %s of %s/%s: %w", ref.ref, ref.owner, ref.repo, err)
+	}
+	commit := strings.TrimSpace(string(content))
+	if !commitSHARegex.MatchString(commit) {
+		return "", fmt.Errorf("%w: ref %s of %s/%s resolved to '%s', not a commit", ErrGithubReference, ref.ref, ref.owner, ref.repo, commit)
+	}
+	return commit, nil
+}
+
+// cached returns the schema with the checksum from the cache folder.
+func (f *SchemaFetcher) cached(checksum string) ([]byte, bool) {
+	if f.cacheDir == "" || checksum == "" {
+		return nil, false
+	}
+	content, err := ioutil.ReadFile(filepath.Join(f.cacheDir, checksum+".yml"))
+	if err != nil {
+		return nil, false
+	}
+	return content, true
+}
+
+// cache keeps a downloaded schema in the cache folder, failing to do it only slows down the next fetch.
+func (f *SchemaFetcher) cache(source SchemaSource) {
+	if f.cacheDir == "" {
+		return
+	}
+	err := os.MkdirAll(f.cacheDir, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(f.cacheDir, source.SHA256+".yml"), source.Content, 0644)
+	}
+	if err != nil {
+		utils.Logger.Warn("cannot cache schema", "schema", source.Location, "error", err)
+	}
+}
+
+// githubReference is a file in a GitHub repository at a ref: github://owner/repo@ref/path/to/schema.yml. The ref
+// is parsed up to the first slash, see githubRawURL for refs with slashes.
+type githubReference struct {
+	owner string
+	repo  string
+	ref   string
+	path  string
+}
+
+func parseGithubReference(location string) (githubReference, error) {
+	invalid := fmt.Errorf("%w: %s, expected %sowner/repo@ref/path/to/schema.yml", ErrGithubReference, location, githubReferencePrefix)
+
+	owner, rest, ok := strings.Cut(strings.TrimPrefix(location, githubReferencePrefix), "/")
+	if !ok || owner == "" {
+		return githubReference{}, invalid
+	}
+	repoRef, path, ok := strings.Cut(rest, "/")
+	if !ok || path == "" {
+		return githubReference{}, invalid
+	}
+	repo, ref, ok := strings.Cut(repoRef, "@")
+	if !ok || repo == "" || ref == "" {
+		return githubReference{}, invalid
+	}
+	return githubReference{owner: owner, repo: repo, ref: ref, path: path}, nil
+}
+
+func isGithubReference(location string) bool {
+	return strings.HasPrefix(location, githubReferencePrefix)
+}
+
+func contentSHA256(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
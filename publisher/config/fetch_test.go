@@ -0,0 +1,216 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const commitSHA = "0123456789abcdef0123456789abcdef01234567"
+
+func newTestSchemaFetcher(t *testing.T, server *httptest.Server) *SchemaFetcher {
+	f := NewSchemaFetcher(t.TempDir(), "")
+	f.retryDelay = 0
+	f.githubAPI = server.URL + "/api"
+	f.githubRaw = server.URL + "/raw"
+	return f
+}
+
+func TestSchemaFetcher_Fetch_checksum(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{"schema.yml": schemaSets})
+	location := filepath.Join(dir, "schema.yml")
+	checksum := contentSHA256([]byte(schemaSets))
+
+	source, err := defaultSchemaFetcher.Fetch(location, checksum)
+	require.NoError(t, err)
+	assert.Equal(t, checksum, source.SHA256)
+	assert.Equal(t, schemaSets, string(source.Content))
+	assert.Empty(t, source.URL)
+
+	_, err = defaultSchemaFetcher.Fetch(location, contentSHA256([]byte("other")))
+	assert.ErrorIs(t, err, ErrSchemaChecksum)
+
+	_, err = defaultSchemaFetcher.Fetch(location, "abc")
+	assert.ErrorIs(t, err, ErrSchemaChecksum)
+}
+
+func TestSchemaFetcher_Fetch_retries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing.yml":
+			w.WriteHeader(http.StatusNotFound)
+		case requests < 3:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(schemaSets))
+		}
+	}))
+	defer server.Close()
+	f := newTestSchemaFetcher(t, server)
+	retries := metrics.Retries.Value("schema fetch")
+
+	source, err := f.Fetch(server.URL+"/schema.yml", "")
+	require.NoError(t, err)
+	assert.Equal(t, schemaSets, string(source.Content))
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, retries+2, metrics.Retries.Value("schema fetch"))
+
+	requests = 0
+	_, err = f.Fetch(server.URL+"/missing.yml", "")
+	assert.ErrorIs(t, err, ErrSchemaFetch)
+	assert.Equal(t, 1, requests, "client errors are not retried")
+}
+
+func TestSchemaFetcher_Fetch_cache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(schemaSets))
+	}))
+	defer server.Close()
+	f := newTestSchemaFetcher(t, server)
+	checksum := contentSHA256([]byte(schemaSets))
+
+	_, err := f.Fetch(server.URL+"/schema.yml", checksum)
+	require.NoError(t, err)
+	source, err := f.Fetch(server.URL+"/schema.yml", checksum)
+	require.NoError(t, err)
+	assert.Equal(t, schemaSets, string(source.Content))
+	assert.Equal(t, 1, requests)
+
+	// without a checksum the content could have changed
+	_, err = f.Fetch(server.URL+"/schema.yml", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestSchemaFetcher_githubReference(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/repos/newrelic/nri-foo/commits/main":
+			assert.Equal(t, "application/vnd.github.sha", r.Header.Get("Accept"))
+			w.Write([]byte(commitSHA))
+		case "/raw/newrelic/nri-foo/" + commitSHA + "/build/schema.yml":
+			w.Write([]byte(schemaDocument))
+		case "/raw/newrelic/nri-foo/" + commitSHA + "/build/include/sets.yml":
+			w.Write([]byte(schemaSets))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	f := newTestSchemaFetcher(t, server)
+
+	source, err := f.Fetch("github://newrelic/nri-foo@main/build/schema.yml", "")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/raw/newrelic/nri-foo/"+commitSHA+"/build/schema.yml", source.URL)
+
+	// includes are read from the same commit
+	schemas, _, err := f.ParseUploadSchemas(source, true)
+	require.NoError(t, err)
+	assert.Len(t, schemas, 2)
+
+	// commits aren't resolved
+	source, err = f.Fetch("github://newrelic/nri-foo@"+commitSHA+"/build/include/sets.yml", "")
+	require.NoError(t, err)
+	assert.Equal(t, schemaSets, string(source.Content))
+}
+
+func TestSchemaFetcher_githubReference_refWithSlashes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/repos/newrelic/nri-foo/commits/release":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case "/api/repos/newrelic/nri-foo/commits/release%2Fv2":
+			w.Write([]byte(commitSHA))
+		case "/raw/newrelic/nri-foo/" + commitSHA + "/build/include/sets.yml":
+			w.Write([]byte(schemaSets))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	f := newTestSchemaFetcher(t, server)
+
+	source, err := f.Fetch("github://newrelic/nri-foo@release/v2/build/include/sets.yml", "")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/raw/newrelic/nri-foo/"+commitSHA+"/build/include/sets.yml", source.URL)
+	assert.Equal(t, schemaSets, string(source.Content))
+
+	_, err = f.Fetch("github://newrelic/nri-foo@unknown/build/include/sets.yml", "")
+	assert.ErrorIs(t, err, ErrSchemaFetch, "no ref matches")
+}
+
+func TestSchemaFetcher_pinnedIncludes(t *testing.T) {
+	sets := schemaSets
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schema.yml":
+			w.Write([]byte(schemaDocument))
+		case "/include/sets.yml":
+			w.Write([]byte(sets))
+		case "/api/repos/newrelic/nri-foo/commits/main":
+			w.Write([]byte(commitSHA))
+		case "/raw/newrelic/nri-foo/" + commitSHA + "/build/schema.yml":
+			w.Write([]byte("include:\n  - github://newrelic/nri-bar@main/sets.yml\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	f := newTestSchemaFetcher(t, server)
+
+	// the checksum covers the root file only, so a change to an include it can't see fails the publishing
+	source, err := f.Fetch(server.URL+"/schema.yml", contentSHA256([]byte(schemaDocument)))
+	require.NoError(t, err)
+	sets = strings.Replace(schemaSets, "/tools/", "/other/", 1)
+	_, _, err = f.ParseUploadSchemas(source, true)
+	assert.ErrorIs(t, err, ErrSchemaInclude)
+
+	// includes of schemas not pinned can change, which the checksum of the resolved schema records
+	source, err = f.Fetch(server.URL+"/schema.yml", "")
+	require.NoError(t, err)
+	_, changed, err := f.ParseUploadSchemas(source, true)
+	require.NoError(t, err)
+	sets = schemaSets
+	_, original, err := f.ParseUploadSchemas(source, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, original, changed)
+	resolved, err := ResolveSchemaFile(server.URL + "/schema.yml")
+	require.NoError(t, err)
+	assert.Equal(t, contentSHA256(resolved), original, "it's the checksum of the output of schema resolve")
+
+	source, err = f.Fetch("github://newrelic/nri-foo@main/build/schema.yml", "")
+	require.NoError(t, err)
+	_, _, err = f.ParseUploadSchemas(source, true)
+	assert.ErrorIs(t, err, ErrSchemaInclude, "a branch of another repository is not pinned")
+
+	assert.True(t, f.isPinned("github://newrelic/nri-bar@"+commitSHA+"/sets.yml"))
+	assert.True(t, f.isPinned(server.URL+"/raw/newrelic/nri-foo/"+commitSHA+"/build/include/sets.yml"))
+	assert.True(t, f.isPinned("builtin://include/os-sets.yml"))
+	assert.False(t, f.isPinned(server.URL+"/raw/newrelic/nri-foo/main/build/include/sets.yml"))
+}
+
+func TestParseGithubReference(t *testing.T) {
+	ref, err := parseGithubReference("github://newrelic/nri-foo@v1.2.3/build/upload-schema.yml")
+	require.NoError(t, err)
+	assert.Equal(t, githubReference{owner: "newrelic", repo: "nri-foo", ref: "v1.2.3", path: "build/upload-schema.yml"}, ref)
+
+	for _, invalid := range []string{
+		"github://newrelic/nri-foo/build/upload-schema.yml",
+		"github://newrelic/nri-foo@v1.2.3",
+		"github://newrelic",
+		"github:///nri-foo@main/schema.yml",
+	} {
+		_, err = parseGithubReference(invalid)
+		assert.ErrorIs(t, err, ErrGithubReference, invalid)
+	}
+}
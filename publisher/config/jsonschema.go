@@ -0,0 +1,212 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	jsonSchemaID    = "https://raw.githubusercontent.com/newrelic/infrastructure-publish-action/main/schemas/upload-schema.schema.json"
+)
+
+// jsonSchema is the subset of JSON Schema draft-07 used to describe the upload schema files.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Definitions          map[string]*jsonSchema `json:"definitions,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"`
+	Const                string                 `json:"const,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MinItems             int                    `json:"minItems,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	MinProperties        int                    `json:"minProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	AllOf                []*jsonSchema          `json:"allOf,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+	If                   *jsonSchema            `json:"if,omitempty"`
+	Then                 *jsonSchema            `json:"then,omitempty"`
+}
+
+// JSONSchema returns a JSON Schema document describing the upload schema files, to be used by editors
+// through yaml-language-server. It's generated from the UploadArtifactSchema fields, adding the valid upload
+// types, placeholders and the fields required by each upload type. Both the list of artifacts and the
+// document form, with includes and sets, are described.
+func JSONSchema() ([]byte, error) {
+	artifact := reflectJSONSchema(reflect.TypeOf(UploadArtifactSchema{}))
+	artifact.Required = []string{"src", "uploads"}
+	withPlaceholders(artifact.Properties["src"], srcPlaceholders)
+	artifact.Properties["arch"].MinItems = 1
+	artifact.Properties["arch"] = listOrSetReference(artifact.Properties["arch"], "arch_sets")
+	artifact.Properties["uploads"].MinItems = 1
+
+	for _, rules := range []string{"exclude", "include"} {
+		rule := artifact.Properties[rules].Items
+		rule.Properties["type"].Enum = fileTypes
+		rule.Properties["arch"].Type = []string{"string", "number"}
+		rule.Properties["os_version"].Type = []string{"string", "number"}
+		rule.MinProperties = 1
+	}
+
+	// vars are expanded by the resolver, so they aren't a field of the artifacts
+	artifact.Properties["vars"] = &jsonSchema{
+		Type:        "object",
+		Description: "Placeholders replaced in the artifact, repeated for each combination of their values",
+		AdditionalProperties: &jsonSchema{
+			Type:     "array",
+			Items:    &jsonSchema{Type: []string{"string", "number"}},
+			MinItems: 1,
+		},
+	}
+
+	upload := artifact.Properties["uploads"].Items
+	upload.Required = []string{"type", "dest"}
+	upload.Properties["type"].Enum = fileTypes
+	withPlaceholders(upload.Properties["dest"], destPlaceholders)
+	withPlaceholders(upload.Properties["src_repo"], srcRepoPlaceholders)
+	upload.AllOf = []*jsonSchema{
+		requiredForType(TypeApt, "src_repo", "os_version"),
+		requiredForType(TypeYum, "os_version"),
+		requiredForType(TypeZypp, "os_version"),
+	}
+	upload.Properties["os_version"] = listOrSetReference(upload.Properties["os_version"], "os_sets")
+
+	prerelease := upload.Properties["prerelease"]
+	withPlaceholders(prerelease.Properties["dest"], destPlaceholders)
+	withPlaceholders(prerelease.Properties["src_repo"], srcRepoPlaceholders)
+
+	artifactsRef := &jsonSchema{Ref: "#/definitions/artifacts"}
+	sets := func(description string) *jsonSchema {
+		return &jsonSchema{Type: "object", Description: description, AdditionalProperties: reflectJSONSchema(reflect.TypeOf([]string{}))}
+	}
+	noAdditional := false
+	archMaps := &jsonSchema{
+		Type:                 "object",
+		Description:          "Arch names used in the destination by upload type, added to the arch_map of the uploads",
+		Properties:           make(map[string]*jsonSchema),
+		AdditionalProperties: &noAdditional,
+	}
+	for _, uploadType := range fileTypes {
+		archMaps.Properties[uploadType] = reflectJSONSchema(reflect.TypeOf(map[string]string{}))
+	}
+	document := &jsonSchema{
+		Type: "object",
+		Properties: map[string]*jsonSchema{
+			"include": {
+				Type:        "array",
+				Description: "Schema files, relative to this one, or URLs whose sets and artifacts are added",
+				Items:       &jsonSchema{Type: "string"},
+			},
+			"vars": {
+				Type:                 "object",
+				Description:          "Placeholders replaced in every artifact",
+				AdditionalProperties: &jsonSchema{Type: []string{"string", "number"}},
+			},
+			"os_sets":   sets("Named lists of OS versions, referenced as os_version: $name"),
+			"arch_sets": sets("Named lists of architectures, referenced as arch: $name"),
+			"arch_maps": archMaps,
+			// $ref siblings are ignored in draft-07, so the description needs allOf
+			"artifacts": {Description: "Artifacts of this schema file", AllOf: []*jsonSchema{artifactsRef}},
+		},
+		AdditionalProperties: &noAdditional,
+	}
+
+	schema := &jsonSchema{
+		Schema:      jsonSchemaDraft,
+		ID:          jsonSchemaID,
+		Title:       "Upload schema",
+		Description: "Artifacts published by infrastructure-publish-action",
+		Definitions: map[string]*jsonSchema{
+			"artifact":  artifact,
+			"artifacts": {Type: "array", Items: &jsonSchema{Ref: "#/definitions/artifact"}},
+		},
+		OneOf: []*jsonSchema{artifactsRef, document},
+	}
+
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// reflectJSONSchema describes a type, taking the property names from the yaml tags and their descriptions
+// from the description tags. Structs don't allow additional properties, as unknown keys are rejected.
+func reflectJSONSchema(t reflect.Type) *jsonSchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return reflectJSONSchema(t.Elem())
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Slice:
+		items := reflectJSONSchema(t.Elem())
+		if t.Elem().Kind() == reflect.String {
+			// unquoted versions and archs like 6 or 386 are read as strings
+			items.Type = []string{"string", "number"}
+		}
+		return &jsonSchema{Type: "array", Items: items}
+	case reflect.Map:
+		values := reflectJSONSchema(t.Elem())
+		if t.Elem().Kind() == reflect.String {
+			values.Type = []string{"string", "number"}
+		}
+		return &jsonSchema{Type: "object", AdditionalProperties: values}
+	case reflect.Struct:
+		noAdditional := false
+		schema := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema), AdditionalProperties: &noAdditional}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			property := reflectJSONSchema(field.Type)
+			property.Description = field.Tag.Get("description")
+			schema.Properties[name] = property
+		}
+		return schema
+	default:
+		panic(fmt.Sprintf("no JSON Schema for type %s", t))
+	}
+}
+
+// listOrSetReference accepts a list, which can hold set references, or a single set reference.
+func listOrSetReference(list *jsonSchema, sets string) *jsonSchema {
+	description := list.Description
+	list.Description = ""
+	return &jsonSchema{
+		Description: description,
+		OneOf: []*jsonSchema{
+			list,
+			{Type: "string", Pattern: `^\$`, Description: fmt.Sprintf("Reference to one of the %s", sets)},
+		},
+	}
+}
+
+// requiredForType requires fields on uploads of the given type.
+func requiredForType(uploadType string, fields ...string) *jsonSchema {
+	return &jsonSchema{
+		If:   &jsonSchema{Properties: map[string]*jsonSchema{"type": {Const: uploadType}}},
+		Then: &jsonSchema{Required: fields},
+	}
+}
+
+// placeholdersPattern matches strings where braces are only used by placeholders, or doubled to escape them.
+// Any name is accepted, as vars define their own placeholders; the lint checks them once the vars are resolved.
+const placeholdersPattern = `^([^{}]|\{\{|\}\}|\{[a-z_][a-z0-9_]*\})*$`
+
+// withPlaceholders restricts the braces of a string property to placeholders, listing the built-in ones.
+func withPlaceholders(property *jsonSchema, placeholders []string) {
+	property.Pattern = placeholdersPattern
+	property.Description = fmt.Sprintf("%s. Placeholders: %s and the vars", property.Description, strings.Join(placeholders, ", "))
+}
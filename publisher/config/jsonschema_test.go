@@ -0,0 +1,91 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// jsonSchemaFile is the published JSON Schema, regenerate it with `make schema/jsonschema`.
+const jsonSchemaFile = "../../schemas/upload-schema.schema.json"
+
+func TestJSONSchema_inSync(t *testing.T) {
+	expected, err := JSONSchema()
+	require.NoError(t, err)
+
+	published, err := os.ReadFile(jsonSchemaFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(published), "%s is outdated, run `make schema/jsonschema`", jsonSchemaFile)
+}
+
+func TestJSONSchema(t *testing.T) {
+	content, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema jsonSchema
+	require.NoError(t, json.Unmarshal(content, &schema))
+
+	artifact := schema.Definitions["artifact"]
+	upload := artifact.Properties["uploads"].Items
+	assert.Equal(t, []string{"file", "zypp", "yum", "apt"}, upload.Properties["type"].Enum)
+	assert.Equal(t, placeholdersPattern, upload.Properties["src_repo"].Pattern)
+	assert.Contains(t, upload.Properties["src_repo"].Description, "Placeholders: {access_point_host} and the vars")
+	assert.Equal(t, []string{"src_repo", "os_version"}, upload.AllOf[0].Then.Required)
+	assert.Equal(t, TypeApt, upload.AllOf[0].If.Properties["type"].Const)
+
+	assert.Equal(t, "#/definitions/artifacts", schema.OneOf[0].Ref)
+	assert.Equal(t, `^\$`, upload.Properties["os_version"].OneOf[1].Pattern)
+
+	// every key accepted in the schema files is described
+	for _, object := range []*jsonSchema{artifact, upload, upload.Properties["prerelease"], schema.OneOf[1]} {
+		assert.Equal(t, false, object.AdditionalProperties)
+		for name, property := range object.Properties {
+			assert.NotEmpty(t, property.Description, name)
+		}
+	}
+}
+
+func TestJSONSchema_readmeVars(t *testing.T) {
+	published, err := os.ReadFile(jsonSchemaFile)
+	require.NoError(t, err)
+	var schema jsonSchema
+	require.NoError(t, json.Unmarshal(published, &schema))
+
+	readme, err := os.ReadFile("../../README.md")
+	require.NoError(t, err)
+	_, vars, found := strings.Cut(string(readme), "### Vars")
+	require.True(t, found)
+	_, example, found := strings.Cut(vars, "```yaml\n")
+	require.True(t, found)
+	example, _, _ = strings.Cut(example, "```")
+
+	var document struct {
+		Artifacts []map[string]interface{} `yaml:"artifacts"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(example), &document))
+	require.NotEmpty(t, document.Artifacts)
+
+	// the README example uses vars as placeholders, which the published schema must accept
+	artifact := schema.Definitions["artifact"]
+	upload := artifact.Properties["uploads"].Items
+	for _, a := range document.Artifacts {
+		assert.Regexp(t, regexp.MustCompile(artifact.Properties["src"].Pattern), a["src"])
+		for key := range a {
+			assert.Contains(t, artifact.Properties, key)
+		}
+		for _, u := range a["uploads"].([]interface{}) {
+			u := u.(map[string]interface{})
+			assert.Regexp(t, regexp.MustCompile(upload.Properties["dest"].Pattern), u["dest"])
+			for key := range u {
+				assert.Contains(t, upload.Properties, key)
+			}
+		}
+	}
+	assert.NotRegexp(t, regexp.MustCompile(upload.Properties["dest"].Pattern), "{Channel}/{src}")
+}
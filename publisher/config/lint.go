@@ -0,0 +1,297 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	yamlErrorLineRegex  = regexp.MustCompile(`line (\d+)`)
+	srcPlaceholders     = utils.TemplatePlaceholders
+	destPlaceholders    = append(append([]string{}, utils.TemplatePlaceholders...), utils.PlaceholderForSrc, utils.PlaceholderForDestArch)
+	srcRepoPlaceholders = []string{utils.PlaceholderForAccessPointHost}
+)
+
+// Diagnostic is a problem found linting a schema file.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Column == 0 {
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// LintSchemaFile reads a schema file, or any location supported by SchemaFetcher, and lints it, see LintSchema.
+func LintSchemaFile(schemaPath, appName string) ([]Diagnostic, error) {
+	source, err := defaultSchemaFetcher.Fetch(schemaPath, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return LintSchema(source.location(), source.Content, appName), nil
+}
+
+// LintSchema reports every problem found in a schema with its position, instead of failing on the first one.
+// Besides the checks of parsing and ValidateSchemas it looks for unknown keys and placeholders, uploads that
+// would publish nothing or would be incomplete, and duplicated destinations. Vars are replaced before linting,
+// so undefined ones are reported as unknown placeholders. The app name prefix of the
+// sources is only checked when appName is not empty.
+func LintSchema(file string, content []byte, appName string) []Diagnostic {
+	l := &linter{file: file, appName: appName, dests: make(map[string]*yaml.Node)}
+
+	resolved, err := resolveSchema(file, content)
+	if err != nil {
+		line := 0
+		if m := yamlErrorLineRegex.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		l.diags = append(l.diags, Diagnostic{File: file, Line: line, Message: err.Error()})
+		return l.diags
+	}
+
+	root := resolved.root
+	if len(root.Content) == 0 {
+		l.diags = append(l.diags, Diagnostic{File: file, Line: 1, Column: 1, Message: "schema without artifacts"})
+		return l.diags
+	}
+
+	for _, entry := range root.Content {
+		// artifacts can come from included files
+		l.file = resolved.files[entry]
+		if l.file == "" {
+			l.file = file
+		}
+		for _, unknown := range unknownKeys(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{entry}}) {
+			if suggestion := unknown.suggestion(); suggestion != "" {
+				l.report(unknown.key, "unknown key '%s' in %s, did you mean '%s'?", unknown.key.Value, unknown.where, suggestion)
+				continue
+			}
+			l.report(unknown.key, "unknown key '%s' in %s", unknown.key.Value, unknown.where)
+		}
+		l.lintEntry(entry)
+	}
+
+	return l.diags
+}
+
+type linter struct {
+	file    string
+	appName string
+	diags   []Diagnostic
+	// dests holds the already seen file destinations, to detect duplicates
+	dests map[string]*yaml.Node
+}
+
+func (l *linter) report(n *yaml.Node, format string, args ...interface{}) {
+	diag := Diagnostic{
+		File:    l.file,
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	}
+	// artifacts repeated for their vars share the same nodes
+	for _, reported := range l.diags {
+		if reported == diag {
+			return
+		}
+	}
+	l.diags = append(l.diags, diag)
+}
+
+func (l *linter) lintEntry(entry *yaml.Node) {
+	if entry.Kind != yaml.MappingNode {
+		l.report(entry, "schema entry should be a map")
+		return
+	}
+	src := mappingValue(entry, "src")
+	srcName := ""
+	if src == nil {
+		l.report(entry, "missing src in schema entry")
+	} else {
+		srcName = src.Value
+		l.lintPlaceholders(src, srcPlaceholders, "src")
+		if l.appName != "" {
+			if err := validateName(l.appName, src.Value); err != nil {
+				l.report(src, "%v", err)
+			}
+		}
+	}
+
+	if arch := mappingValue(entry, "arch"); arch != nil {
+		if arch.Kind == yaml.SequenceNode && len(arch.Content) == 0 {
+			l.report(arch, "empty arch list in schema entry '%s', omit it for artifacts without arch", srcName)
+		} else if arch.Kind != yaml.SequenceNode && arch.Tag != "!!null" {
+			l.report(arch, "arch should be a list")
+		}
+	}
+
+	uploads := mappingValue(entry, "uploads")
+	if uploads == nil || uploads.Kind == yaml.SequenceNode && len(uploads.Content) == 0 {
+		l.report(entry, "%s for schema entry '%s'", noDestinationError, srcName)
+		return
+	}
+	if uploads.Kind != yaml.SequenceNode {
+		l.report(uploads, "uploads should be a list")
+		return
+	}
+
+	anyOsVersion := false
+	for _, upload := range uploads.Content {
+		if l.lintUpload(upload, srcName) {
+			anyOsVersion = true
+		}
+	}
+
+	if src != nil && !anyOsVersion && strings.Contains(src.Value, utils.PlaceholderForOsVersion) {
+		l.report(src, "src uses %s but no upload has an os_version list", utils.PlaceholderForOsVersion)
+	}
+
+	l.lintMatrix(entry, srcName)
+}
+
+// lintMatrix reports invalid matrix rules, and exclude rules not matching any combination, likely a typo.
+func (l *linter) lintMatrix(entry *yaml.Node, src string) {
+	var schema UploadArtifactSchema
+	if err := entry.Decode(&schema); err != nil {
+		// type errors are reported by the other checks
+		return
+	}
+	if err := validateMatrix(schema); err != nil {
+		node := mappingValue(entry, "exclude")
+		if node == nil {
+			node = mappingValue(entry, "include")
+		}
+		l.report(node, "%v in schema entry '%s'", err, src)
+		return
+	}
+
+	rules := mappingValue(entry, "exclude")
+	if rules == nil || rules.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, rule := range schema.Exclude {
+		matches := false
+		for _, upload := range schema.Uploads {
+			if (rule.Type == "" || rule.Type == upload.Type) &&
+				(rule.Arch == "" || contains(schema.Arch, rule.Arch)) &&
+				(rule.OsVersion == "" || contains(upload.OsVersion, rule.OsVersion)) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			l.report(rules.Content[i], "exclude rule matches no arch and os_version of schema entry '%s'", src)
+		}
+	}
+}
+
+// lintUpload returns whether the upload has os versions.
+func (l *linter) lintUpload(upload *yaml.Node, src string) bool {
+	if upload.Kind != yaml.MappingNode {
+		l.report(upload, "upload should be a map")
+		return false
+	}
+	// problems about the type are reported at the type key, or at the upload when missing
+	typeNode, typeValue := upload, ""
+	if uploadType := mappingValue(upload, "type"); uploadType == nil {
+		l.report(upload, "missing type in upload of schema entry '%s'", src)
+	} else {
+		typeNode = uploadType
+		typeValue = uploadType.Value
+		if err := validateType(typeValue); err != nil {
+			l.report(uploadType, "%v", err)
+		}
+	}
+
+	osVersions := 0
+	if osVersion := mappingValue(upload, "os_version"); osVersion != nil {
+		if osVersion.Kind == yaml.SequenceNode {
+			osVersions = len(osVersion.Content)
+		} else if osVersion.Tag != "!!null" {
+			l.report(osVersion, "os_version should be a list")
+		}
+	}
+	if osVersions == 0 && (typeValue == TypeApt || typeValue == TypeYum || typeValue == TypeZypp) {
+		l.report(typeNode, "%s upload without os_version publishes nothing", typeValue)
+	}
+
+	srcRepo := mappingValue(upload, "src_repo")
+	if srcRepo != nil {
+		l.lintPlaceholders(srcRepo, srcRepoPlaceholders, "src_repo")
+	} else if typeValue == TypeApt {
+		l.report(typeNode, "apt upload without src_repo")
+	}
+
+	dest := mappingValue(upload, "dest")
+	if dest == nil {
+		l.report(upload, "missing dest in upload of schema entry '%s'", src)
+	} else {
+		l.lintDest(dest, src, typeValue, osVersions, "")
+	}
+
+	if prerelease := mappingValue(upload, "prerelease"); prerelease != nil {
+		if prerelease.Kind != yaml.MappingNode {
+			l.report(prerelease, "prerelease should be a map")
+		} else {
+			if prereleaseSrcRepo := mappingValue(prerelease, "src_repo"); prereleaseSrcRepo != nil {
+				l.lintPlaceholders(prereleaseSrcRepo, srcRepoPlaceholders, "src_repo")
+			}
+			if prereleaseDest := mappingValue(prerelease, "dest"); prereleaseDest != nil {
+				l.lintDest(prereleaseDest, src, typeValue, osVersions, "prerelease ")
+			}
+		}
+	}
+
+	return osVersions > 0
+}
+
+func (l *linter) lintDest(dest *yaml.Node, src, uploadType string, osVersions int, kind string) {
+	l.lintPlaceholders(dest, destPlaceholders, "dest")
+	if osVersions == 0 && strings.Contains(dest.Value, utils.PlaceholderForOsVersion) {
+		l.report(dest, "dest uses %s but the upload has no os_version list", utils.PlaceholderForOsVersion)
+	}
+
+	// repositories can hold many packages, files can only be published once
+	if uploadType != TypeFile {
+		return
+	}
+	key := kind + strings.Replace(dest.Value, utils.PlaceholderForSrc, src, -1)
+	if first, ok := l.dests[key]; ok {
+		l.report(dest, "duplicate %sdestination '%s', already used at line %d", kind, dest.Value, first.Line)
+		return
+	}
+	l.dests[key] = dest
+}
+
+func (l *linter) lintPlaceholders(n *yaml.Node, known []string, field string) {
+	placeholders, err := utils.Placeholders(n.Value)
+	if err != nil {
+		l.report(n, "%v", err)
+		return
+	}
+	for _, placeholder := range placeholders {
+		if !contains(known, placeholder) {
+			l.report(n, "unknown placeholder %s in %s (valid placeholders: %s)", placeholder, field, strings.Join(known, ", "))
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		appName  string
+		schema   string
+		expected []string
+	}{
+		{
+			name: "valid schema",
+			schema: `
+- src: "{app_name}-{version}.tar.gz"
+  arch: [amd64]
+  uploads:
+    - type: file
+      dest: "/binaries/{arch}/{src}"
+`,
+		},
+		{
+			name:     "syntax error",
+			schema:   "- src: foo\n  uploads: bar: baz\n",
+			expected: []string{"schema.yml:2: yaml: line 2: mapping values are not allowed in this context"},
+		},
+		{
+			name:     "not a list",
+			schema:   "foo\n",
+			expected: []string{"schema.yml:1: invalid schema document: schema.yml should be a list of artifacts or a map, at line 1"},
+		},
+		{
+			name:     "unknown document key",
+			schema:   "src: foo\n",
+			expected: []string{"schema.yml:1: invalid schema document: unknown key 'src' in schema.yml at line 1"},
+		},
+		{
+			name: "unknown keys",
+			schema: `
+- src: foo.tar.gz
+  archs: [amd64]
+  uploads:
+    - type: file
+      dest: /tmp
+      destination: /tmp
+      prerelease:
+        skipp: true
+`,
+			expected: []string{
+				"schema.yml:3:3: unknown key 'archs' in schema entry, did you mean 'arch'?",
+				"schema.yml:7:7: unknown key 'destination' in upload of schema entry 'foo.tar.gz'",
+				"schema.yml:9:9: unknown key 'skipp' in prerelease upload of schema entry 'foo.tar.gz', did you mean 'skip'?",
+			},
+		},
+		{
+			name: "invalid type and placeholders",
+			schema: `
+- src: "{integration}-{version}.tar.gz"
+  uploads:
+    - type: msi
+      dest: "/{arch}/{source}"
+`,
+			expected: []string{
+				"schema.yml:2:8: unknown placeholder {integration} in src (valid placeholders: {repo_name}, {app_name}, {arch}, {tag}, {version}, {major}, {minor}, {patch}, {prerelease}, {build}, {dest_prefix}, {os_version})",
+				"schema.yml:4:13: invalid upload type: 'msi' (valid types: file, zypp, yum, apt)",
+				"schema.yml:5:13: unknown placeholder {source} in dest (valid placeholders: {repo_name}, {app_name}, {arch}, {tag}, {version}, {major}, {minor}, {patch}, {prerelease}, {build}, {dest_prefix}, {os_version}, {src}, {dest_arch})",
+			},
+		},
+		{
+			name: "uploads publishing nothing",
+			schema: `
+- src: foo.tar.gz
+  arch: []
+- src: foo.rpm
+  uploads:
+    - type: yum
+      dest: "/linux/yum/{os_version}"
+    - type: apt
+      dest: /linux/apt
+      os_version: [focal]
+`,
+			expected: []string{
+				"schema.yml:3:9: empty arch list in schema entry 'foo.tar.gz', omit it for artifacts without arch",
+				"schema.yml:2:3: no uploads were provided for the schema for schema entry 'foo.tar.gz'",
+				"schema.yml:6:13: yum upload without os_version publishes nothing",
+				"schema.yml:7:13: dest uses {os_version} but the upload has no os_version list",
+				"schema.yml:8:13: apt upload without src_repo",
+			},
+		},
+		{
+			name: "duplicate destinations",
+			schema: `
+- src: foo.tar.gz
+  uploads:
+    - type: file
+      dest: "/tmp/{src}"
+- src: foo.tar.gz
+  uploads:
+    - type: file
+      dest: /tmp/foo.tar.gz
+`,
+			expected: []string{"schema.yml:9:13: duplicate destination '/tmp/foo.tar.gz', already used at line 5"},
+		},
+		{
+			name:    "app name prefix",
+			appName: "nri-foo",
+			schema: `
+- src: nri-bar.tar.gz
+  uploads:
+    - type: file
+      dest: /tmp
+`,
+			expected: []string{"schema.yml:2:8: invalid app name: nri-foo should prefix nri-bar.tar.gz"},
+		},
+		{
+			name: "vars",
+			schema: `
+artifacts:
+  - src: "foo_{flavor}.deb"
+    vars:
+      flavor: [systemd, upstart]
+    uploads:
+      - type: file
+        dest: "/{flavour}/{src}"
+`,
+			expected: []string{
+				"schema.yml:8:15: unknown placeholder {flavour} in dest (valid placeholders: {repo_name}, {app_name}, {arch}, {tag}, {version}, {major}, {minor}, {patch}, {prerelease}, {build}, {dest_prefix}, {os_version}, {src}, {dest_arch})",
+			},
+		},
+		{
+			name: "matrix rules",
+			schema: `
+- src: "foo-{os_version}-{arch}.rpm"
+  arch: [amd64, arm64]
+  exclude:
+    - arch: arm64
+      os_version: 6
+    - arch: arm46
+  uploads:
+    - type: yum
+      dest: "/yum/{os_version}/{arch}/"
+      os_version: [6, 7]
+- src: "bar-{arch}.tar.gz"
+  arch: [amd64]
+  include:
+    - os_version: 7
+  uploads:
+    - type: file
+      dest: "/bar/{arch}/{src}"
+`,
+			expected: []string{
+				"schema.yml:7:7: exclude rule matches no arch and os_version of schema entry 'foo-{os_version}-{arch}.rpm'",
+				"schema.yml:15:5: invalid matrix rule: include without arch, the schema entry has arch in schema entry 'bar-{arch}.tar.gz'",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, diag := range LintSchema("schema.yml", []byte(tt.schema), tt.appName) {
+				got = append(got, diag.String())
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestLintSchemaFile_included(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"schema.yml":       "include: [include/sets.yml]\nartifacts: []\n",
+		"include/sets.yml": "artifacts:\n  - src: foo.tar.gz\n    uploads:\n      - type: file\n        dest: /tmp\n        overide: true\n",
+	})
+
+	diags, err := LintSchemaFile(filepath.Join(dir, "schema.yml"), "")
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, filepath.Join(dir, "include/sets.yml")+":6:9: unknown key 'overide' in upload of schema entry 'foo.tar.gz', did you mean 'override'?", diags[0].String())
+}
+
+func TestLintSchema_bundledSchemas(t *testing.T) {
+	schemas, err := registry.List()
+	require.NoError(t, err)
+	require.NotEmpty(t, schemas)
+
+	for _, schema := range schemas {
+		diags, err := LintSchemaFile(schema.Location(), "")
+		require.NoError(t, err)
+		assert.Empty(t, diags, schema.String())
+	}
+
+	diags, err := LintSchemaFile("../../schemas/e2e.yml", "")
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidMatrix = errors.New("invalid matrix rule")
+
+// MatrixRule selects combinations of arch and os_version of a schema entry, like GitHub matrix exclude and
+// include. Empty fields match any value.
+type MatrixRule struct {
+	Arch      string `yaml:"arch" description:"Architecture of the combination"`
+	OsVersion string `yaml:"os_version" description:"OS version of the combination"`
+	Type      string `yaml:"type" description:"Limit the rule to the uploads of this type"`
+}
+
+// Target is a combination of arch and os_version an upload is published for. OsVersion is empty for
+// file uploads without os_version.
+type Target struct {
+	Arch      string
+	OsVersion string
+}
+
+// Targets returns the combinations an upload is published for: the cross product of the schema arch and the
+// upload os_version, iterating os versions for every arch, without the combinations matching an exclude
+// rule. Include rules add their combination afterwards to the uploads of their type, only to uploads with
+// os_version when the rule has one, and only to uploads without it otherwise. Repositories are published per
+// os version, so apt, yum and zypp uploads without os_version have no targets.
+func (s UploadArtifactSchema) Targets(upload Upload) []Target {
+	osVersions := upload.OsVersion
+	if len(osVersions) == 0 {
+		if upload.Type != TypeFile {
+			return nil
+		}
+		osVersions = []string{""}
+	}
+
+	var targets []Target
+	for _, arch := range s.Arch {
+		for _, osVersion := range osVersions {
+			target := Target{Arch: arch, OsVersion: osVersion}
+			if !s.excludes(upload, target) {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	for _, rule := range s.Include {
+		if rule.Type != "" && rule.Type != upload.Type {
+			continue
+		}
+		if (rule.OsVersion != "") != (len(upload.OsVersion) > 0) {
+			continue
+		}
+		target := Target{Arch: rule.Arch, OsVersion: rule.OsVersion}
+		if !containsTarget(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func (s UploadArtifactSchema) excludes(upload Upload, target Target) bool {
+	for _, rule := range s.Exclude {
+		if (rule.Type == "" || rule.Type == upload.Type) &&
+			(rule.Arch == "" || rule.Arch == target.Arch) &&
+			(rule.OsVersion == "" || rule.OsVersion == target.OsVersion) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMatrix checks the rules select something, and that included combinations are complete.
+func validateMatrix(schema UploadArtifactSchema) error {
+	hasArch := len(schema.Arch) > 1 || len(schema.Arch) == 1 && schema.Arch[0] != ""
+	for _, rule := range schema.Exclude {
+		if rule.Arch == "" && rule.OsVersion == "" {
+			return fmt.Errorf("%w: exclude without arch nor os_version would exclude every upload", ErrInvalidMatrix)
+		}
+	}
+	for _, rule := range append(append([]MatrixRule{}, schema.Exclude...), schema.Include...) {
+		if rule.Type != "" {
+			if err := validateType(rule.Type); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidMatrix, err)
+			}
+		}
+	}
+	for _, rule := range schema.Include {
+		if hasArch && rule.Arch == "" {
+			return fmt.Errorf("%w: include without arch, the schema entry has arch", ErrInvalidMatrix)
+		}
+		if rule.Arch == "" && rule.OsVersion == "" {
+			return fmt.Errorf("%w: include without arch nor os_version", ErrInvalidMatrix)
+		}
+	}
+	return nil
+}
+
+func containsTarget(targets []Target, target Target) bool {
+	for _, t := range targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
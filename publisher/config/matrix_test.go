@@ -0,0 +1,142 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargets(t *testing.T) {
+	rpm := Upload{Type: TypeYum, Dest: "/yum/{os_version}/{arch}/", OsVersion: []string{"6", "7"}}
+	file := Upload{Type: TypeFile, Dest: "/files/{arch}/{src}"}
+
+	tests := []struct {
+		name     string
+		schema   UploadArtifactSchema
+		upload   Upload
+		expected []Target
+	}{
+		{
+			name:   "cross product",
+			schema: UploadArtifactSchema{Arch: []string{"amd64", "arm64"}},
+			upload: rpm,
+			expected: []Target{
+				{Arch: "amd64", OsVersion: "6"},
+				{Arch: "amd64", OsVersion: "7"},
+				{Arch: "arm64", OsVersion: "6"},
+				{Arch: "arm64", OsVersion: "7"},
+			},
+		},
+		{
+			name:     "without os_version",
+			schema:   UploadArtifactSchema{Arch: []string{"amd64", "arm64"}},
+			upload:   file,
+			expected: []Target{{Arch: "amd64"}, {Arch: "arm64"}},
+		},
+		{
+			name: "exclude combination",
+			schema: UploadArtifactSchema{
+				Arch:    []string{"amd64", "arm64"},
+				Exclude: []MatrixRule{{Arch: "arm64", OsVersion: "6"}},
+			},
+			upload: rpm,
+			expected: []Target{
+				{Arch: "amd64", OsVersion: "6"},
+				{Arch: "amd64", OsVersion: "7"},
+				{Arch: "arm64", OsVersion: "7"},
+			},
+		},
+		{
+			name: "exclude os_version",
+			schema: UploadArtifactSchema{
+				Arch:    []string{"amd64", "arm64"},
+				Exclude: []MatrixRule{{OsVersion: "6"}},
+			},
+			upload:   rpm,
+			expected: []Target{{Arch: "amd64", OsVersion: "7"}, {Arch: "arm64", OsVersion: "7"}},
+		},
+		{
+			name: "exclude of another type",
+			schema: UploadArtifactSchema{
+				Arch:    []string{"amd64", "arm64"},
+				Exclude: []MatrixRule{{Arch: "arm64", Type: TypeZypp}},
+			},
+			upload:   file,
+			expected: []Target{{Arch: "amd64"}, {Arch: "arm64"}},
+		},
+		{
+			name: "include",
+			schema: UploadArtifactSchema{
+				Arch: []string{"amd64"},
+				Include: []MatrixRule{
+					{Arch: "386", OsVersion: "6"},
+					{Arch: "amd64", OsVersion: "7"},
+					{Arch: "arm", Type: TypeFile},
+				},
+			},
+			upload: rpm,
+			expected: []Target{
+				{Arch: "amd64", OsVersion: "6"},
+				{Arch: "amd64", OsVersion: "7"},
+				{Arch: "386", OsVersion: "6"},
+			},
+		},
+		{
+			name: "include without os_version",
+			schema: UploadArtifactSchema{
+				Arch:    []string{"amd64"},
+				Include: []MatrixRule{{Arch: "386", OsVersion: "6"}, {Arch: "arm"}},
+			},
+			upload:   file,
+			expected: []Target{{Arch: "amd64"}, {Arch: "arm"}},
+		},
+		{
+			name: "repository without os_version",
+			schema: UploadArtifactSchema{
+				Arch:    []string{"amd64"},
+				Include: []MatrixRule{{Arch: "arm"}},
+			},
+			upload:   Upload{Type: TypeApt, Dest: "/apt/"},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.schema.Targets(tt.upload))
+		})
+	}
+}
+
+func TestParseSchema_matrix(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		message string
+	}{
+		{
+			name:    "exclude everything",
+			schema:  "- src: foo\n  exclude:\n    - type: file\n  uploads:\n    - type: file\n      dest: /tmp\n",
+			message: "invalid matrix rule: exclude without arch nor os_version would exclude every upload in schema entry 'foo'",
+		},
+		{
+			name:    "invalid type",
+			schema:  "- src: foo\n  arch: [amd64]\n  exclude:\n    - arch: amd64\n      type: rpm\n  uploads:\n    - type: file\n      dest: /tmp\n",
+			message: "invalid matrix rule: invalid upload type: 'rpm'",
+		},
+		{
+			name:    "include without arch",
+			schema:  "- src: foo\n  arch: [amd64]\n  include:\n    - os_version: 7\n  uploads:\n    - type: file\n      dest: /tmp\n",
+			message: "invalid matrix rule: include without arch, the schema entry has arch in schema entry 'foo'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseUploadSchema([]byte(tt.schema), true)
+			require.ErrorIs(t, err, ErrInvalidMatrix)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
@@ -0,0 +1,534 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/registry"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// setReferencePrefix marks a reference to an os or arch set, i.e. os_version: $debian_ubuntu
+	setReferencePrefix = "$"
+)
+
+var (
+	ErrSchemaInclude   = errors.New("invalid schema include")
+	ErrSchemaSet       = errors.New("invalid schema set")
+	ErrSchemaDocument  = errors.New("invalid schema document")
+	ErrSchemaVar       = errors.New("invalid schema var")
+	schemaDocumentKeys = map[string]bool{"include": true, "vars": true, "os_sets": true, "arch_sets": true, "arch_maps": true, "artifacts": true}
+	varNameRegex       = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// resolvedSchema is a schema with its includes and set references expanded, as a list of artifacts.
+type resolvedSchema struct {
+	root *yaml.Node
+	// files maps each artifact to the schema file defining it
+	files map[*yaml.Node]string
+}
+
+// schemaResolver expands the document form of the schemas, a map allowing to reuse lists:
+//
+//	include:
+//	  - include/os-sets.yml
+//	vars:
+//	  channel: stable
+//	os_sets:
+//	  el: [7, 8, 9]
+//	arch_sets:
+//	  linux: [amd64, arm64]
+//	arch_maps:
+//	  yum:
+//	    arm: armv7hl
+//	artifacts:
+//	  - src: "{app_name}-{version}-1.{arch}.rpm"
+//	    arch: $linux
+//	    uploads:
+//	      - type: yum
+//	        dest: "{dest_prefix}linux/{channel}/yum/el/{os_version}/{arch}/"
+//	        os_version: [$el, 10]
+//	  - src: "{app_name}_{flavor}_{version}_{arch}.deb"
+//	    vars:
+//	      flavor: [systemd, upstart]
+//	    ...
+//
+// vars define placeholders replaced in the values of every artifact. The vars of an artifact are lists,
+// the artifact is repeated for each combination of their values, like it's done for arch.
+// arch_maps are added to the arch_map of every upload of their type, the upload ones taking precedence.
+// Included files, paths relative to the including one or URLs, contribute their sets, maps and artifacts.
+// Schemas consisting of a list of artifacts are still supported, but can't define sets.
+type schemaResolver struct {
+	osSets   map[string]*yaml.Node
+	archSets map[string]*yaml.Node
+	// archMaps holds the arch_maps by upload type
+	archMaps map[string]*yaml.Node
+	vars     map[string]string
+	fetcher  *SchemaFetcher
+	// pinned requires the includes to be pinned, see SchemaFetcher.isPinned
+	pinned bool
+	// including holds the chain of files being loaded, to detect cycles
+	including []string
+	resolved  resolvedSchema
+}
+
+func newSchemaResolver(fetcher *SchemaFetcher) *schemaResolver {
+	return &schemaResolver{
+		fetcher:  fetcher,
+		osSets:   make(map[string]*yaml.Node),
+		archSets: make(map[string]*yaml.Node),
+		archMaps: make(map[string]*yaml.Node),
+		vars:     make(map[string]string),
+		resolved: resolvedSchema{
+			root:  &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"},
+			files: make(map[*yaml.Node]string),
+		},
+	}
+}
+
+// resolveSchemaFile resolves a schema file, URL or github:// reference.
+func resolveSchemaFile(location string) (resolvedSchema, error) {
+	source, err := defaultSchemaFetcher.Fetch(location, "")
+	if err != nil {
+		return resolvedSchema{}, err
+	}
+	return defaultSchemaFetcher.resolve(source)
+}
+
+// resolveSchema resolves the content of a schema, includes are relative to the location, if any.
+func resolveSchema(location string, content []byte) (resolvedSchema, error) {
+	return defaultSchemaFetcher.resolve(SchemaSource{Location: location, Content: content})
+}
+
+// resolve resolves a fetched schema, reading its includes with the fetcher.
+func (f *SchemaFetcher) resolve(source SchemaSource) (resolvedSchema, error) {
+	r := newSchemaResolver(f)
+	r.pinned = source.pinned
+	if err := r.load(source.location(), source.Content); err != nil {
+		return resolvedSchema{}, err
+	}
+	return r.resolved, r.expand()
+}
+
+// ResolveSchemaFile returns a schema with its includes and set references expanded, as a list of artifacts.
+func ResolveSchemaFile(location string) ([]byte, error) {
+	resolved, err := resolveSchemaFile(location)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.encode()
+}
+
+// encode returns the resolved schema as YAML.
+func (r resolvedSchema) encode() ([]byte, error) {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (r *schemaResolver) include(location string) error {
+	for _, including := range r.including {
+		if including == location {
+			return fmt.Errorf("%w: %s includes itself through %s", ErrSchemaInclude, location, strings.Join(r.including, " -> "))
+		}
+	}
+
+	if r.pinned && !r.fetcher.isPinned(location) {
+		return fmt.Errorf("%w: %s can change, the includes of a schema pinned with schema_sha256 or read from GitHub must be bundled schemas or files of a GitHub commit", ErrSchemaInclude, displayLocation(location))
+	}
+
+	content, err := r.fetcher.read(location)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaInclude, err)
+	}
+	return r.load(location, content)
+}
+
+func (r *schemaResolver) load(location string, content []byte) error {
+	r.including = append(r.including, location)
+	defer func() { r.including = r.including[:len(r.including)-1] }()
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		// errors of the included files name them
+		if len(r.including) == 1 {
+			return err
+		}
+		return fmt.Errorf("%s: %w", location, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	switch root.Kind {
+	case yaml.SequenceNode:
+		r.addArtifacts(location, root)
+		return nil
+	case yaml.MappingNode:
+	default:
+		return fmt.Errorf("%w: %s should be a list of artifacts or a map, at line %d", ErrSchemaDocument, displayLocation(location), root.Line)
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if key := root.Content[i]; !schemaDocumentKeys[key.Value] {
+			return fmt.Errorf("%w: unknown key '%s' in %s at line %d", ErrSchemaDocument, key.Value, displayLocation(location), key.Line)
+		}
+	}
+
+	if includes := mappingValue(root, "include"); includes != nil {
+		if includes.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%w: include should be a list in %s at line %d", ErrSchemaInclude, displayLocation(location), includes.Line)
+		}
+		for _, included := range includes.Content {
+			if err := r.include(includeLocation(location, included.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.defineVars(location, mappingValue(root, "vars")); err != nil {
+		return err
+	}
+	if err := r.defineSets(location, "os_sets", r.osSets, mappingValue(root, "os_sets")); err != nil {
+		return err
+	}
+	if err := r.defineSets(location, "arch_sets", r.archSets, mappingValue(root, "arch_sets")); err != nil {
+		return err
+	}
+	if err := r.defineArchMaps(location, mappingValue(root, "arch_maps")); err != nil {
+		return err
+	}
+
+	if artifacts := mappingValue(root, "artifacts"); artifacts != nil {
+		if artifacts.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%w: artifacts should be a list in %s at line %d", ErrSchemaDocument, displayLocation(location), artifacts.Line)
+		}
+		r.addArtifacts(location, artifacts)
+	}
+	return nil
+}
+
+func (r *schemaResolver) addArtifacts(location string, artifacts *yaml.Node) {
+	for _, artifact := range artifacts.Content {
+		r.resolved.files[artifact] = location
+	}
+	r.resolved.root.Content = append(r.resolved.root.Content, artifacts.Content...)
+}
+
+func (r *schemaResolver) defineSets(location, kind string, sets map[string]*yaml.Node, definitions *yaml.Node) error {
+	if definitions == nil {
+		return nil
+	}
+	if definitions.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: %s should be a map in %s at line %d", ErrSchemaSet, kind, displayLocation(location), definitions.Line)
+	}
+	for i := 0; i+1 < len(definitions.Content); i += 2 {
+		name, values := definitions.Content[i], definitions.Content[i+1]
+		if _, ok := sets[name.Value]; ok {
+			return fmt.Errorf("%w: %s '%s' defined twice, again in %s at line %d", ErrSchemaSet, kind, name.Value, displayLocation(location), name.Line)
+		}
+		if values.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%w: %s '%s' should be a list in %s at line %d", ErrSchemaSet, kind, name.Value, displayLocation(location), values.Line)
+		}
+		sets[name.Value] = values
+	}
+	return nil
+}
+
+func (r *schemaResolver) defineVars(location string, definitions *yaml.Node) error {
+	if definitions == nil {
+		return nil
+	}
+	if definitions.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: vars should be a map in %s at line %d", ErrSchemaVar, displayLocation(location), definitions.Line)
+	}
+	for i := 0; i+1 < len(definitions.Content); i += 2 {
+		name, value := definitions.Content[i], definitions.Content[i+1]
+		if err := validateVarName(location, name); err != nil {
+			return err
+		}
+		if _, ok := r.vars[name.Value]; ok {
+			return fmt.Errorf("%w: var '%s' defined twice, again in %s at line %d", ErrSchemaVar, name.Value, displayLocation(location), name.Line)
+		}
+		if value.Kind != yaml.ScalarNode {
+			return fmt.Errorf("%w: var '%s' should be a value in %s at line %d", ErrSchemaVar, name.Value, displayLocation(location), value.Line)
+		}
+		r.vars[name.Value] = value.Value
+	}
+	return nil
+}
+
+// validateVarName checks vars are lowercase identifiers not hiding the built-in placeholders.
+func validateVarName(location string, name *yaml.Node) error {
+	if !varNameRegex.MatchString(name.Value) {
+		return fmt.Errorf("%w: var name '%s' should be lowercase letters, digits and _ in %s at line %d", ErrSchemaVar, name.Value, displayLocation(location), name.Line)
+	}
+	placeholder := "{" + name.Value + "}"
+	if contains(destPlaceholders, placeholder) || placeholder == utils.PlaceholderForAccessPointHost {
+		return fmt.Errorf("%w: var '%s' replaces the %s placeholder in %s at line %d", ErrSchemaVar, name.Value, placeholder, displayLocation(location), name.Line)
+	}
+	return nil
+}
+
+func (r *schemaResolver) defineArchMaps(location string, definitions *yaml.Node) error {
+	if definitions == nil {
+		return nil
+	}
+	if definitions.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: arch_maps should be a map in %s at line %d", ErrInvalidArchMap, displayLocation(location), definitions.Line)
+	}
+	for i := 0; i+1 < len(definitions.Content); i += 2 {
+		uploadType, archMap := definitions.Content[i], definitions.Content[i+1]
+		if err := validateType(uploadType.Value); err != nil {
+			return fmt.Errorf("%w: %v in %s at line %d", ErrInvalidArchMap, err, displayLocation(location), uploadType.Line)
+		}
+		if _, ok := r.archMaps[uploadType.Value]; ok {
+			return fmt.Errorf("%w: arch_maps '%s' defined twice, again in %s at line %d", ErrInvalidArchMap, uploadType.Value, displayLocation(location), uploadType.Line)
+		}
+		if archMap.Kind != yaml.MappingNode {
+			return fmt.Errorf("%w: arch_maps '%s' should be a map in %s at line %d", ErrInvalidArchMap, uploadType.Value, displayLocation(location), archMap.Line)
+		}
+		r.archMaps[uploadType.Value] = archMap
+	}
+	return nil
+}
+
+// expand replaces the set references of the artifacts arch and uploads os_version by the set values, adds
+// the arch_maps to the uploads and replaces the vars, repeating the artifacts defining them.
+func (r *schemaResolver) expand() error {
+	if err := r.expandVars(); err != nil {
+		return err
+	}
+	for _, artifact := range r.resolved.root.Content {
+		if artifact.Kind != yaml.MappingNode {
+			continue
+		}
+		location := displayLocation(r.resolved.files[artifact])
+		if err := expandSetReferences(location, artifact, "arch", "arch_sets", r.archSets); err != nil {
+			return err
+		}
+		uploads := mappingValue(artifact, "uploads")
+		if uploads == nil || uploads.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, upload := range uploads.Content {
+			if upload.Kind != yaml.MappingNode {
+				continue
+			}
+			if err := expandSetReferences(location, upload, "os_version", "os_sets", r.osSets); err != nil {
+				return err
+			}
+			if uploadType := mappingValue(upload, "type"); uploadType != nil && r.archMaps[uploadType.Value] != nil {
+				mergeArchMap(upload, r.archMaps[uploadType.Value])
+			}
+		}
+	}
+	return nil
+}
+
+// expandVars repeats the artifacts for each combination of their vars, replacing them with the schema ones.
+func (r *schemaResolver) expandVars() error {
+	var artifacts []*yaml.Node
+	for _, artifact := range r.resolved.root.Content {
+		location := r.resolved.files[artifact]
+		combinations, err := r.varCombinations(location, artifact)
+		if err != nil {
+			return err
+		}
+		for _, vars := range combinations {
+			expanded := artifact
+			if len(vars) > 0 {
+				expanded = replaceVars(artifact, vars)
+				r.resolved.files[expanded] = location
+			}
+			removeKey(expanded, "vars")
+			artifacts = append(artifacts, expanded)
+		}
+	}
+	r.resolved.root.Content = artifacts
+	return nil
+}
+
+// varCombinations returns the values of the vars for each repetition of the artifact, in the order of the
+// vars, the first one changing slower.
+func (r *schemaResolver) varCombinations(location string, artifact *yaml.Node) ([]map[string]string, error) {
+	combinations := []map[string]string{copyVars(r.vars)}
+	if artifact.Kind != yaml.MappingNode {
+		return combinations, nil
+	}
+	vars := mappingValue(artifact, "vars")
+	if vars == nil {
+		return combinations, nil
+	}
+	if vars.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: vars should be a map in %s at line %d", ErrSchemaVar, displayLocation(location), vars.Line)
+	}
+
+	for i := 0; i+1 < len(vars.Content); i += 2 {
+		name, values := vars.Content[i], vars.Content[i+1]
+		if err := validateVarName(location, name); err != nil {
+			return nil, err
+		}
+		valueNodes := []*yaml.Node{values}
+		if values.Kind == yaml.SequenceNode {
+			valueNodes = values.Content
+		}
+		if len(valueNodes) == 0 || values.Kind == yaml.MappingNode {
+			return nil, fmt.Errorf("%w: var '%s' should be a list of values in %s at line %d", ErrSchemaVar, name.Value, displayLocation(location), values.Line)
+		}
+
+		var next []map[string]string
+		for _, combination := range combinations {
+			for _, value := range valueNodes {
+				if value.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("%w: var '%s' should be a list of values in %s at line %d", ErrSchemaVar, name.Value, displayLocation(location), value.Line)
+				}
+				vars := copyVars(combination)
+				vars[name.Value] = value.Value
+				next = append(next, vars)
+			}
+		}
+		combinations = next
+	}
+	return combinations, nil
+}
+
+func copyVars(vars map[string]string) map[string]string {
+	copied := make(map[string]string, len(vars))
+	for name, value := range vars {
+		copied[name] = value
+	}
+	return copied
+}
+
+// replaceVars returns a copy of the node with the vars replaced in its values.
+func replaceVars(n *yaml.Node, vars map[string]string) *yaml.Node {
+	copied := *n
+	if n.Kind == yaml.ScalarNode {
+		copied.Value = utils.ReplaceVars(copied.Value, vars)
+		return &copied
+	}
+
+	copied.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		if n.Kind == yaml.MappingNode && i%2 == 0 {
+			// keys are kept
+			copied.Content[i] = child
+			continue
+		}
+		copied.Content[i] = replaceVars(child, vars)
+	}
+	return &copied
+}
+
+func removeKey(mapping *yaml.Node, key string) {
+	if mapping.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// expandSetReferences expands the references of a key holding a list or a single reference.
+func expandSetReferences(location string, mapping *yaml.Node, key, kind string, sets map[string]*yaml.Node) error {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+
+		value := mapping.Content[i+1]
+		values := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			values = value.Content
+		} else if !isSetReference(value) {
+			return nil
+		}
+
+		expanded := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: value.Style, Line: value.Line, Column: value.Column}
+		for _, item := range values {
+			if !isSetReference(item) {
+				expanded.Content = append(expanded.Content, item)
+				continue
+			}
+			set, ok := sets[strings.TrimPrefix(item.Value, setReferencePrefix)]
+			if !ok {
+				return fmt.Errorf("%w: unknown %s reference %s in %s at line %d", ErrSchemaSet, kind, item.Value, location, item.Line)
+			}
+			expanded.Content = append(expanded.Content, set.Content...)
+		}
+		mapping.Content[i+1] = expanded
+	}
+	return nil
+}
+
+// mergeArchMap adds the arch names of an arch_maps entry the upload arch_map doesn't have.
+func mergeArchMap(upload, archMap *yaml.Node) {
+	uploadMap := mappingValue(upload, "arch_map")
+	if uploadMap == nil {
+		uploadMap = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: archMap.Style}
+		upload.Content = append(upload.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "arch_map"}, uploadMap)
+	}
+	if uploadMap.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(archMap.Content); i += 2 {
+		if mappingValue(uploadMap, archMap.Content[i].Value) == nil {
+			uploadMap.Content = append(uploadMap.Content, archMap.Content[i], archMap.Content[i+1])
+		}
+	}
+}
+
+func isSetReference(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && strings.HasPrefix(n.Value, setReferencePrefix)
+}
+
+// includeLocation resolves an include relative to the including schema.
+func includeLocation(including, included string) string {
+	if isURL(included) || isGithubReference(included) || registry.IsLocation(included) || filepath.IsAbs(included) || including == "" {
+		return included
+	}
+	if registry.IsLocation(including) {
+		return registry.IncludeLocation(including, included)
+	}
+	if isURL(including) {
+		base, err := url.Parse(including)
+		if err != nil {
+			return included
+		}
+		ref, err := url.Parse(included)
+		if err != nil {
+			return included
+		}
+		return base.ResolveReference(ref).String()
+	}
+	return filepath.Join(filepath.Dir(including), included)
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+func displayLocation(location string) string {
+	if location == "" {
+		return "the schema"
+	}
+	return location
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	schemaSets = `
+os_sets:
+  el: [7, 8]
+arch_sets:
+  linux: [amd64, arm64]
+artifacts:
+  - src: "{app_name}-tools.tar.gz"
+    uploads:
+      - type: file
+        dest: "/tools/{src}"
+`
+	schemaDocument = `
+include:
+  - include/sets.yml
+artifacts:
+  - src: "{app_name}-{version}.{arch}.rpm"
+    arch: $linux
+    uploads:
+      - type: yum
+        dest: "/yum/el/{os_version}/{arch}/"
+        os_version: [6, $el, 9]
+`
+)
+
+func writeSchemaFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestParseUploadSchemasFile_document(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"schema.yml":       schemaDocument,
+		"include/sets.yml": schemaSets,
+	})
+
+	schemas, err := ParseUploadSchemasFile(filepath.Join(dir, "schema.yml"), true)
+	require.NoError(t, err)
+
+	expected := UploadArtifactSchemas{
+		{Src: "{app_name}-tools.tar.gz", Arch: []string{""}, Uploads: []Upload{{Type: TypeFile, Dest: "/tools/{src}"}}},
+		{Src: "{app_name}-{version}.{arch}.rpm", Arch: []string{"amd64", "arm64"}, Uploads: []Upload{
+			{Type: TypeYum, Dest: "/yum/el/{os_version}/{arch}/", OsVersion: []string{"6", "7", "8", "9"}},
+		}},
+	}
+	assert.Equal(t, expected, schemas)
+}
+
+func TestParseUploadSchemasFile_includeURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schemas/schema.yml":
+			w.Write([]byte(schemaDocument))
+		case "/schemas/include/sets.yml":
+			w.Write([]byte(schemaSets))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	schemas, err := ParseUploadSchemasFile(server.URL+"/schemas/schema.yml", true)
+	require.NoError(t, err)
+	assert.Len(t, schemas, 2)
+	assert.Equal(t, []string{"6", "7", "8", "9"}, schemas[1].Uploads[0].OsVersion)
+}
+
+func TestParseUploadSchemasFile_resolveErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected error
+		message  string
+	}{
+		{
+			name:     "unknown reference",
+			files:    map[string]string{"schema.yml": "artifacts:\n  - src: foo\n    arch: $linux\n"},
+			expected: ErrSchemaSet,
+			message:  "unknown arch_sets reference $linux in {dir}/schema.yml at line 3",
+		},
+		{
+			name:     "os set used as arch",
+			files:    map[string]string{"schema.yml": "os_sets:\n  el: [7]\nartifacts:\n  - src: foo\n    arch: [$el]\n"},
+			expected: ErrSchemaSet,
+			message:  "unknown arch_sets reference $el",
+		},
+		{
+			name: "set defined twice",
+			files: map[string]string{
+				"schema.yml":       "include: [include/sets.yml]\nos_sets:\n  el: [9]\n",
+				"include/sets.yml": schemaSets,
+			},
+			expected: ErrSchemaSet,
+			message:  "os_sets 'el' defined twice, again in {dir}/schema.yml at line 3",
+		},
+		{
+			name:     "missing include",
+			files:    map[string]string{"schema.yml": "include: [missing.yml]\n"},
+			expected: ErrSchemaInclude,
+			message:  "missing.yml: no such file or directory",
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"schema.yml": "include: [other.yml]\n",
+				"other.yml":  "include: [schema.yml]\n",
+			},
+			expected: ErrSchemaInclude,
+			message:  "includes itself",
+		},
+		{
+			name:     "arch_maps of unknown type",
+			files:    map[string]string{"schema.yml": "arch_maps:\n  deb:\n    arm: armhf\n"},
+			expected: ErrInvalidArchMap,
+			message:  "invalid upload type: 'deb' (valid types: file, zypp, yum, apt) in {dir}/schema.yml at line 2",
+		},
+		{
+			name: "arch_maps defined twice",
+			files: map[string]string{
+				"schema.yml":       "include: [include/maps.yml]\narch_maps:\n  apt:\n    arm: armel\n",
+				"include/maps.yml": "arch_maps:\n  apt:\n    arm: armhf\n",
+			},
+			expected: ErrInvalidArchMap,
+			message:  "arch_maps 'apt' defined twice, again in {dir}/schema.yml at line 3",
+		},
+		{
+			name:     "var hiding a placeholder",
+			files:    map[string]string{"schema.yml": "vars:\n  version: 1.0\n"},
+			expected: ErrSchemaVar,
+			message:  "var 'version' replaces the {version} placeholder in {dir}/schema.yml at line 2",
+		},
+		{
+			name:     "invalid var name",
+			files:    map[string]string{"schema.yml": "artifacts:\n  - src: foo\n    vars:\n      Flavor: [systemd]\n"},
+			expected: ErrSchemaVar,
+			message:  "var name 'Flavor' should be lowercase letters, digits and _ in {dir}/schema.yml at line 4",
+		},
+		{
+			name:     "empty var",
+			files:    map[string]string{"schema.yml": "artifacts:\n  - src: foo\n    vars:\n      flavor: []\n"},
+			expected: ErrSchemaVar,
+			message:  "var 'flavor' should be a list of values in {dir}/schema.yml at line 4",
+		},
+		{
+			name:     "unknown document key",
+			files:    map[string]string{"schema.yml": "os_set:\n  el: [9]\n"},
+			expected: ErrSchemaDocument,
+			message:  "unknown key 'os_set' in {dir}/schema.yml at line 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeSchemaFiles(t, tt.files)
+			_, err := ParseUploadSchemasFile(filepath.Join(dir, "schema.yml"), true)
+			assert.ErrorIs(t, err, tt.expected)
+			if err != nil {
+				assert.Contains(t, err.Error(), strings.ReplaceAll(tt.message, "{dir}", dir))
+			}
+		})
+	}
+}
+
+func TestResolveSchemaFile(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"schema.yml":       schemaDocument,
+		"include/sets.yml": schemaSets,
+	})
+
+	resolved, err := ResolveSchemaFile(filepath.Join(dir, "schema.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, `- src: "{app_name}-tools.tar.gz"
+  uploads:
+    - type: file
+      dest: "/tools/{src}"
+- src: "{app_name}-{version}.{arch}.rpm"
+  arch:
+    - amd64
+    - arm64
+  uploads:
+    - type: yum
+      dest: "/yum/el/{os_version}/{arch}/"
+      os_version: [6, 7, 8, 9]
+`, string(resolved))
+}
+
+func TestParseUploadSchemasFile_archMaps(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{"schema.yml": `
+arch_maps:
+  apt:
+    arm: armhf
+    arm64: arm64
+artifacts:
+  - src: "{app_name}_{version}_{arch}.deb"
+    arch: [arm, arm64]
+    uploads:
+      - type: apt
+        dest: "/apt/{dest_arch}/"
+        os_version: [noble]
+        arch_map:
+          arm64: aarch64
+      - type: file
+        dest: "/files/{dest_arch}/{src}"
+`})
+
+	schemas, err := ParseUploadSchemasFile(filepath.Join(dir, "schema.yml"), true)
+	require.NoError(t, err)
+	require.Len(t, schemas, 1)
+	assert.Equal(t, map[string]string{"arm": "armhf", "arm64": "aarch64"}, schemas[0].Uploads[0].ArchMap)
+	assert.Nil(t, schemas[0].Uploads[1].ArchMap)
+}
+
+func TestResolveSchemaFile_vars(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{"schema.yml": `
+vars:
+  channel: stable
+artifacts:
+  - src: "{app_name}_{flavor}_{version}_{arch}.deb"
+    arch: [amd64]
+    vars:
+      flavor: [systemd, upstart]
+      fips: ["", "-fips"]
+    uploads:
+      - type: file
+        dest: "/{channel}/{flavor}{fips}/{src}"
+  - src: "{app_name}.zip"
+    uploads:
+      - type: file
+        dest: "/{channel}/{src}"
+`})
+
+	resolved, err := ResolveSchemaFile(filepath.Join(dir, "schema.yml"))
+	require.NoError(t, err)
+
+	var dests []string
+	for _, line := range strings.Split(string(resolved), "\n") {
+		if strings.Contains(line, "dest:") {
+			dests = append(dests, strings.TrimSpace(line))
+		}
+	}
+	expected := []string{
+		`dest: "/stable/systemd/{src}"`,
+		`dest: "/stable/systemd-fips/{src}"`,
+		`dest: "/stable/upstart/{src}"`,
+		`dest: "/stable/upstart-fips/{src}"`,
+		`dest: "/stable/{src}"`,
+	}
+	assert.Equal(t, expected, dests)
+	assert.NotContains(t, string(resolved), "vars")
+
+	schemas, err := ParseUploadSchemasFile(filepath.Join(dir, "schema.yml"), true)
+	require.NoError(t, err)
+	require.Len(t, schemas, 5)
+	assert.Equal(t, "{app_name}_upstart_{version}_{arch}.deb", schemas[2].Src)
+}
@@ -4,8 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
+	"gopkg.in/yaml.v3"
+	"reflect"
 	"strings"
 )
 
@@ -17,6 +17,10 @@ const (
 	TypeZypp = "zypp"
 	TypeYum  = "yum"
 	TypeApt  = "apt"
+
+	// UnknownFieldsError and UnknownFieldsWarn are the ways of handling unknown keys in the schema
+	UnknownFieldsError = "error"
+	UnknownFieldsWarn  = "warn"
 )
 
 var fileTypes = []string{TypeFile, TypeZypp, TypeYum, TypeApt}
@@ -25,51 +29,131 @@ var fileTypes = []string{TypeFile, TypeZypp, TypeYum, TypeApt}
 var (
 	ErrInvalidAppName = errors.New("invalid app name")
 	ErrInvalidType    = errors.New("invalid upload type")
+	ErrUnknownField   = errors.New("unknown key")
 )
 
+// UploadArtifactSchema describes an artifact and where it's published. The description tags document the
+// fields in the generated JSON Schema.
 type UploadArtifactSchema struct {
-	Src     string   `yaml:"src"`
-	Arch    []string `yaml:"arch"`
-	Uploads []Upload `yaml:"uploads"`
+	Src     string       `yaml:"src" description:"Release asset file name, expanded for every arch"`
+	Arch    []string     `yaml:"arch" description:"Architectures of the artifact, replacing {arch}"`
+	Uploads []Upload     `yaml:"uploads" description:"Destinations of the artifact"`
+	Exclude []MatrixRule `yaml:"exclude" description:"Combinations of arch and os_version not published"`
+	Include []MatrixRule `yaml:"include" description:"Combinations of arch and os_version published besides the arch and os_version lists"`
 }
 
 type Upload struct {
-	Type      string   `yaml:"type"` // verify type in allowed list file, apt, yum, zypp
-	SrcRepo   string   `yaml:"src_repo"`
-	Dest      string   `yaml:"dest"`
-	Override  bool     `yaml:"override"`
-	OsVersion []string `yaml:"os_version"`
+	Type       string            `yaml:"type" description:"Kind of destination"` // verify type in allowed list file, apt, yum, zypp
+	SrcRepo    string            `yaml:"src_repo" description:"Url of the published repository, mirrored before adding the package"`
+	Dest       string            `yaml:"dest" description:"Destination path in the bucket"`
+	Override   bool              `yaml:"override" description:"Replace the destination file when it already exists"`
+	OsVersion  []string          `yaml:"os_version" description:"Versions of the OS the package is published for, replacing {os_version}"`
+	ArchMap    map[string]string `yaml:"arch_map" description:"Arch names used in the destination, replacing {dest_arch}"`
+	Prerelease *PrereleaseUpload `yaml:"prerelease" description:"Overrides for prerelease tags"`
+}
+
+// PrereleaseUpload overrides an upload when the tag has semver prerelease identifiers (i.e. v1.2.0-rc.1),
+// routing it to a different destination and source repo, or skipping it.
+type PrereleaseUpload struct {
+	Skip    bool   `yaml:"skip" description:"Don't publish the upload for prereleases"`
+	Dest    string `yaml:"dest" description:"Destination path in the bucket for prereleases"`
+	SrcRepo string `yaml:"src_repo" description:"Url of the published repository for prereleases"`
 }
 
 type UploadArtifactSchemas []UploadArtifactSchema
 
+// ForRelease resolves the uploads for the kind of release. For prereleases the prerelease overrides are
+// applied, uploads skipping prereleases are dropped, and so are schema entries left without uploads.
+func (s UploadArtifactSchemas) ForRelease(prerelease bool) UploadArtifactSchemas {
+	var resolved UploadArtifactSchemas
+	for _, schema := range s {
+		var uploads []Upload
+		for _, upload := range schema.Uploads {
+			override := upload.Prerelease
+			upload.Prerelease = nil
+			if prerelease && override != nil {
+				if override.Skip {
+					continue
+				}
+				if override.Dest != "" {
+					upload.Dest = override.Dest
+				}
+				if override.SrcRepo != "" {
+					upload.SrcRepo = override.SrcRepo
+				}
+			}
+			uploads = append(uploads, upload)
+		}
+
+		if len(uploads) > 0 {
+			schema.Uploads = uploads
+			resolved = append(resolved, schema)
+		}
+	}
+	return resolved
+}
+
 // ParseUploadSchemasFile reads content of a file and marshal it into yaml
-// config struct
-func ParseUploadSchemasFile(cfgPath string) (UploadArtifactSchemas, error) {
+// config struct. Includes and set references are resolved, see schemaResolver. Unknown keys, usually typos,
+// fail the parsing when strict, otherwise they are logged.
+func ParseUploadSchemasFile(cfgPath string, strict bool) (UploadArtifactSchemas, error) {
 
-	uploadSchemaContent, err := ioutil.ReadFile(cfgPath)
+	source, err := defaultSchemaFetcher.Fetch(cfgPath, "")
 	if err != nil {
 		return nil, err
 	}
 
-	uploadSchemas, err := parseUploadSchema(uploadSchemaContent)
+	uploadSchemas, _, err := defaultSchemaFetcher.ParseUploadSchemas(source, strict)
+	return uploadSchemas, err
+}
+
+// ParseUploadSchemas parses a fetched schema like ParseUploadSchemasFile, reading its includes with the fetcher. It
+// returns as well the sha256 of the resolved schema, as printed by `schema resolve`, which unlike the one of the
+// schema file changes with its includes.
+func (f *SchemaFetcher) ParseUploadSchemas(source SchemaSource, strict bool) (UploadArtifactSchemas, string, error) {
+	resolved, err := f.resolve(source)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	uploadSchemas, err := decodeUploadSchema(resolved, strict)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return uploadSchemas, nil
+	content, err := resolved.encode()
+	if err != nil {
+		return nil, "", err
+	}
+	return uploadSchemas, contentSHA256(content), nil
 }
 
-func parseUploadSchema(fileContent []byte) (UploadArtifactSchemas, error) {
+func parseUploadSchema(fileContent []byte, strict bool) (UploadArtifactSchemas, error) {
+	resolved, err := resolveSchema("", fileContent)
+	if err != nil {
+		return nil, err
+	}
+	return decodeUploadSchema(resolved, strict)
+}
+
+func decodeUploadSchema(resolved resolvedSchema, strict bool) (UploadArtifactSchemas, error) {
 
 	var schema UploadArtifactSchemas
 
-	err := yaml.Unmarshal(fileContent, &schema)
+	err := resolved.root.Decode(&schema)
 
 	if err != nil {
 		return nil, err
 	}
 
+	unknownErrs := unknownFields(resolved.root)
+	if strict && len(unknownErrs) > 0 {
+		return nil, errors.Join(unknownErrs...)
+	}
+	for _, unknownErr := range unknownErrs {
+		utils.Logger.Warn(unknownErr.Error())
+	}
+
 	for i := range schema {
 		if schema[i].Arch == nil {
 			schema[i].Arch = []string{""}
@@ -77,6 +161,14 @@ func parseUploadSchema(fileContent []byte) (UploadArtifactSchemas, error) {
 		if len(schema[i].Uploads) == 0 {
 			return nil, fmt.Errorf("error: '%s' in the schema: %v ", noDestinationError, schema[i].Src)
 		}
+		if err := validateMatrix(schema[i]); err != nil {
+			return nil, fmt.Errorf("%w in schema entry '%s'", err, schema[i].Src)
+		}
+		for _, upload := range schema[i].Uploads {
+			if err := validateArchMap(upload); err != nil {
+				return nil, fmt.Errorf("%w in schema entry '%s'", err, schema[i].Src)
+			}
+		}
 	}
 
 	return schema, nil
@@ -124,3 +216,139 @@ func validateName(appName string, src string) error {
 	}
 	return nil
 }
+
+var (
+	schemaKeys           = yamlKeys(UploadArtifactSchema{})
+	uploadKeys           = yamlKeys(Upload{})
+	prereleaseUploadKeys = yamlKeys(PrereleaseUpload{})
+	matrixRuleKeys       = yamlKeys(MatrixRule{})
+)
+
+// unknownKey is a key of the schema not matching a field, with where it was found and the valid keys there.
+type unknownKey struct {
+	key   *yaml.Node
+	where string
+	known map[string]bool
+}
+
+func (k unknownKey) suggestion() string {
+	return closestKey(k.key.Value, k.known)
+}
+
+// unknownFields returns an error for every key of the schema not matching a field.
+func unknownFields(root *yaml.Node) []error {
+	var errs []error
+	for _, unknown := range unknownKeys(root) {
+		err := fmt.Errorf("%w '%s' in %s at line %d", ErrUnknownField, unknown.key.Value, unknown.where, unknown.key.Line)
+		if suggestion := unknown.suggestion(); suggestion != "" {
+			err = fmt.Errorf("%w, did you mean '%s'?", err, suggestion)
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// unknownKeys returns the keys of the schema entries, matrix rules, uploads and prerelease uploads not matching a
+// field. Nodes of unexpected kinds are skipped, they are reported by the decoding.
+func unknownKeys(root *yaml.Node) []unknownKey {
+	var unknown []unknownKey
+	check := func(mapping *yaml.Node, known map[string]bool, where string) {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if key := mapping.Content[i]; !known[key.Value] {
+				unknown = append(unknown, unknownKey{key: key, where: where, known: known})
+			}
+		}
+	}
+
+	if root.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, entry := range root.Content {
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+		src := ""
+		if srcNode := mappingValue(entry, "src"); srcNode != nil {
+			src = srcNode.Value
+		}
+		check(entry, schemaKeys, "schema entry")
+		for _, rules := range []string{"exclude", "include"} {
+			if ruleList := mappingValue(entry, rules); ruleList != nil && ruleList.Kind == yaml.SequenceNode {
+				for _, rule := range ruleList.Content {
+					if rule.Kind == yaml.MappingNode {
+						check(rule, matrixRuleKeys, fmt.Sprintf("%s of schema entry '%s'", rules, src))
+					}
+				}
+			}
+		}
+		uploads := mappingValue(entry, "uploads")
+		if uploads == nil || uploads.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, upload := range uploads.Content {
+			if upload.Kind != yaml.MappingNode {
+				continue
+			}
+			check(upload, uploadKeys, fmt.Sprintf("upload of schema entry '%s'", src))
+			if prerelease := mappingValue(upload, "prerelease"); prerelease != nil && prerelease.Kind == yaml.MappingNode {
+				check(prerelease, prereleaseUploadKeys, fmt.Sprintf("prerelease upload of schema entry '%s'", src))
+			}
+		}
+	}
+	return unknown
+}
+
+// closestKey returns the known key at most two edits away from key, suggesting a fix for typos.
+func closestKey(key string, known map[string]bool) string {
+	closest, closestDistance := "", 3
+	for candidate := range known {
+		if d := editDistance(key, candidate); d < closestDistance || d == closestDistance && candidate < closest {
+			closest, closestDistance = candidate, d
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// mappingValue returns the value node of a key in a mapping node, or nil when the key is not present.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlKeys returns the keys of the yaml tags of a struct.
+func yamlKeys(v interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
@@ -56,13 +56,13 @@ func TestParseSchema(t *testing.T) {
 		output []UploadArtifactSchema
 	}{
 		"multiple entries": {schemaValidMultipleEntries, []UploadArtifactSchema{
-			{"foo.tar.gz", []string{"amd64", "386"}, []Upload{
+			{Src: "foo.tar.gz", Arch: []string{"amd64", "386"}, Uploads: []Upload{
 				{
 					Type: "file",
 					Dest: "/tmp",
 				},
 			}},
-			{"{integration_name}_linux_{version}_{arch}.tar.gz", []string{"ppc"}, []Upload{
+			{Src: "{integration_name}_linux_{version}_{arch}.tar.gz", Arch: []string{"ppc"}, Uploads: []Upload{
 				{
 					Type: "file",
 					Dest: "infrastructure_agent/binaries/linux/{arch}/",
@@ -70,7 +70,7 @@ func TestParseSchema(t *testing.T) {
 			}},
 		}},
 		"src is omitted": {schemaNoSrc, []UploadArtifactSchema{
-			{"", []string{"amd64"}, []Upload{
+			{Src: "", Arch: []string{"amd64"}, Uploads: []Upload{
 				{
 					Type: "file",
 					Dest: "/tmp",
@@ -78,7 +78,7 @@ func TestParseSchema(t *testing.T) {
 			}},
 		}},
 		"arch is omitted": {schemaNoArch, []UploadArtifactSchema{
-			{"foo.tar.gz", []string{""}, []Upload{
+			{Src: "foo.tar.gz", Arch: []string{""}, Uploads: []Upload{
 				{
 					Type: "file",
 					Dest: "/tmp",
@@ -90,7 +90,7 @@ func TestParseSchema(t *testing.T) {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			schema, err := parseUploadSchema([]byte(tt.schema))
+			schema, err := parseUploadSchema([]byte(tt.schema), true)
 			assert.NoError(t, err)
 			assert.EqualValues(t, tt.output, schema)
 		})
@@ -108,7 +108,7 @@ func TestParseConfigError(t *testing.T) {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			schema, err := parseUploadSchema([]byte(tt))
+			schema, err := parseUploadSchema([]byte(tt), true)
 			assert.Error(t, err)
 			assert.Nil(t, schema)
 		})
@@ -122,9 +122,9 @@ func TestSchema(t *testing.T) {
 		expectedError error
 	}{
 		{"e2e", "../../schemas/e2e.yml", nil},
-		{"nrjmx", "../../schemas/nrjmx.yml", nil},
-		{"ohi", "../../schemas/ohi.yml", nil},
-		{"ohi-jmx", "../../schemas/ohi-jmx.yml", nil},
+		{"nrjmx", "builtin://nrjmx/1.yml", nil},
+		{"ohi", "builtin://ohi/1.yml", nil},
+		{"ohi-jmx", "builtin://ohi-jmx/1.yml", nil},
 		{"invalid yaml schema", "../../test/schemas/bad-formatted-yaml.yml", errors.New("yaml: line 27: mapping values are not allowed in this context")},
 	}
 
@@ -132,7 +132,7 @@ func TestSchema(t *testing.T) {
 		tt := tests[i]
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			uploadSchema, err := ParseUploadSchemasFile(tt.schemaPath)
+			uploadSchema, err := ParseUploadSchemasFile(tt.schemaPath, true)
 			assert.Equal(t, tt.expectedError, err)
 			log.Println(uploadSchema)
 		})
@@ -213,3 +213,91 @@ func Test_ValidateName(t *testing.T) {
 		})
 	}
 }
+
+func TestForRelease(t *testing.T) {
+	schemas, err := parseUploadSchema([]byte(`
+- src: "{app_name}_{version}_{arch}.deb"
+  arch:
+    - amd64
+  uploads:
+    - type: apt
+      src_repo: "{access_point_host}/infrastructure_agent/linux/apt"
+      dest: "{dest_prefix}linux/apt/"
+      os_version:
+        - jammy
+      prerelease:
+        src_repo: "{access_point_host}/infrastructure_agent/linux/apt-testing"
+        dest: "{dest_prefix}linux/apt-testing/"
+- src: "{app_name}-amd64.{version}.msi"
+  uploads:
+    - type: file
+      dest: "{dest_prefix}windows/{src}"
+      prerelease:
+        dest: "{dest_prefix}windows/testing/{src}"
+    - type: file
+      override: true
+      dest: "{dest_prefix}windows/{app_name}-amd64.msi"
+      prerelease:
+        skip: true
+- src: "{app_name}-latest.txt"
+  uploads:
+    - type: file
+      dest: "{dest_prefix}latest/{src}"
+      prerelease:
+        skip: true
+`), true)
+	assert.NoError(t, err)
+
+	t.Run("stable", func(t *testing.T) {
+		expected := UploadArtifactSchemas{
+			{Src: "{app_name}_{version}_{arch}.deb", Arch: []string{"amd64"}, Uploads: []Upload{
+				{Type: TypeApt, SrcRepo: "{access_point_host}/infrastructure_agent/linux/apt", Dest: "{dest_prefix}linux/apt/", OsVersion: []string{"jammy"}},
+			}},
+			{Src: "{app_name}-amd64.{version}.msi", Arch: []string{""}, Uploads: []Upload{
+				{Type: TypeFile, Dest: "{dest_prefix}windows/{src}"},
+				{Type: TypeFile, Override: true, Dest: "{dest_prefix}windows/{app_name}-amd64.msi"},
+			}},
+			{Src: "{app_name}-latest.txt", Arch: []string{""}, Uploads: []Upload{
+				{Type: TypeFile, Dest: "{dest_prefix}latest/{src}"},
+			}},
+		}
+		assert.Equal(t, expected, schemas.ForRelease(false))
+	})
+
+	t.Run("prerelease", func(t *testing.T) {
+		expected := UploadArtifactSchemas{
+			{Src: "{app_name}_{version}_{arch}.deb", Arch: []string{"amd64"}, Uploads: []Upload{
+				{Type: TypeApt, SrcRepo: "{access_point_host}/infrastructure_agent/linux/apt-testing", Dest: "{dest_prefix}linux/apt-testing/", OsVersion: []string{"jammy"}},
+			}},
+			{Src: "{app_name}-amd64.{version}.msi", Arch: []string{""}, Uploads: []Upload{
+				{Type: TypeFile, Dest: "{dest_prefix}windows/testing/{src}"},
+			}},
+		}
+		assert.Equal(t, expected, schemas.ForRelease(true))
+	})
+}
+
+func TestParseSchema_unknownFields(t *testing.T) {
+	schema := []byte(`
+- src: foo.msi
+  uploads:
+    - type: file
+      overide: true
+      dest: /windows/foo.msi
+      os_versions:
+        - 1
+`)
+
+	t.Run("strict", func(t *testing.T) {
+		_, err := parseUploadSchema(schema, true)
+		assert.ErrorIs(t, err, ErrUnknownField)
+		assert.EqualError(t, err, "unknown key 'overide' in upload of schema entry 'foo.msi' at line 5, did you mean 'override'?\n"+
+			"unknown key 'os_versions' in upload of schema entry 'foo.msi' at line 7, did you mean 'os_version'?")
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		schemas, err := parseUploadSchema(schema, false)
+		assert.NoError(t, err)
+		assert.Equal(t, UploadArtifactSchemas{{Src: "foo.msi", Arch: []string{""}, Uploads: []Upload{{Type: TypeFile, Dest: "/windows/foo.msi"}}}}, schemas)
+	})
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// configFileFlag and configFileEnv point to a YAML or TOML file holding any of the settings.
+	configFileFlag = "config"
+	configFileEnv  = "CONFIG_FILE"
+
+	maskedValue = "********"
+)
+
+const (
+	settingTypeString = iota
+	settingTypeBool
+	settingTypeUint
+)
+
+// setting is a configuration key. It can be provided as a command-line flag (--app-name), an environment
+// variable (APP_NAME) or a key in the config file (app_name).
+type setting struct {
+	key       string
+	usage     string
+	valueType int
+	secret    bool
+}
+
+func (s setting) flagName() string {
+	return strings.Replace(s.key, "_", "-", -1)
+}
+
+func (s setting) envName() string {
+	return strings.ToUpper(s.key)
+}
+
+var settings = []setting{
+	{key: "repo_name", usage: "combination of organization and repository (i.e. newrelic/nri-redis)"},
+	{key: "app_name", usage: "name of the package (i.e. nri-redis)"},
+	{key: "app_version", usage: "version of the package, extracted from the tag when empty"},
+	{key: "tag", usage: "tag pointing to the release"},
+	{key: "access_point_host", usage: "http host to use in apt mirrors and .repo files (production, staging, testing or a url)"},
+	{key: "run_id", usage: "action run identifier"},
+	{key: "artifacts_dest_folder", usage: "folder where the s3 bucket is mounted"},
+	{key: "artifacts_src_folder", usage: "folder where the artifacts are downloaded"},
+	{key: "aptly_folder", usage: "aptly root folder"},
+	{key: "upload_schema_file_path", usage: "path to the schema describing the packages to be published, overriding schema"},
+	{key: "schema_url", usage: "url to a custom schema file"},
+	{key: "schema_path", usage: "path to a custom-local schema file"},
+	{key: "schema_sha256", usage: "expected sha256 of the schema file, failing the publishing when it differs"},
+	{key: "schema_cache_dir", usage: "folder caching the downloaded schema files by checksum"},
+	{key: "github_token", usage: "token resolving github:// schema references of private repositories", secret: true},
+	{key: "schema", usage: "name of the schema describing the packages to be published (i.e. ohi, ohi@2, custom or custom-local)"},
+	{key: "schema_unknown_fields", usage: "handling of unknown keys in the schema, error or warn (default error)"},
+	{key: "dest_prefix", usage: "s3 path prefix"},
+	{key: "gpg_passphrase", usage: "passphrase for the gpg key", secret: true},
+	{key: "gpg_key_ring", usage: "path to the gpg key ring used for signing"},
+	{key: "aws_s3_bucket_name", usage: "name of the s3 bucket"},
+	{key: "aws_s3_lock_bucket_name", usage: "name of the s3 bucket for lockfiles"},
+	{key: "aws_role_arn", usage: "arn for the iam role to be used for fetching aws sts credentials"},
+	{key: "aws_region", usage: "aws region for the buckets"},
+	{key: "aws_tags", usage: "tags for the lock s3 objects (url query encoded)"},
+	{key: "disable_lock", usage: "disable locking, for stuff that won't need one like windows msi", valueType: settingTypeBool},
+	{key: "lock_retries", usage: "retries amount when repo is busy, retry backoff is 1 minute", valueType: settingTypeUint},
+	{key: "lock_group", usage: "name of the lockfile, uploads sharing it can't run in parallel"},
+	{key: "local_packages_path", usage: "local path where packages are already present, skipping the download"},
+	{key: "apt_skip_mirror", usage: "skip mirroring the apt repo", valueType: settingTypeBool},
+	{key: "release_marker", usage: "where the releases are recorded, s3, dir or memory (default s3)"},
+	{key: "release_marker_dir", usage: "folder recording the releases of the dir release marker, artifacts_dest_folder when empty"},
+	{key: "webhook_urls", usage: "comma separated urls notified of the start and end of the release, usually holding tokens", secret: true},
+	{key: "webhook_secret", usage: "key signing the webhook payloads with hmac-sha256", secret: true},
+	{key: "webhook_template", usage: "path to a go template rendering the webhook bodies, the json event when empty"},
+	{key: "report_path", usage: "path where the json report of the uploads is written"},
+	{key: "github_step_summary", usage: "file the markdown report of the uploads is appended to, set by github actions"},
+	{key: "log_format", usage: "format of the logs, text or json (default text)"},
+	{key: "log_level", usage: "level of the logs, debug, info, warn or error (default info)"},
+	{key: "metrics_path", usage: "path where the metrics of the publishing are written in the prometheus text format"},
+	{key: "metrics_pushgateway_url", usage: "url of a prometheus pushgateway the metrics of the publishing are pushed to, with basic auth credentials if any", secret: true},
+	{key: "otlp_endpoint", usage: "base url of an opentelemetry collector receiving the telemetry of the publishing with otlp/http"},
+	{key: "otlp_headers", usage: "comma separated name=value headers sent to the otlp endpoint, i.e. api keys", secret: true},
+	{key: "traceparent", usage: "w3c traceparent of the span of the calling workflow the publishing is traced in"},
+}
+
+// Flags returns a flag set with a flag for every setting, plus --config pointing to a config file.
+func Flags(name string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.String(configFileFlag, "", fmt.Sprintf("path to a YAML or TOML config file (env %s)", configFileEnv))
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.envName())
+		switch s.valueType {
+		case settingTypeBool:
+			flags.Bool(s.flagName(), false, usage)
+		case settingTypeUint:
+			flags.Uint(s.flagName(), 0, usage)
+		default:
+			flags.String(s.flagName(), "", usage)
+		}
+	}
+	flags.SortFlags = false
+
+	return flags
+}
+
+// readConfigFile loads the config file pointed by --config or CONFIG_FILE, if any.
+func readConfigFile(v *viper.Viper, flags *pflag.FlagSet) error {
+	configFile := os.Getenv(configFileEnv)
+	if flags != nil {
+		if f := flags.Lookup(configFileFlag); f != nil && f.Changed {
+			configFile = f.Value.String()
+		}
+	}
+	if configFile == "" {
+		return nil
+	}
+
+	v.SetConfigFile(configFile)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading config file %s: %w", configFile, err)
+	}
+	return nil
+}
+
+// Print writes the effective configuration as YAML, in the same format accepted by the config file,
+// masking secrets.
+func Print(w io.Writer, c Config) error {
+	values := map[string]interface{}{
+		"repo_name":               c.RepoName,
+		"app_name":                c.AppName,
+		"app_version":             c.Version,
+		"tag":                     c.Tag,
+		"access_point_host":       c.AccessPointHost,
+		"run_id":                  c.RunID,
+		"artifacts_dest_folder":   c.ArtifactsDestFolder,
+		"artifacts_src_folder":    c.ArtifactsSrcFolder,
+		"aptly_folder":            c.AptlyFolder,
+		"upload_schema_file_path": c.UploadSchemaFilePath,
+		"schema_url":              c.SchemaURL,
+		"schema_path":             c.SchemaPath,
+		"schema_sha256":           c.SchemaSHA256,
+		"schema_cache_dir":        c.SchemaCacheDir,
+		"github_token":            c.GithubToken,
+		"schema":                  c.Schema,
+		"schema_unknown_fields":   c.SchemaUnknownFields,
+		"dest_prefix":             c.DestPrefix,
+		"gpg_passphrase":          c.GpgPassphrase,
+		"gpg_key_ring":            c.GpgKeyRing,
+		"aws_s3_bucket_name":      c.AwsBucket,
+		"aws_s3_lock_bucket_name": c.AwsLockBucket,
+		"aws_role_arn":            c.AwsRoleARN,
+		"aws_region":              c.AwsRegion,
+		"aws_tags":                c.AwsTags,
+		"disable_lock":            c.DisableLock,
+		"lock_retries":            c.LockRetries,
+		"lock_group":              c.LockGroup,
+		"local_packages_path":     c.LocalPackagesPath,
+		"apt_skip_mirror":         c.AptSkipMirror,
+		"release_marker":          c.ReleaseMarker,
+		"release_marker_dir":      c.ReleaseMarkerDir,
+		"webhook_urls":            strings.Join(c.WebhookURLs, ","),
+		"webhook_secret":          c.WebhookSecret,
+		"webhook_template":        c.WebhookTemplate,
+		"report_path":             c.ReportPath,
+		"github_step_summary":     c.GithubStepSummary,
+		"log_format":              c.LogFormat,
+		"log_level":               c.LogLevel,
+		"metrics_path":            c.MetricsPath,
+		"metrics_pushgateway_url": c.MetricsPushgatewayURL,
+		"otlp_endpoint":           c.OtlpEndpoint,
+		"otlp_headers":            c.OtlpHeaders,
+		"traceparent":             c.Traceparent,
+	}
+	if c.UseDefLockRetries {
+		values["lock_retries"] = DefaultLockRetries
+	}
+
+	var out yaml.MapSlice
+	for _, s := range settings {
+		value := values[s.key]
+		if s.secret && value != "" {
+			value = maskedValue
+		}
+		out = append(out, yaml.MapItem{Key: s.key, Value: value})
+	}
+
+	content, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+)
+
+// TemplateContext returns the values of the placeholders of the release for a target, shared by download
+// and upload to render the schema templates.
+func (c Config) TemplateContext(target Target) utils.TemplateContext {
+	return utils.TemplateContext{
+		RepoName:   c.RepoName,
+		AppName:    c.AppName,
+		Tag:        c.Tag,
+		Version:    c.Version,
+		DestPrefix: c.DestPrefix,
+		Arch:       target.Arch,
+		OsVersion:  target.OsVersion,
+	}
+}
+
+// SrcFile renders the file name of the artifact.
+func (s UploadArtifactSchema) SrcFile(ctx utils.TemplateContext) (string, error) {
+	return ctx.Render(s.Src)
+}
+
+// DestPath renders the destination of the upload of a source file, replacing {dest_arch} by the arch name
+// in the destination. For yum and zypp {arch} is replaced by it too, as their destinations always used
+// the rpm arch names.
+func (u Upload) DestPath(ctx utils.TemplateContext, srcFile string) (string, error) {
+	destArch := u.DestArch(ctx.Arch)
+	ctx = ctx.WithSrc(srcFile).WithDestArch(destArch)
+	if u.Type == TypeYum || u.Type == TypeZypp {
+		ctx.Arch = destArch
+	}
+	return ctx.Render(u.Dest)
+}
+
+// SrcRepoURL renders the URL of the repository mirrored before adding the packages of an apt upload.
+func (u Upload) SrcRepoURL(ctx utils.TemplateContext, accessPointHost string) (string, error) {
+	return ctx.WithAccessPointHost(accessPointHost).Render(u.SrcRepo)
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate checks that every setting required by the publishing mode is present. Requirements depend on
+// downloading the assets or using local packages, where the release marker is written, locking or not, and the
+// schema publishing apt, yum or zypp repositories, which are signed. All the problems are reported at once in a
+// single error.
+func (c Config) Validate(schemas UploadArtifactSchemas) error {
+	var errs []error
+	require := func(value, key, reason string) {
+		if value == "" {
+			errs = append(errs, missingSettingErr(key, reason))
+		}
+	}
+
+	require(c.AppName, "app_name", "to resolve the schema placeholders")
+	require(c.ArtifactsDestFolder, "artifacts_dest_folder", "to publish the artifacts")
+	// the AWS credentials are needed by the release marker in the bucket and the lock, the uploads write to the
+	// mounted bucket
+	if c.ReleaseMarker == ReleaseMarkerS3 {
+		require(c.AwsBucket, "aws_s3_bucket_name", "to write the release marker")
+		require(c.AwsRoleARN, "aws_role_arn", "to write the release marker")
+		require(c.AwsRegion, "aws_region", "to write the release marker")
+	} else if !c.DisableLock {
+		require(c.AwsRoleARN, "aws_role_arn", "to take the lock, unless disable_lock is set")
+		require(c.AwsRegion, "aws_region", "to take the lock, unless disable_lock is set")
+	}
+
+	if c.LocalPackagesPath == "" {
+		require(c.RepoName, "repo_name", "to download the release assets")
+		require(c.Tag, "tag", "to download the release assets")
+		require(c.ArtifactsSrcFolder, "artifacts_src_folder", "to download the release assets")
+	} else if c.Version == "" {
+		errs = append(errs, missingSettingErr("tag", "or app_version to resolve the schema placeholders"))
+	}
+
+	if !c.DisableLock {
+		require(c.AwsLockBucket, "aws_s3_lock_bucket_name", "unless disable_lock is set")
+	}
+	// release marks are named by start second and run, runs without lock can start at the same time
+	if c.ReleaseMarker != ReleaseMarkerMemory {
+		require(c.RunID, "run_id", "to name the release marks")
+	} else if !c.DisableLock {
+		require(c.RunID, "run_id", "to own the lock, unless disable_lock is set")
+	}
+
+	if signed := schemas.signedTypes(); len(signed) > 0 {
+		require(c.GpgKeyRing, "gpg_key_ring", fmt.Sprintf("to sign the %s repositories", strings.Join(signed, ", ")))
+	}
+
+	return errors.Join(errs...)
+}
+
+func missingSettingErr(key, reason string) error {
+	s := setting{key: key}
+	return fmt.Errorf("%w: %s %s (set %s or --%s)", ErrMissingConfig, key, reason, s.envName(), s.flagName())
+}
+
+// signedTypes returns the upload types present in the schemas that require signing repository metadata.
+func (s UploadArtifactSchemas) signedTypes() []string {
+	var types []string
+	for _, signedType := range []string{TypeApt, TypeYum, TypeZypp} {
+	schemas:
+		for _, schema := range s {
+			for _, upload := range schema.Uploads {
+				if upload.Type == signedType {
+					types = append(types, signedType)
+					break schemas
+				}
+			}
+		}
+	}
+	return types
+}
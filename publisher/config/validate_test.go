@@ -0,0 +1,176 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	valid := Config{
+		AppName:             "nri-foobar",
+		RepoName:            "newrelic/nri-foobar",
+		Tag:                 "v1.0.0",
+		Version:             "1.0.0",
+		RunID:               "1234",
+		Schema:              "ohi",
+		ArtifactsSrcFolder:  "/assets",
+		ArtifactsDestFolder: "/mnt/s3",
+		AwsBucket:           "bucket",
+		AwsLockBucket:       "lock-bucket",
+		AwsRoleARN:          "arn",
+		AwsRegion:           "us-east-1",
+		GpgKeyRing:          "/keyring.gpg",
+		ReleaseMarker:       ReleaseMarkerS3,
+	}
+	fileSchema := UploadArtifactSchemas{{Src: "foo.tar.gz", Uploads: []Upload{{Type: TypeFile}}}}
+	repoSchema := UploadArtifactSchemas{{Src: "foo.deb", Uploads: []Upload{{Type: TypeApt}, {Type: TypeYum}}}}
+
+	tests := []struct {
+		name        string
+		conf        func(c Config) Config
+		schemas     UploadArtifactSchemas
+		expectedErr []string
+	}{
+		{
+			name:    "valid",
+			conf:    func(c Config) Config { return c },
+			schemas: repoSchema,
+		},
+		{
+			name: "download requires repo and tag",
+			conf: func(c Config) Config {
+				c.RepoName, c.Tag, c.ArtifactsSrcFolder = "", "", ""
+				return c
+			},
+			schemas: fileSchema,
+			expectedErr: []string{
+				"repo_name to download the release assets (set REPO_NAME or --repo-name)",
+				"tag to download the release assets (set TAG or --tag)",
+				"artifacts_src_folder to download the release assets (set ARTIFACTS_SRC_FOLDER or --artifacts-src-folder)",
+			},
+		},
+		{
+			name: "local packages only require a version",
+			conf: func(c Config) Config {
+				c.LocalPackagesPath = "/srv/dist"
+				c.RepoName, c.Tag, c.ArtifactsSrcFolder = "", "", ""
+				return c
+			},
+			schemas: fileSchema,
+		},
+		{
+			name: "local packages without version",
+			conf: func(c Config) Config {
+				c.LocalPackagesPath = "/srv/dist"
+				c.Tag, c.Version = "", ""
+				return c
+			},
+			schemas:     fileSchema,
+			expectedErr: []string{"tag or app_version to resolve the schema placeholders (set TAG or --tag)"},
+		},
+		{
+			name: "lock settings",
+			conf: func(c Config) Config {
+				c.AwsLockBucket, c.RunID, c.ReleaseMarker = "", "", ReleaseMarkerMemory
+				return c
+			},
+			schemas: fileSchema,
+			expectedErr: []string{
+				"aws_s3_lock_bucket_name unless disable_lock is set (set AWS_S3_LOCK_BUCKET_NAME or --aws-s3-lock-bucket-name)",
+				"run_id to own the lock, unless disable_lock is set (set RUN_ID or --run-id)",
+			},
+		},
+		{
+			name: "lock settings are not required when disabled",
+			conf: func(c Config) Config {
+				c.AwsLockBucket, c.RunID, c.DisableLock, c.ReleaseMarker = "", "", true, ReleaseMarkerMemory
+				return c
+			},
+			schemas: fileSchema,
+		},
+		{
+			name: "release marks require a run without lock",
+			conf: func(c Config) Config {
+				c.AwsLockBucket, c.RunID, c.DisableLock = "", "", true
+				return c
+			},
+			schemas:     fileSchema,
+			expectedErr: []string{"run_id to name the release marks (set RUN_ID or --run-id)"},
+		},
+		{
+			name: "dir release marker without AWS settings",
+			conf: func(c Config) Config {
+				c.ReleaseMarker, c.DisableLock = ReleaseMarkerDir, true
+				c.AwsBucket, c.AwsLockBucket, c.AwsRoleARN, c.AwsRegion = "", "", "", ""
+				return c
+			},
+			schemas: repoSchema,
+		},
+		{
+			name: "the lock requires AWS credentials without the bucket release marker",
+			conf: func(c Config) Config {
+				c.ReleaseMarker = ReleaseMarkerDir
+				c.AwsBucket, c.AwsRoleARN, c.AwsRegion = "", "", ""
+				return c
+			},
+			schemas: fileSchema,
+			expectedErr: []string{
+				"aws_role_arn to take the lock, unless disable_lock is set (set AWS_ROLE_ARN or --aws-role-arn)",
+				"aws_region to take the lock, unless disable_lock is set (set AWS_REGION or --aws-region)",
+			},
+		},
+		{
+			name: "signing is required for repositories",
+			conf: func(c Config) Config {
+				c.GpgKeyRing = ""
+				return c
+			},
+			schemas:     repoSchema,
+			expectedErr: []string{"gpg_key_ring to sign the apt, yum repositories (set GPG_KEY_RING or --gpg-key-ring)"},
+		},
+		{
+			name: "signing is not required for files",
+			conf: func(c Config) Config {
+				c.GpgKeyRing = ""
+				return c
+			},
+			schemas: fileSchema,
+		},
+		{
+			name: "every problem is reported",
+			conf: func(c Config) Config {
+				return Config{DisableLock: true, LocalPackagesPath: "/srv/dist", Version: "1.0.0", ReleaseMarker: ReleaseMarkerS3}
+			},
+			schemas: fileSchema,
+			expectedErr: []string{
+				"app_name to resolve the schema placeholders (set APP_NAME or --app-name)",
+				"artifacts_dest_folder to publish the artifacts (set ARTIFACTS_DEST_FOLDER or --artifacts-dest-folder)",
+				"aws_s3_bucket_name to write the release marker (set AWS_S3_BUCKET_NAME or --aws-s3-bucket-name)",
+				"aws_role_arn to write the release marker (set AWS_ROLE_ARN or --aws-role-arn)",
+				"aws_region to write the release marker (set AWS_REGION or --aws-region)",
+				"run_id to name the release marks (set RUN_ID or --run-id)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf(valid).Validate(tt.schemas)
+			if len(tt.expectedErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrMissingConfig)
+			var expected string
+			for i, e := range tt.expectedErr {
+				if i > 0 {
+					expected += "\n"
+				}
+				expected += ErrMissingConfig.Error() + ": " + e
+			}
+			assert.EqualError(t, err, expected)
+		})
+	}
+}
@@ -3,12 +3,13 @@ package download
 import (
 	"fmt"
 	"github.com/newrelic/infrastructure-publish-action/publisher/config"
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+	"github.com/newrelic/infrastructure-publish-action/publisher/trace"
 	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
 	"io"
 	"net/http"
 	"os"
 	"path"
-	"strings"
 	"time"
 )
 
@@ -18,25 +19,30 @@ const (
 	durationAfterRetry = 2 * time.Second
 )
 
-func (d *downloader) downloadArtifact(conf config.Config, src, arch, osVersion string) error {
+func (d *downloader) downloadArtifact(conf config.Config, srcFile string) (err error) {
 
-	utils.Logger.Println("Starting downloading artifacts!")
+	utils.Logger.Info("downloading artifacts")
 
-	srcFile := utils.ReplacePlaceholders(src, conf.RepoName, conf.AppName, arch, conf.Tag, conf.Version, conf.DestPrefix, osVersion)
-	url := generateDownloadUrl(urlTemplate, conf.RepoName, conf.Tag, srcFile)
+	url, err := generateDownloadUrl(urlTemplate, conf, srcFile)
+	if err != nil {
+		return err
+	}
+	span := trace.Start("download file", otlp.String("src", srcFile), otlp.String("url", url))
+	defer func() { span.End(err) }()
 
 	destPath := path.Join(conf.ArtifactsSrcFolder, srcFile)
 
-	utils.Logger.Println(fmt.Sprintf("[ ] Download %s into %s", url, destPath))
+	utils.Logger.Info("downloading file", "url", url, "dest", destPath)
 
-	err := utils.Retry(
+	err = utils.Retry(
+		"download",
 		func() error {
 			return d.downloadFile(url, destPath)
 		},
 		retries,
 		durationAfterRetry,
 		func() {
-			utils.Logger.Printf("retrying downloadFile %s\n", url)
+			utils.Logger.Warn("cannot download file, retrying", "url", url)
 		})
 
 	if err != nil {
@@ -48,7 +54,7 @@ func (d *downloader) downloadArtifact(conf config.Config, src, arch, osVersion s
 		return err
 	}
 
-	utils.Logger.Println(fmt.Sprintf("[✔] Download %s into %s %d bytes", url, destPath, fi.Size()))
+	utils.Logger.Info("[✔] downloaded file", "url", url, "dest", destPath, "bytes", fi.Size())
 
 	return nil
 }
@@ -97,36 +103,21 @@ func NewDownloader(client HTTPClient) *downloader {
 	}
 }
 
+// DownloadArtifacts downloads every source file of the schemas once, see SrcFiles.
 func (d *downloader) DownloadArtifacts(conf config.Config, schema config.UploadArtifactSchemas) error {
-	for _, artifactSchema := range schema {
-		var osVersions []string
-		for _, up := range artifactSchema.Uploads {
-			osVersions = append(osVersions, up.OsVersion...)
-		}
-
-		if len(osVersions) == 0 {
-			osVersions = []string{""}
-		}
-
-		for _, osVersion := range osVersions {
-			for _, arch := range artifactSchema.Arch {
-				err := d.downloadArtifact(conf, artifactSchema.Src, arch, osVersion)
-				if err != nil {
-					return err
-				}
-			}
+	srcFiles, err := SrcFiles(conf, schema)
+	if err != nil {
+		return err
+	}
+	for _, srcFile := range srcFiles {
+		err := d.downloadArtifact(conf, srcFile)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func GenerateDownloadFileName(srcFileTemplate, repoName, appName, arch, tag, version, destPrefix, osVersion string) string {
-	return utils.ReplacePlaceholders(srcFileTemplate, repoName, appName, arch, tag, version, destPrefix, osVersion)
-}
-
-func generateDownloadUrl(template, repoName, tag, srcFile string) (url string) {
-	url = utils.ReplacePlaceholders(template, repoName, "", "", tag, "", "", "")
-	url = strings.Replace(url, utils.PlaceholderForSrc, srcFile, -1)
-
-	return
+func generateDownloadUrl(template string, conf config.Config, srcFile string) (string, error) {
+	return conf.TemplateContext(config.Target{}).WithSrc(srcFile).Render(template)
 }
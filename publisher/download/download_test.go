@@ -45,8 +45,9 @@ func TestDownloadArtifacts(t *testing.T) {
 	}
 
 	cfg := config.Config{
-		Version: "2.0.0",
-		AppName: "nri-foobar",
+		Version:            "2.0.0",
+		AppName:            "nri-foobar",
+		ArtifactsSrcFolder: t.TempDir(),
 	}
 
 	urlRecClient := newURLRecorderHTTPClient()
@@ -59,11 +60,11 @@ func TestDownloadArtifacts(t *testing.T) {
 
 func Test_generateDownloadUrl(t *testing.T) {
 
-	repoName := "newrelic/infrastructure-agent"
-	tag := "1.16.4"
+	conf := config.Config{RepoName: "newrelic/infrastructure-agent", Tag: "1.16.4"}
 	srcFile := "newrelic-infra-1.16.4-1.el8.arm.rpm"
 
-	url := generateDownloadUrl(urlTemplate, repoName, tag, srcFile)
+	url, err := generateDownloadUrl(urlTemplate, conf, srcFile)
 
+	assert.NoError(t, err)
 	assert.Equal(t, "https://github.com/newrelic/infrastructure-agent/releases/download/1.16.4/newrelic-infra-1.16.4-1.el8.arm.rpm", url)
 }
@@ -0,0 +1,134 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/config"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+)
+
+var ErrMissingArtifacts = errors.New("missing artifacts")
+
+// SrcFiles resolves the name of every source file the schemas expect to publish, following the same
+// arch and os_version expansion, matrix rules included, the upload phase uses. Duplicates are removed
+// keeping the schema order.
+func SrcFiles(conf config.Config, schemas config.UploadArtifactSchemas) ([]string, error) {
+	var srcFiles []string
+	seen := make(map[string]bool)
+	for _, artifactSchema := range schemas {
+		for _, up := range artifactSchema.Uploads {
+			for _, target := range artifactSchema.Targets(up) {
+				srcFile, err := artifactSchema.SrcFile(conf.TemplateContext(target))
+				if err != nil {
+					return nil, err
+				}
+				if !seen[srcFile] {
+					seen[srcFile] = true
+					srcFiles = append(srcFiles, srcFile)
+				}
+			}
+		}
+	}
+	return srcFiles, nil
+}
+
+// CheckArtifacts verifies that every expected source file is available as a GitHub release asset,
+// sending a HEAD request for each one. All the missing assets are reported at once.
+func (d *downloader) CheckArtifacts(conf config.Config, schemas config.UploadArtifactSchemas) error {
+	srcFiles, err := SrcFiles(conf, schemas)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, srcFile := range srcFiles {
+		url, err := generateDownloadUrl(urlTemplate, conf, srcFile)
+		if err != nil {
+			return err
+		}
+
+		var statusCode int
+		err = utils.Retry(
+			"preflight",
+			func() (err error) {
+				statusCode, err = d.headStatus(url)
+				return err
+			},
+			retries,
+			durationAfterRetry,
+			func() {
+				utils.Logger.Warn("cannot check file, retrying", "url", url)
+			})
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%v)", url, err))
+			continue
+		}
+
+		if statusCode != http.StatusOK {
+			missing = append(missing, fmt.Sprintf("%s (status code %v)", url, statusCode))
+			continue
+		}
+		utils.Logger.Info("[✔] found file", "url", url)
+	}
+
+	return missingArtifactsErr(missing)
+}
+
+// headStatus returns the status code of a HEAD request, server errors are considered transient and returned as errors.
+func (d *downloader) headStatus(url string) (int, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusInternalServerError {
+		return 0, fmt.Errorf("error on checking %s with status code %v", url, response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// CheckLocalArtifacts verifies that every expected source file is present in the artifacts source folder.
+// All the missing files are reported at once.
+func CheckLocalArtifacts(conf config.Config, schemas config.UploadArtifactSchemas) error {
+	srcFiles, err := SrcFiles(conf, schemas)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, srcFile := range srcFiles {
+		srcPath := path.Join(conf.ArtifactsSrcFolder, srcFile)
+		fi, err := os.Stat(srcPath)
+		if err != nil {
+			missing = append(missing, srcPath)
+			continue
+		}
+		if fi.IsDir() {
+			missing = append(missing, fmt.Sprintf("%s (is a directory)", srcPath))
+			continue
+		}
+		utils.Logger.Info("[✔] found file", "path", srcPath)
+	}
+
+	return missingArtifactsErr(missing)
+}
+
+func missingArtifactsErr(missing []string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d expected source files not found:\n  %s", ErrMissingArtifacts, len(missing), strings.Join(missing, "\n  "))
+}
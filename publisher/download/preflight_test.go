@@ -0,0 +1,141 @@
+package download
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// headRecorderHTTPClient answers 200 for the existing paths and 404 for the rest.
+type headRecorderHTTPClient struct {
+	existing map[string]bool
+	methods  []string
+}
+
+func (c *headRecorderHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.methods = append(c.methods, req.Method)
+
+	statusCode := http.StatusNotFound
+	if c.existing[req.URL.Path] {
+		statusCode = http.StatusOK
+	}
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte{})),
+	}, nil
+}
+
+var preflightSchema = config.UploadArtifactSchemas{
+	{
+		Src:  "{app_name}-{arch}-{version}.txt",
+		Arch: []string{"amd64", "arm64"},
+		Uploads: []config.Upload{
+			{Type: "file", Dest: "{arch}/{src}"},
+			{Type: "file", Dest: "latest/{arch}/{src}"},
+		},
+	},
+	{
+		Src:  "{app_name}-{version}-{os_version}.{arch}.rpm",
+		Arch: []string{"x86_64"},
+		Uploads: []config.Upload{
+			{Type: "yum", Dest: "yum/{os_version}/{arch}", OsVersion: []string{"7", "8"}},
+		},
+	},
+}
+
+var preflightConf = config.Config{
+	RepoName: "newrelic/nri-foobar",
+	AppName:  "nri-foobar",
+	Tag:      "v2.0.0",
+	Version:  "2.0.0",
+}
+
+func TestSrcFiles(t *testing.T) {
+	expected := []string{
+		"nri-foobar-amd64-2.0.0.txt",
+		"nri-foobar-arm64-2.0.0.txt",
+		"nri-foobar-2.0.0-7.x86_64.rpm",
+		"nri-foobar-2.0.0-8.x86_64.rpm",
+	}
+
+	srcFiles, err := SrcFiles(preflightConf, preflightSchema)
+	require.NoError(t, err)
+	assert.Equal(t, expected, srcFiles)
+}
+
+func TestSrcFiles_matrix(t *testing.T) {
+	schemas := config.UploadArtifactSchemas{
+		{
+			Src:     "{app_name}-{version}-{os_version}.{arch}.rpm",
+			Arch:    []string{"x86_64", "aarch64"},
+			Exclude: []config.MatrixRule{{Arch: "aarch64", OsVersion: "6"}},
+			Include: []config.MatrixRule{{Arch: "i386", OsVersion: "6", Type: config.TypeYum}},
+			Uploads: []config.Upload{
+				{Type: "yum", Dest: "yum/{os_version}/{arch}", OsVersion: []string{"6", "7"}},
+				{Type: "zypp", Dest: "zypp/{os_version}/{arch}", OsVersion: []string{"7"}},
+			},
+		},
+	}
+
+	expected := []string{
+		"nri-foobar-2.0.0-6.x86_64.rpm",
+		"nri-foobar-2.0.0-7.x86_64.rpm",
+		"nri-foobar-2.0.0-7.aarch64.rpm",
+		"nri-foobar-2.0.0-6.i386.rpm",
+	}
+
+	srcFiles, err := SrcFiles(preflightConf, schemas)
+	require.NoError(t, err)
+	assert.Equal(t, expected, srcFiles)
+}
+
+func TestCheckArtifacts(t *testing.T) {
+	client := &headRecorderHTTPClient{existing: map[string]bool{
+		"/newrelic/nri-foobar/releases/download/v2.0.0/nri-foobar-amd64-2.0.0.txt":    true,
+		"/newrelic/nri-foobar/releases/download/v2.0.0/nri-foobar-2.0.0-7.x86_64.rpm": true,
+	}}
+
+	err := NewDownloader(client).CheckArtifacts(preflightConf, preflightSchema)
+	require.ErrorIs(t, err, ErrMissingArtifacts)
+	// every missing asset is reported at once
+	assert.Contains(t, err.Error(), "nri-foobar-arm64-2.0.0.txt (status code 404)")
+	assert.Contains(t, err.Error(), "nri-foobar-2.0.0-8.x86_64.rpm (status code 404)")
+	assert.NotContains(t, err.Error(), "nri-foobar-amd64-2.0.0.txt")
+	// nothing is downloaded
+	assert.Equal(t, []string{http.MethodHead, http.MethodHead, http.MethodHead, http.MethodHead}, client.methods)
+}
+
+func TestCheckArtifacts_allPresent(t *testing.T) {
+	srcFiles, err := SrcFiles(preflightConf, preflightSchema)
+	require.NoError(t, err)
+	client := &headRecorderHTTPClient{existing: map[string]bool{}}
+	for _, srcFile := range srcFiles {
+		client.existing["/newrelic/nri-foobar/releases/download/v2.0.0/"+srcFile] = true
+	}
+
+	assert.NoError(t, NewDownloader(client).CheckArtifacts(preflightConf, preflightSchema))
+}
+
+func TestCheckLocalArtifacts(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(src, "nri-foobar-amd64-2.0.0.txt"), []byte("test"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(src, "nri-foobar-2.0.0-8.x86_64.rpm"), []byte("test"), 0644))
+	require.NoError(t, os.Mkdir(path.Join(src, "nri-foobar-arm64-2.0.0.txt"), 0755))
+
+	conf := preflightConf
+	conf.ArtifactsSrcFolder = src
+
+	err := CheckLocalArtifacts(conf, preflightSchema)
+	require.ErrorIs(t, err, ErrMissingArtifacts)
+	assert.Contains(t, err.Error(), "2 expected source files not found")
+	assert.Contains(t, err.Error(), path.Join(src, "nri-foobar-arm64-2.0.0.txt")+" (is a directory)")
+	assert.Contains(t, err.Error(), path.Join(src, "nri-foobar-2.0.0-7.x86_64.rpm"))
+}
@@ -6,7 +6,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/newrelic/infrastructure-publish-action/publisher/metrics"
 )
 
 // S3Config S3 lock config DTO.
@@ -32,13 +33,10 @@ type S3Config struct {
 // S3 based lock.
 type S3 struct {
 	client *s3.S3
-	logF   Logf
+	logger *slog.Logger
 	conf   S3Config
 }
 
-// Logf logger to provide feedback on retries.
-type Logf func(format string, args ...interface{})
-
 // lockData represents contents of the JSON lock-file at S3.
 type lockData struct {
 	Owner     string    `json:"owner"`
@@ -69,7 +67,8 @@ func NewS3Config(bucketName, roleARN, awsRegion, tags, lockGroup, owner string,
 }
 
 // NewS3 creates a lock instance ready to be used validating required AWS credentials.
-func NewS3(c S3Config, logfn Logf) (*S3, error) {
+// The logger provides feedback on retries.
+func NewS3(c S3Config, logger *slog.Logger) (*S3, error) {
 	sess, err := session.NewSession()
 	if err != nil {
 		return nil, err
@@ -83,7 +82,7 @@ func NewS3(c S3Config, logfn Logf) (*S3, error) {
 
 	return &S3{
 		client: s3.New(sess, &awsCfg),
-		logF:   logfn,
+		logger: logger,
 		conf:   c,
 	}, nil
 }
@@ -91,11 +90,12 @@ func NewS3(c S3Config, logfn Logf) (*S3, error) {
 // Lock S3 has no compare-and-swap so this is no bulletproof solution, but should be good enough.
 func (l *S3) Lock() error {
 	for tries := 0; tries < int(l.conf.MaxRetries); tries++ {
-		l.logF("[lock] %s attempt %d", l.conf.Owner, tries)
+		l.logger.Info("acquiring lock", "owner", l.conf.Owner, "attempt", tries)
 		if !l.isBusyDeletingExpired() || tries >= int(l.conf.MaxRetries) {
 			break
 		}
-		l.logF("[lock] %s failed, waiting %s", l.conf.Owner, l.conf.RetryBackoff.String())
+		l.logger.Info("lock busy, waiting", "owner", l.conf.Owner, "backoff", l.conf.RetryBackoff.String())
+		metrics.Retries.Add(1, "lock")
 		time.Sleep(l.conf.RetryBackoff)
 	}
 
@@ -175,20 +175,20 @@ func (l *S3) isBusyDeletingExpired() (busy bool) {
 			default:
 			}
 		}
-		logErr(err)
+		l.logger.Error("cannot read lock", "error", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		logErr(err)
+		l.logger.Error("cannot read lock", "error", err)
 		return
 	}
 	var data lockData
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		logErr(err)
+		l.logger.Error("cannot read lock", "error", err)
 		return
 	}
 
@@ -201,7 +201,3 @@ func (l *S3) isBusyDeletingExpired() (busy bool) {
 
 	return
 }
-
-func logErr(err error) {
-	log.Println(err)
-}
@@ -0,0 +1,232 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+)
+
+const (
+	// PushJob is the job grouping the metrics pushed to a Pushgateway.
+	PushJob = "infrastructure_publish_action"
+
+	textContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var ErrPush = errors.New("cannot push metrics")
+
+// WriteText writes the metrics with samples in the Prometheus text format, with the labels added to every sample.
+func (r *Registry) WriteText(w io.Writer, labels ...Label) error {
+	var b strings.Builder
+	for _, m := range r.metrics {
+		samples := m.Samples()
+		if len(samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", m.Name, escapeHelp(m.Help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", m.Name, m.Kind)
+		for _, s := range samples {
+			b.WriteString(m.Name)
+			writeLabels(&b, append(append([]Label{}, labels...), s.Labels...))
+			fmt.Fprintf(&b, " %s\n", formatValue(s.Value))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteFile writes the metrics in the Prometheus text format to the path, i.e. read by the textfile collector of
+// the node exporter. It's replaced at once, so the collector never reads a partial file.
+func (r *Registry) WriteFile(path string, labels ...Label) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = r.WriteText(tmp, labels...); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Push pushes the metrics to the Pushgateway at gatewayURL, replacing the ones of the group of PushJob and the labels.
+func (r *Registry) Push(client *http.Client, gatewayURL string, labels ...Label) error {
+	path := "/metrics/job/" + url.PathEscape(PushJob)
+	for _, l := range labels {
+		path += "/" + url.PathEscape(l.Name) + "/" + url.PathEscape(l.Value)
+	}
+	var body bytes.Buffer
+	if err := r.WriteText(&body); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(gatewayURL, "/")+path, &body)
+	if err != nil {
+		// the parsing error holds the url, which can have credentials
+		return fmt.Errorf("%w: invalid pushgateway url", ErrPush)
+	}
+	req.Header.Set("Content-Type", textContentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPush, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s %s: %s", ErrPush, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func writeLabels(b *strings.Builder, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%s=\"%s\"", l.Name, escapeLabelValue(l.Value))
+	}
+	b.WriteByte('}')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+// ExportOTLP exports the metrics with samples to an OpenTelemetry collector, the labels being attributes of the
+// resource. Counters are monotonic cumulative sums since the registry was created.
+func (r *Registry) ExportOTLP(client *otlp.Client, labels ...Label) error {
+	return client.Export(otlp.MetricsPath, r.otlpPayload(labels))
+}
+
+type otlpMetricsPayload struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlp.Resource      `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlp.Scope   `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Unit        string     `json:"unit,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+	// AggregationTemporality is 2, cumulative
+	AggregationTemporality int  `json:"aggregationTemporality"`
+	IsMonotonic            bool `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlp.KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+const aggregationTemporalityCumulative = 2
+
+func (r *Registry) otlpPayload(labels []Label) otlpMetricsPayload {
+	attrs := make([]otlp.KeyValue, 0, len(labels))
+	for _, l := range labels {
+		attrs = append(attrs, otlp.String(l.Name, l.Value))
+	}
+	now := otlp.UnixNano(r.now())
+	start := otlp.UnixNano(r.start)
+
+	var metrics []otlpMetric
+	for _, m := range r.metrics {
+		samples := m.Samples()
+		if len(samples) == 0 {
+			continue
+		}
+		points := make([]otlpDataPoint, 0, len(samples))
+		for _, s := range samples {
+			point := otlpDataPoint{TimeUnixNano: now, AsDouble: s.Value}
+			for _, l := range s.Labels {
+				point.Attributes = append(point.Attributes, otlp.String(l.Name, l.Value))
+			}
+			points = append(points, point)
+		}
+
+		metric := otlpMetric{Name: m.Name, Description: m.Help, Unit: unit(m.Name)}
+		if m.Kind == KindCounter {
+			for i := range points {
+				points[i].StartTimeUnixNano = start
+			}
+			metric.Sum = &otlpSum{DataPoints: points, AggregationTemporality: aggregationTemporalityCumulative, IsMonotonic: true}
+		} else {
+			metric.Gauge = &otlpGauge{DataPoints: points}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return otlpMetricsPayload{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlp.NewResource(attrs...),
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlp.Scope{Name: otlp.ScopeName}, Metrics: metrics}},
+	}}}
+}
+
+// unit returns the UCUM unit of the metrics following the Prometheus naming conventions.
+func unit(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_bytes"):
+		return "By"
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+// Package metrics collects measures of a publishing, like the time waiting for the lock or uploading to each
+// repository, to follow their trends across releases. They are exported once the publishing ends, in the
+// Prometheus text format to a file or a Pushgateway, or to an OpenTelemetry collector.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KindCounter = "counter"
+	KindGauge   = "gauge"
+)
+
+// Label is a name and value pair, identifying a sample of a metric or added to all of them when exporting.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is the value of a metric for some label values.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Metric is a counter, only growing, or a gauge, holding a sample for every combination of label values.
+type Metric struct {
+	Name   string
+	Help   string
+	Kind   string
+	labels []string
+
+	mu      sync.Mutex
+	samples map[string]*Sample
+}
+
+// Add adds v to the sample of the label values, given in the order of the label names of the metric.
+func (m *Metric) Add(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sample(labelValues).Value += v
+}
+
+// Set sets the sample of the label values, only for gauges.
+func (m *Metric) Set(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sample(labelValues).Value = v
+}
+
+// Value returns the value of the sample of the label values, 0 when not recorded.
+func (m *Metric) Value(labelValues ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.samples[strings.Join(labelValues, "\xff")]; ok {
+		return s.Value
+	}
+	return 0
+}
+
+// Samples returns the samples recorded, sorted by their label values.
+func (m *Metric) Samples() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.samples))
+	for key := range m.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, *m.samples[key])
+	}
+	return samples
+}
+
+func (m *Metric) sample(labelValues []string) *Sample {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.samples[key]
+	if !ok {
+		s = &Sample{}
+		for i, name := range m.labels {
+			var value string
+			if i < len(labelValues) {
+				value = labelValues[i]
+			}
+			s.Labels = append(s.Labels, Label{Name: name, Value: value})
+		}
+		m.samples[key] = s
+	}
+	return s
+}
+
+// Registry holds the metrics of a publishing, counters are cumulative since it's created.
+type Registry struct {
+	start   time.Time
+	metrics []*Metric
+	now     func() time.Time
+}
+
+// NewRegistry returns a registry without metrics.
+func NewRegistry() *Registry {
+	return &Registry{start: time.Now(), now: time.Now}
+}
+
+// Counter registers a counter with the label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Metric {
+	return r.register(name, help, KindCounter, labels)
+}
+
+// Gauge registers a gauge with the label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *Metric {
+	return r.register(name, help, KindGauge, labels)
+}
+
+// Metrics returns the metrics registered, in the order they were.
+func (r *Registry) Metrics() []*Metric {
+	return r.metrics
+}
+
+func (r *Registry) register(name, help, kind string, labels []string) *Metric {
+	m := &Metric{Name: name, Help: help, Kind: kind, labels: labels, samples: map[string]*Sample{}}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// Default holds the metrics of the publisher.
+var Default = NewRegistry()
+
+var (
+	RunDuration    = Default.Gauge("publisher_run_duration_seconds", "Duration of the publishing.")
+	RunSucceeded   = Default.Gauge("publisher_run_succeeded", "Whether the publishing succeeded, 1, or failed, 0.")
+	RunTimestamp   = Default.Gauge("publisher_run_timestamp_seconds", "Unix time when the publishing ended.")
+	PhaseDuration  = Default.Gauge("publisher_phase_duration_seconds", "Duration of the phases of the publishing.", "phase")
+	LockWait       = Default.Gauge("publisher_lock_wait_seconds", "Time waiting to acquire the lock of the bucket.")
+	UploadSeconds  = Default.Counter("publisher_upload_seconds_total", "Time uploading into each repository, apt uploads include publishing the distribution.", "type", "os_version", "arch")
+	Uploads        = Default.Counter("publisher_uploads_total", "Uploads into the repositories by result.", "type", "result")
+	UploadedBytes  = Default.Counter("publisher_uploaded_bytes_total", "Bytes of the artifacts copied into the bucket.", "type")
+	CommandRetries = Default.Counter("publisher_command_retries_total", "Failed executions of commands retried after remounting the bucket.", "cmd")
+	Retries        = Default.Counter("publisher_retries_total", "Failed attempts of operations retried, like downloads.", "operation")
+	S3Remounts     = Default.Counter("publisher_s3_remounts_total", "Remounts of the bucket after a command failed.")
+)
+
+// StartPhase returns a function recording the duration of the phase when called.
+func StartPhase(phase string) func() {
+	start := time.Now()
+	return func() {
+		PhaseDuration.Set(time.Since(start).Seconds(), phase)
+	}
+}
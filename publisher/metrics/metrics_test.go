@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	r.start = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC) }
+
+	r.Gauge("publisher_lock_wait_seconds", "Time waiting to acquire the lock.").Set(12.5)
+	uploads := r.Counter("publisher_upload_seconds_total", "Time uploading into each repository.", "type", "os_version", "arch")
+	uploads.Add(3, "apt", "bookworm", "amd64")
+	uploads.Add(1.5, "apt", "bookworm", "amd64")
+	uploads.Add(2, "yum", "8", "x86_64")
+	r.Counter("publisher_s3_remounts_total", "Remounts of the bucket.")
+	return r
+}
+
+// collector records the requests received, standing in for a Pushgateway or an OpenTelemetry collector.
+type collector struct {
+	*httptest.Server
+	method, path, contentType, apiKey string
+	body                              []byte
+}
+
+func newCollector(t *testing.T, status int) *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		c.method, c.path, c.body = r.Method, r.URL.EscapedPath(), body
+		c.contentType, c.apiKey = r.Header.Get("Content-Type"), r.Header.Get("Api-Key")
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+const expectedText = `# HELP publisher_lock_wait_seconds Time waiting to acquire the lock.
+# TYPE publisher_lock_wait_seconds gauge
+publisher_lock_wait_seconds{app="nri-foo"} 12.5
+# HELP publisher_upload_seconds_total Time uploading into each repository.
+# TYPE publisher_upload_seconds_total counter
+publisher_upload_seconds_total{app="nri-foo",type="apt",os_version="bookworm",arch="amd64"} 4.5
+publisher_upload_seconds_total{app="nri-foo",type="yum",os_version="8",arch="x86_64"} 2
+`
+
+func TestRegistry_WriteText(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, newTestRegistry().WriteText(&out, Label{Name: "app", Value: "nri-foo"}))
+	assert.Equal(t, expectedText, out.String())
+
+	r := NewRegistry()
+	r.Gauge("escaped", "Help with \\ and\nnewline.", "error").Set(1, "\"quoted\"\n")
+	out.Reset()
+	require.NoError(t, r.WriteText(&out))
+	assert.Equal(t, "# HELP escaped Help with \\\\ and\\nnewline.\n# TYPE escaped gauge\nescaped{error=\"\\\"quoted\\\"\\n\"} 1\n", out.String())
+}
+
+func TestRegistry_WriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "publisher.prom")
+	require.NoError(t, os.WriteFile(path, []byte("stale"), 0644))
+
+	require.NoError(t, newTestRegistry().WriteFile(path, Label{Name: "app", Value: "nri-foo"}))
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expectedText, string(written))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are removed")
+}
+
+func TestRegistry_Push(t *testing.T) {
+	gateway := newCollector(t, http.StatusOK)
+	require.NoError(t, newTestRegistry().Push(http.DefaultClient, gateway.URL+"/", Label{Name: "app", Value: "nri/foo"}))
+
+	assert.Equal(t, http.MethodPut, gateway.method)
+	assert.Equal(t, "/metrics/job/infrastructure_publish_action/app/nri%2Ffoo", gateway.path)
+	assert.Equal(t, textContentType, gateway.contentType)
+	assert.Contains(t, string(gateway.body), "publisher_lock_wait_seconds 12.5\n", "grouping labels are not repeated")
+
+	failing := newCollector(t, http.StatusBadRequest)
+	err := newTestRegistry().Push(http.DefaultClient, strings.Replace(failing.URL, "://", "://user:p4ssw0rd@", 1))
+	assert.ErrorIs(t, err, ErrPush)
+	assert.NotContains(t, err.Error(), "p4ssw0rd")
+}
+
+func TestRegistry_ExportOTLP(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	client := otlp.NewClient(c.URL, map[string]string{"Api-Key": "secret"})
+	require.NoError(t, newTestRegistry().ExportOTLP(client, Label{Name: "app", Value: "nri-foo"}))
+
+	assert.Equal(t, http.MethodPost, c.method)
+	assert.Equal(t, otlp.MetricsPath, c.path)
+	assert.Equal(t, "application/json", c.contentType)
+	assert.Equal(t, "secret", c.apiKey)
+
+	var payload otlpMetricsPayload
+	require.NoError(t, json.Unmarshal(c.body, &payload))
+	require.Len(t, payload.ResourceMetrics, 1)
+	resource := payload.ResourceMetrics[0].Resource
+	assert.Equal(t, []otlp.KeyValue{otlp.String("service.name", otlp.ServiceName), otlp.String("app", "nri-foo")}, resource.Attributes)
+
+	metrics := payload.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 2, "metrics without samples are not exported")
+
+	lockWait := metrics[0]
+	assert.Equal(t, "s", lockWait.Unit)
+	require.NotNil(t, lockWait.Gauge)
+	assert.Equal(t, 12.5, lockWait.Gauge.DataPoints[0].AsDouble)
+	assert.Equal(t, "1714557900000000000", lockWait.Gauge.DataPoints[0].TimeUnixNano)
+
+	uploads := metrics[1]
+	require.NotNil(t, uploads.Sum)
+	assert.True(t, uploads.Sum.IsMonotonic)
+	assert.Equal(t, aggregationTemporalityCumulative, uploads.Sum.AggregationTemporality)
+	require.Len(t, uploads.Sum.DataPoints, 2)
+	point := uploads.Sum.DataPoints[0]
+	assert.Equal(t, 4.5, point.AsDouble)
+	assert.Equal(t, "1714557600000000000", point.StartTimeUnixNano)
+	assert.Equal(t, []otlp.KeyValue{otlp.String("type", "apt"), otlp.String("os_version", "bookworm"), otlp.String("arch", "amd64")}, point.Attributes)
+
+	failing := newCollector(t, http.StatusServiceUnavailable)
+	assert.ErrorIs(t, newTestRegistry().ExportOTLP(otlp.NewClient(failing.URL, nil)), otlp.ErrExport)
+}
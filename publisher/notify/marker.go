@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+)
+
+// marker notifies the starts and ends of the releases recorded by another marker.
+type marker struct {
+	release.Marker
+	notifier Notifier
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+// NewMarker returns a marker recording the releases with the given one and notifying their events. Failing to
+// notify doesn't fail the release, it's only logged.
+func NewMarker(m release.Marker, notifier Notifier, logger *slog.Logger) release.Marker {
+	return &marker{
+		Marker:   m,
+		notifier: notifier,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Start notifies the start of the release once recorded, releases failing to start aren't published.
+func (m *marker) Start(releaseInfo release.ReleaseInfo) (release.Mark, error) {
+	mark, err := m.Marker.Start(releaseInfo)
+	if err != nil {
+		return mark, err
+	}
+	m.notify(mark)
+	return mark, nil
+}
+
+// End notifies the end of the release even when it can't be recorded, as the outcome of the release doesn't change.
+func (m *marker) End(mark release.Mark) error {
+	err := m.Marker.End(mark)
+	if mark.End.IsZero() {
+		mark.End = release.CustomTime{Time: m.now().UTC()}
+	}
+	m.notify(mark)
+	return err
+}
+
+func (m *marker) notify(mark release.Mark) {
+	event := NewEvent(mark)
+	if err := m.notifier.Notify(event); err != nil {
+		m.logger.Warn("cannot notify release event", "event", event.Type, "app", mark.AppName, "tag", mark.Tag, "error", err)
+	}
+}
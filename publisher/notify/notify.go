@@ -0,0 +1,197 @@
+// Package notify tells other systems about the releases, posting an event to webhooks when a release starts
+// and when it ends, i.e. to a chat or an observability platform.
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+)
+
+const (
+	// EventHeader holds the type of the event posted, SignatureHeader its hmac-sha256 signature when a secret is set:
+	// sha256=<hex encoded signature of the body>
+	EventHeader     = "X-Publisher-Event"
+	SignatureHeader = "X-Publisher-Signature-256"
+
+	eventPrefix = "release."
+
+	webhookTimeout    = 10 * time.Second
+	webhookRetries    = 3
+	webhookRetryDelay = 2 * time.Second
+)
+
+var (
+	ErrWebhook         = errors.New("cannot notify webhook")
+	ErrWebhookTemplate = errors.New("invalid webhook template")
+)
+
+// Event is a change in the state of a release: release.started, or release.<outcome> when it ends, i.e.
+// release.succeeded. The mark holds the artifacts written by the ended releases.
+type Event struct {
+	Type string       `json:"event"`
+	Mark release.Mark `json:"release"`
+}
+
+// NewEvent returns the event of the current state of the release of a mark.
+func NewEvent(mark release.Mark) Event {
+	return Event{Type: eventPrefix + mark.Outcome(), Mark: mark}
+}
+
+// Notifier delivers the events of the releases.
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// WebhookConfig configures the webhooks notified of the events.
+type WebhookConfig struct {
+	URLs []string
+	// Secret signs the bodies when not empty, see SignatureHeader
+	Secret string
+	// Template renders the bodies from the event, i.e. for the message format of a chat, the event as JSON when empty.
+	// Besides the template functions, json encodes a value as JSON.
+	Template string
+}
+
+// Webhooks posts the events to URLs, retrying server and network errors.
+type Webhooks struct {
+	urls       []string
+	secret     []byte
+	template   *template.Template
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+}
+
+// NewWebhooks returns a notifier posting the events to the webhooks, failing when the template can't be parsed.
+func NewWebhooks(conf WebhookConfig) (*Webhooks, error) {
+	w := &Webhooks{
+		urls:       conf.URLs,
+		secret:     []byte(conf.Secret),
+		client:     &http.Client{Timeout: webhookTimeout},
+		retries:    webhookRetries,
+		retryDelay: webhookRetryDelay,
+	}
+	if conf.Template != "" {
+		tmpl, err := template.New("webhook").Option("missingkey=error").Funcs(template.FuncMap{"json": toJSON}).Parse(conf.Template)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWebhookTemplate, err)
+		}
+		w.template = tmpl
+	}
+	return w, nil
+}
+
+// Notify posts the event to every webhook, returning the errors of the ones failing.
+func (w *Webhooks) Notify(event Event) error {
+	body, err := w.body(event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, webhookURL := range w.urls {
+		if err = w.post(webhookURL, webhookName(i, webhookURL), event.Type, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// body renders the body posted for an event.
+func (w *Webhooks) body(event Event) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(event)
+	}
+	var body bytes.Buffer
+	if err := w.template.Execute(&body, event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookTemplate, err)
+	}
+	return body.Bytes(), nil
+}
+
+// webhookName names a webhook in errors and logs by its position and host, as its URL usually holds a token.
+func webhookName(i int, webhookURL string) string {
+	if u, err := url.Parse(webhookURL); err == nil && u.Host != "" {
+		return fmt.Sprintf("webhook %d (%s)", i+1, u.Host)
+	}
+	return fmt.Sprintf("webhook %d", i+1)
+}
+
+// post sends the body to a webhook, retrying server and network errors.
+func (w *Webhooks) post(webhookURL, name, eventType string, body []byte) error {
+	var err error
+	attempt := 0
+	err = utils.Retry("webhook", func() error {
+		attempt++
+		var retry bool
+		retry, err = w.postOnce(webhookURL, name, eventType, body)
+		if err != nil && !retry {
+			return utils.NoRetry(err)
+		}
+		return err
+	}, w.retries, w.retryDelay, func() {
+		if attempt < w.retries {
+			utils.Logger.Warn("cannot notify webhook, retrying", "attempt", attempt, "error", err, "delay", w.retryDelay)
+		}
+	})
+	return err
+}
+
+// postOnce sends the body to a webhook, returning whether the request can be retried when failing.
+// The errors name the webhook instead of holding its URL.
+func (w *Webhooks) postOnce(webhookURL, name, eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid url of %s", ErrWebhook, name)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "infrastructure-publish-action/"+release.PublisherVersion)
+	req.Header.Set(EventHeader, eventType)
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return true, fmt.Errorf("%w: posting %s to %s: %v", ErrWebhook, eventType, name, err)
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%w: posting %s to %s: unexpected status %s", ErrWebhook, eventType, name, resp.Status)
+	}
+	return false, nil
+}
+
+// Sign returns the value of SignatureHeader for a body, for the receivers to check it was sent by a publisher
+// knowing the secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func toJSON(v interface{}) (string, error) {
+	content, err := json.Marshal(v)
+	return string(content), err
+}
@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// request is a webhook request received by the test server.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookServer records the requests received, answering with the statuses given in turn, then with 204.
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []request
+	statuses []int
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, request{header: r.Header, body: body})
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) received() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]request{}, s.requests...)
+}
+
+func newTestWebhooks(t *testing.T, conf WebhookConfig) *Webhooks {
+	w, err := NewWebhooks(conf)
+	require.NoError(t, err)
+	w.retryDelay = 0
+	return w
+}
+
+var endedMark = release.Mark{
+	ReleaseInfo: release.ReleaseInfo{AppName: "nri-foo", Tag: "v1.2.3", RunID: "42"},
+	Start:       release.CustomTime{Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+	End:         release.CustomTime{Time: time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC)},
+	Status:      release.StatusSucceeded,
+	Artifacts:   []release.Artifact{{Key: "infrastructure_agent/binaries/nri-foo_1.2.3.tar.gz", Size: 3, SHA256: "abc"}},
+}
+
+func TestWebhooks_Notify(t *testing.T) {
+	first, second := newWebhookServer(t), newWebhookServer(t)
+	w := newTestWebhooks(t, WebhookConfig{URLs: []string{first.URL, second.URL}, Secret: "s3cr3t"})
+
+	require.NoError(t, w.Notify(NewEvent(endedMark)))
+
+	for _, server := range []*webhookServer{first, second} {
+		requests := server.received()
+		require.Len(t, requests, 1)
+		req := requests[0]
+		assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+		assert.Equal(t, "release.succeeded", req.header.Get(EventHeader))
+		assert.Equal(t, Sign([]byte("s3cr3t"), req.body), req.header.Get(SignatureHeader))
+
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal(req.body, &payload))
+		assert.Equal(t, "release.succeeded", payload["event"])
+		mark := payload["release"].(map[string]interface{})
+		assert.Equal(t, "nri-foo", mark["app_name"])
+		assert.Equal(t, "2024-05-01T10:05:00Z", mark["end"])
+		assert.Len(t, mark["artifacts"], 1)
+	}
+}
+
+func TestWebhooks_Notify_unsigned(t *testing.T) {
+	server := newWebhookServer(t)
+	w := newTestWebhooks(t, WebhookConfig{URLs: []string{server.URL}})
+
+	require.NoError(t, w.Notify(NewEvent(endedMark)))
+	require.Len(t, server.received(), 1)
+	assert.Empty(t, server.received()[0].header.Get(SignatureHeader))
+}
+
+func TestWebhooks_Notify_template(t *testing.T) {
+	server := newWebhookServer(t)
+	w := newTestWebhooks(t, WebhookConfig{
+		URLs:     []string{server.URL},
+		Template: `{"text": {{ json (printf "%s %s %s, %d artifacts" .Mark.AppName .Mark.Tag .Mark.Outcome (len .Mark.Artifacts)) }}}`,
+	})
+
+	require.NoError(t, w.Notify(NewEvent(endedMark)))
+	require.Len(t, server.received(), 1)
+	assert.JSONEq(t, `{"text": "nri-foo v1.2.3 succeeded, 1 artifacts"}`, string(server.received()[0].body))
+}
+
+func TestNewWebhooks_invalidTemplate(t *testing.T) {
+	_, err := NewWebhooks(WebhookConfig{Template: "{{ .Mark.AppName "})
+	assert.ErrorIs(t, err, ErrWebhookTemplate)
+
+	w := newTestWebhooks(t, WebhookConfig{Template: "{{ .Unknown }}"})
+	assert.ErrorIs(t, w.Notify(NewEvent(endedMark)), ErrWebhookTemplate)
+}
+
+func TestWebhooks_Notify_retries(t *testing.T) {
+	server := newWebhookServer(t, http.StatusBadGateway, http.StatusTooManyRequests)
+	w := newTestWebhooks(t, WebhookConfig{URLs: []string{server.URL}})
+
+	require.NoError(t, w.Notify(NewEvent(endedMark)))
+	assert.Len(t, server.received(), 3)
+
+	failing := newWebhookServer(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	w = newTestWebhooks(t, WebhookConfig{URLs: []string{failing.URL, server.URL}})
+	assert.ErrorIs(t, w.Notify(NewEvent(endedMark)), ErrWebhook)
+	assert.Len(t, failing.received(), 3)
+	assert.Len(t, server.received(), 4, "the other webhooks are still notified")
+
+	rejecting := newWebhookServer(t, http.StatusBadRequest)
+	w = newTestWebhooks(t, WebhookConfig{URLs: []string{rejecting.URL}})
+	assert.ErrorIs(t, w.Notify(NewEvent(endedMark)), ErrWebhook)
+	assert.Len(t, rejecting.received(), 1, "client errors are not retried")
+}
+
+func TestWebhooks_Notify_redactsURLs(t *testing.T) {
+	rejecting := newWebhookServer(t, http.StatusBadRequest)
+	closed := newWebhookServer(t)
+	closed.Close()
+	w := newTestWebhooks(t, WebhookConfig{URLs: []string{rejecting.URL + "/hooks/t0k3n", closed.URL + "/hooks/t0k3n"}})
+
+	err := w.Notify(NewEvent(endedMark))
+	require.ErrorIs(t, err, ErrWebhook)
+	assert.NotContains(t, err.Error(), "t0k3n")
+	assert.Contains(t, err.Error(), "webhook 1 ("+strings.TrimPrefix(rejecting.URL, "http://")+")")
+	assert.Contains(t, err.Error(), "webhook 2 (")
+}
+
+func TestMarker(t *testing.T) {
+	server := newWebhookServer(t)
+	var logs bytes.Buffer
+	logger := utils.NewLogger(&logs, utils.LogFormatText, slog.LevelInfo)
+	m := NewMarker(release.NewMarkerInMemory(), newTestWebhooks(t, WebhookConfig{URLs: []string{server.URL}}), logger)
+
+	mark, err := m.Start(release.ReleaseInfo{AppName: "nri-foo", Tag: "v1.2.3", RunID: "42"})
+	require.NoError(t, err)
+	mark.Status = release.StatusFailed
+	mark.Error = "cannot upload"
+	mark.Artifacts = endedMark.Artifacts
+	require.NoError(t, m.End(mark))
+
+	requests := server.received()
+	require.Len(t, requests, 2)
+	var started, ended Event
+	require.NoError(t, json.Unmarshal(requests[0].body, &started))
+	require.NoError(t, json.Unmarshal(requests[1].body, &ended))
+	assert.Equal(t, "release.started", started.Type)
+	assert.True(t, started.Mark.End.IsZero())
+	assert.Equal(t, "release.failed", ended.Type)
+	assert.Equal(t, "cannot upload", ended.Mark.Error)
+	assert.False(t, ended.Mark.End.IsZero())
+	assert.Equal(t, endedMark.Artifacts, ended.Mark.Artifacts)
+	assert.Empty(t, logs.String())
+
+	marks, err := m.List(release.Filter{AppName: "nri-foo"})
+	require.NoError(t, err)
+	require.Len(t, marks, 1)
+	assert.Equal(t, release.StatusFailed, marks[0].Outcome())
+}
+
+func TestMarker_notifyFailure(t *testing.T) {
+	server := newWebhookServer(t, http.StatusBadRequest, http.StatusBadRequest)
+	var logs bytes.Buffer
+	logger := utils.NewLogger(&logs, utils.LogFormatText, slog.LevelInfo)
+	m := NewMarker(release.NewMarkerInMemory(), newTestWebhooks(t, WebhookConfig{URLs: []string{server.URL}}), logger)
+
+	mark, err := m.Start(release.ReleaseInfo{AppName: "nri-foo", Tag: "v1.2.3"})
+	require.NoError(t, err)
+	mark.Status = release.StatusSucceeded
+	require.NoError(t, m.End(mark))
+	assert.Equal(t, 2, strings.Count(logs.String(), "level=WARN msg=\"cannot notify release event\""))
+
+	// ending twice fails, but the outcome is still notified
+	assert.ErrorIs(t, m.End(mark), release.ErrLastMarkerEnded)
+	assert.Len(t, server.received(), 3)
+}
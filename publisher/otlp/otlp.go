@@ -0,0 +1,134 @@
+// Package otlp sends telemetry to an OpenTelemetry collector with the OTLP/HTTP protocol, JSON encoded, so no
+// SDK is required by the publisher.
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ServiceName identifies the publisher in the resource of the telemetry.
+	ServiceName = "infrastructure-publish-action"
+	// ScopeName identifies the instrumentation of the telemetry.
+	ScopeName = "github.com/newrelic/infrastructure-publish-action/publisher"
+
+	MetricsPath = "/v1/metrics"
+	TracesPath  = "/v1/traces"
+
+	requestTimeout = 30 * time.Second
+)
+
+var ErrExport = errors.New("cannot export to the otlp endpoint")
+
+// AnyValue is the value of an attribute, only strings and numbers are used.
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// KeyValue is an attribute of a resource, metric data point or span.
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// String returns a string attribute.
+func String(key, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: &value}}
+}
+
+// Int returns an integer attribute, encoded as a string as 64 bits integers are in JSON.
+func Int(key string, value int64) KeyValue {
+	s := strconv.FormatInt(value, 10)
+	return KeyValue{Key: key, Value: AnyValue{IntValue: &s}}
+}
+
+// Resource describes the entity producing the telemetry.
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// NewResource returns the resource of the publisher, with the attributes given.
+func NewResource(attrs ...KeyValue) Resource {
+	return Resource{Attributes: append([]KeyValue{String("service.name", ServiceName)}, attrs...)}
+}
+
+// Scope is the instrumentation scope of the telemetry.
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// UnixNano formats a time as the nanoseconds since the epoch, encoded as a string as 64 bits integers are in JSON.
+func UnixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// Client posts telemetry to a collector.
+type Client struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewClient returns a client of the collector at the endpoint, the base url the signal paths are appended to,
+// sending the headers, i.e. for authentication, in every request.
+func NewClient(endpoint string, headers map[string]string) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		headers:  headers,
+		client:   &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Export posts the payload to the path of the signal, MetricsPath or TracesPath.
+func (c *Client) Export(path string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExport, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExport, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s %s: %s", ErrExport, req.URL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ParseHeaders parses headers given as comma separated name=value pairs, as OTEL_EXPORTER_OTLP_HEADERS.
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, errors.New("invalid header, expected name=value pairs")
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
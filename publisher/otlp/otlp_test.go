@@ -0,0 +1,22 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("api-key=abc, X-Tenant = foo=bar,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"api-key": "abc", "X-Tenant": "foo=bar"}, headers)
+
+	headers, err = ParseHeaders("")
+	require.NoError(t, err)
+	assert.Empty(t, headers)
+
+	_, err = ParseHeaders("api-key")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "api-key", "header values may be secrets")
+}
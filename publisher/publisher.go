@@ -3,20 +3,29 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/newrelic/infrastructure-publish-action/publisher/config"
 	"github.com/newrelic/infrastructure-publish-action/publisher/download"
 	"github.com/newrelic/infrastructure-publish-action/publisher/lock"
+	"github.com/newrelic/infrastructure-publish-action/publisher/metrics"
+	"github.com/newrelic/infrastructure-publish-action/publisher/notify"
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
 	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+	"github.com/newrelic/infrastructure-publish-action/publisher/report"
+	"github.com/newrelic/infrastructure-publish-action/publisher/trace"
 	"github.com/newrelic/infrastructure-publish-action/publisher/upload"
-	"log"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
-	defaultLockRetries = 30
-
 	// AWS lock resource tags
 	defaultTagOwningTeam = "CAOS"
 	defaultTagProduct    = "integrations"
@@ -33,44 +42,109 @@ var (
 	)
 )
 
-var (
-	l = log.New(log.Writer(), "", 0)
-)
-
 func main() {
-	conf, err := config.LoadConfig()
+	cmd, args, err := findCommand(os.Args[1:])
+	if err == nil {
+		err = cmd.run(args)
+	}
+	if errors.Is(err, ErrUnknownCommand) {
+		utils.Logger.Error(err.Error())
+		_ = help(nil)
+		os.Exit(2)
+	}
+	if err != nil {
+		utils.Logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// setupLogger replaces the default logger with the one configured, logging the app and run of the release.
+func setupLogger(conf config.Config) error {
+	level, err := utils.ParseLogLevel(conf.LogLevel)
+	if err != nil {
+		return err
+	}
+	logger := utils.NewLogger(os.Stderr, conf.LogFormat, level)
+	if conf.AppName != "" {
+		logger = logger.With("app", conf.AppName)
+	}
+	if conf.RunID != "" {
+		logger = logger.With("run_id", conf.RunID)
+	}
+	utils.SetLogger(logger)
+	return nil
+}
+
+// publish downloads the artifacts described by the schema and uploads them into the repositories.
+func publish(args []string) (err error) {
+	start := time.Now()
+	span := trace.Start("publish")
+	endPhase := startPhase(utils.PhaseConfig)
+	var conf config.Config
+	loaded := false
+	defer func() {
+		endPhase(err)
+		span.End(err)
+		// without config there's nowhere to export to
+		if loaded {
+			exportMetrics(conf, start, err)
+			exportTraces(conf)
+		}
+	}()
+	if conf, err = loadConfig("publish", args); err != nil {
+		return err
+	}
+	loaded = true
+	span.SetAttributes(otlp.String("app", conf.AppName), otlp.String("tag", conf.Tag), otlp.String("version", conf.Version))
+	if conf.Traceparent != "" {
+		if err := trace.Default.SetParent(conf.Traceparent); err != nil {
+			utils.Logger.Warn("cannot continue the trace of the workflow", "error", err)
+		}
+	}
+
+	uploadSchemas, err := parseSchema(&conf)
 	if err != nil {
-		l.Fatal("loading config: " + err.Error())
+		return err
+	}
+	// validate schemas
+	if err = config.ValidateSchemas(conf.AppName, uploadSchemas); err != nil {
+		return err
+	}
+	// route uploads of release candidates
+	if conf.IsPrerelease() {
+		utils.Logger.Info("tag is a prerelease, applying prerelease uploads", "tag", conf.Tag)
+	}
+	uploadSchemas = uploadSchemas.ForRelease(conf.IsPrerelease())
+	// validate the config required by the schema and publishing mode
+	if err = conf.Validate(uploadSchemas); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	// render every path before publishing anything, so placeholders left by typos don't end in the bucket
+	if _, err = upload.Plan(conf, uploadSchemas); err != nil {
+		return err
 	}
 
 	releaseMarker, err := newReleaseMarker(conf)
 	if err != nil {
-		l.Fatal("creating release marker: " + err.Error())
+		return fmt.Errorf("creating release marker: %w", err)
+	}
+	if len(conf.WebhookURLs) > 0 {
+		if releaseMarker, err = newNotifyingMarker(conf, releaseMarker); err != nil {
+			return err
+		}
 	}
+	releaseMarker = trace.NewMarker(releaseMarker, trace.Default)
 
 	var bucketLock lock.BucketLock
 	if conf.DisableLock {
 		bucketLock = lock.NewNoop()
 	} else {
-		if conf.AwsRegion == "" {
-			l.Fatal("missing 'aws_region' value")
-		}
-		if conf.AwsLockBucket == "" {
-			l.Fatal("missing 'aws_s3_lock_bucket_name' value")
-		}
-		if conf.AwsRoleARN == "" {
-			l.Fatal("missing 'aws_role_arn' value")
-		}
-		if conf.RunID == "" {
-			l.Fatal("missing 'run_id' value")
-		}
-
 		if conf.AwsTags == "" {
 			conf.AwsTags = defaultTags
 		}
 
 		if conf.UseDefLockRetries {
-			conf.LockRetries = defaultLockRetries
+			conf.LockRetries = config.DefaultLockRetries
 		}
 		cfg := lock.NewS3Config(
 			conf.AwsLockBucket,
@@ -84,52 +158,228 @@ func main() {
 			lock.DefaultTTL,
 		)
 		var err error
-		bucketLock, err = lock.NewS3(cfg, l.Printf)
+		bucketLock, err = lock.NewS3(cfg, utils.Logger.With("component", "lock"))
 		// fail fast when lacking required AWS credentials
 		if err != nil {
-			l.Fatal("cannot create lock on s3: " + err.Error())
+			return fmt.Errorf("cannot create lock on s3: %w", err)
 		}
 	}
 
-	uploadSchemas, err := config.ParseUploadSchemasFile(conf.UploadSchemaFilePath)
-	if err != nil {
-		l.Fatal(err)
-	}
-	// validate schemas
-	if err = config.ValidateSchemas(conf.AppName, uploadSchemas); err != nil {
-		l.Fatal(err)
-	}
-
+	// check every expected source file exists before taking the lock, so a typo in the schema
+	// cannot leave repositories half published
+	endPhase(nil)
+	endPhase = startPhase(utils.PhasePreflight)
 	if conf.LocalPackagesPath == "" {
 		d := download.NewDownloader(http.DefaultClient)
+		if err = d.CheckArtifacts(conf, uploadSchemas); err != nil {
+			return err
+		}
+		utils.Logger.Info("🎉 pre-flight phase complete")
+
+		endPhase(nil)
+		endPhase = startPhase(utils.PhaseDownload)
 		err = d.DownloadArtifacts(conf, uploadSchemas)
 		if err != nil {
-			l.Fatal(err)
+			return err
 		}
-		l.Println("🎉 download phase complete")
+		utils.Logger.Info("🎉 download phase complete")
 	} else {
 		conf.ArtifactsSrcFolder = conf.LocalPackagesPath
+		if err = download.CheckLocalArtifacts(conf, uploadSchemas); err != nil {
+			return err
+		}
+		utils.Logger.Info("🎉 pre-flight phase complete")
 	}
 
-	err = upload.UploadArtifacts(conf, uploadSchemas, bucketLock, releaseMarker)
+	endPhase(nil)
+	endPhase = startPhase(utils.PhaseUpload)
+	var rep report.Report
+	err = upload.UploadArtifacts(conf, uploadSchemas, bucketLock, releaseMarker, &rep)
+	// the report of failed releases is the most useful one
+	if rep.Status != "" {
+		writeReport(conf, rep)
+	}
 	if err != nil {
-		l.Fatal(err)
+		return err
 	}
-	l.Println("🎉 upload phase complete")
+	utils.Logger.Info("🎉 upload phase complete")
+	return nil
+}
+
+// startPhase starts a phase of the publishing, logged, measured and traced. The function returned records its
+// duration and ends its span, failed when err is not nil.
+func startPhase(phase string) func(err error) {
+	utils.SetPhase(phase)
+	recordDuration := metrics.StartPhase(phase)
+	span := trace.Start(phase)
+	return func(err error) {
+		recordDuration()
+		span.End(err)
+	}
+}
+
+// exportMetrics exports the metrics of the publishing to the file, Pushgateway and OpenTelemetry collector
+// configured. Failing to export them doesn't fail the release.
+func exportMetrics(conf config.Config, start time.Time, err error) {
+	metrics.RunDuration.Set(time.Since(start).Seconds())
+	metrics.RunSucceeded.Set(1)
+	if err != nil {
+		metrics.RunSucceeded.Set(0)
+	}
+	metrics.RunTimestamp.Set(float64(time.Now().Unix()))
+
+	// releases of an app replace the metrics of the previous one, the tag and run are only resource attributes
+	app := metrics.Label{Name: "app", Value: conf.AppName}
+	if conf.MetricsPath != "" {
+		if err := metrics.Default.WriteFile(conf.MetricsPath, app); err != nil {
+			utils.Logger.Warn("cannot write metrics", "path", conf.MetricsPath, "error", err)
+		} else {
+			utils.Logger.Info("metrics written", "path", conf.MetricsPath)
+		}
+	}
+	if conf.MetricsPushgatewayURL != "" {
+		if err := metrics.Default.Push(http.DefaultClient, conf.MetricsPushgatewayURL, app); err != nil {
+			utils.Logger.Warn("cannot push metrics", "error", err)
+		}
+	}
+	if conf.OtlpEndpoint != "" {
+		client, err := newOtlpClient(conf)
+		if err == nil {
+			err = metrics.Default.ExportOTLP(client, app,
+				metrics.Label{Name: "tag", Value: conf.Tag},
+				metrics.Label{Name: "run_id", Value: conf.RunID})
+		}
+		if err != nil {
+			utils.Logger.Warn("cannot export metrics", "error", err)
+		}
+	}
+}
+
+// exportTraces exports the spans of the publishing to the OpenTelemetry collector configured. Failing to export
+// them doesn't fail the release.
+func exportTraces(conf config.Config) {
+	if conf.OtlpEndpoint == "" {
+		return
+	}
+	client, err := newOtlpClient(conf)
+	if err == nil {
+		err = trace.Default.ExportOTLP(client,
+			otlp.String("app", conf.AppName),
+			otlp.String("tag", conf.Tag),
+			otlp.String("run_id", conf.RunID))
+	}
+	if err != nil {
+		utils.Logger.Warn("cannot export traces", "error", err)
+	}
+}
+
+func newOtlpClient(conf config.Config) (*otlp.Client, error) {
+	headers, err := otlp.ParseHeaders(conf.OtlpHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("otlp_headers: %w", err)
+	}
+	return otlp.NewClient(conf.OtlpEndpoint, headers), nil
+}
+
+// writeReport writes the report of the uploads as JSON to report_path, and as Markdown to the summary of the
+// workflow run. Failing to write it doesn't fail the release.
+func writeReport(conf config.Config, rep report.Report) {
+	if conf.ReportPath != "" {
+		if err := writeReportFile(conf.ReportPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, rep.WriteJSON); err != nil {
+			utils.Logger.Warn("cannot write report", "path", conf.ReportPath, "error", err)
+		} else {
+			utils.Logger.Info("report written", "path", conf.ReportPath)
+		}
+	}
+	if conf.GithubStepSummary != "" {
+		if err := writeReportFile(conf.GithubStepSummary, os.O_CREATE|os.O_APPEND|os.O_WRONLY, rep.WriteMarkdown); err != nil {
+			utils.Logger.Warn("cannot write step summary", "path", conf.GithubStepSummary, "error", err)
+		}
+	}
+}
+
+func writeReportFile(path string, flag int, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseSchema fetches and parses the schema of the configuration, checking its checksum when set. The checksums
+// of the fetched schema file and of the resolved schema are kept in the configuration, to be recorded in the
+// release marker.
+func parseSchema(conf *config.Config) (config.UploadArtifactSchemas, error) {
+	location, err := conf.SchemaLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	fetcher := config.NewSchemaFetcher(conf.SchemaCacheDir, conf.GithubToken)
+	source, err := fetcher.Fetch(location, conf.SchemaSHA256)
+	if err != nil {
+		return nil, err
+	}
+	conf.SchemaSHA256 = source.SHA256
+
+	uploadSchemas, resolvedSHA256, err := fetcher.ParseUploadSchemas(source, conf.SchemaUnknownFields != config.UnknownFieldsWarn)
+	if err != nil {
+		return nil, err
+	}
+	conf.SchemaResolvedSHA256 = resolvedSHA256
+	return uploadSchemas, nil
 }
 
 func newReleaseMarker(conf config.Config) (release.Marker, error) {
-	// We'll leave the release marker file in the root of the repository
+	switch conf.ReleaseMarker {
+	case config.ReleaseMarkerDir:
+		dir := conf.ReleaseMarkerDir
+		if dir == "" {
+			dir = conf.ArtifactsDestFolder
+		}
+		// same layout as in the bucket
+		return release.NewMarkerDir(filepath.Join(dir, releaseMarkerS3Config(conf).Directory), markerLogger()), nil
+	case config.ReleaseMarkerMemory:
+		return release.NewMarkerInMemory(), nil
+	}
+	return release.NewMarkerAWS(releaseMarkerS3Config(conf), markerLogger())
+}
+
+// newNotifyingMarker wraps the release marker to post the start and end of the release to the webhooks.
+func newNotifyingMarker(conf config.Config, releaseMarker release.Marker) (release.Marker, error) {
+	webhookConf := notify.WebhookConfig{URLs: conf.WebhookURLs, Secret: conf.WebhookSecret}
+	if conf.WebhookTemplate != "" {
+		content, err := os.ReadFile(conf.WebhookTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("reading webhook template: %w", err)
+		}
+		webhookConf.Template = string(content)
+	}
+	webhooks, err := notify.NewWebhooks(webhookConf)
+	if err != nil {
+		return nil, err
+	}
+	return notify.NewMarker(releaseMarker, webhooks, utils.Logger.With("component", "notify")), nil
+}
+
+func releaseMarkerS3Config(conf config.Config) release.S3Config {
+	// We'll leave the release markers in the root of the repository
 	// i.e.
 	// repo = /infrastructure_agent/linux/apt/
-	// release marker = /infrastructure_agent/releases.json
+	// release markers = /infrastructure_agent/releases/<app>/<start>-<run_id>.json
 	repoRootDir := strings.Split(strings.TrimPrefix(conf.DestPrefix, "/"), "/")[0]
-	markerS3Conf := release.S3Config{
+	return release.S3Config{
 		Bucket:    conf.AwsBucket,
 		RoleARN:   conf.AwsRoleARN,
 		Region:    conf.AwsRegion,
 		Directory: repoRootDir,
 	}
+}
 
-	return release.NewMarkerAWS(markerS3Conf, l.Printf)
+func markerLogger() *slog.Logger {
+	return utils.Logger.With("component", "marker")
 }
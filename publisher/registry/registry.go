@@ -0,0 +1,124 @@
+// Package registry holds the named schemas bundled with the publisher, selected with the schema setting.
+//
+// Schemas are versioned, every version being a file in schemas/<name>/<version>.yml. A change to the layout of a
+// schema is published as a new version, so the integrations using it keep publishing where they did until they
+// opt in, i.e. schema: ohi@2. Names without version are the first one.
+package registry
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// LocationPrefix marks a file of the registry, i.e. builtin://ohi/1.yml, includes are relative to it.
+	LocationPrefix = "builtin://"
+
+	schemasDir       = "schemas"
+	versionSeparator = "@"
+	defaultVersion   = 1
+)
+
+var ErrUnknownSchema = errors.New("unknown schema")
+
+//go:embed schemas
+var files embed.FS
+
+// Schema is a version of a named schema.
+type Schema struct {
+	Name    string
+	Version int
+}
+
+func (s Schema) String() string {
+	return fmt.Sprintf("%s%s%d", s.Name, versionSeparator, s.Version)
+}
+
+// Location returns the location of the schema file, to be read with ReadFile.
+func (s Schema) Location() string {
+	return LocationPrefix + path.Join(s.Name, strconv.Itoa(s.Version)+".yml")
+}
+
+// List returns every version of the schemas, sorted by name and version.
+func List() ([]Schema, error) {
+	var schemas []Schema
+	err := fs.WalkDir(files, schemasDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// files directly in the schemas folder, or not named after a version, are included by the schemas
+		name, base := path.Split(strings.TrimPrefix(file, schemasDir+"/"))
+		version, err := strconv.Atoi(strings.TrimSuffix(base, ".yml"))
+		if name == "" || err != nil {
+			return nil
+		}
+		schemas = append(schemas, Schema{Name: strings.TrimSuffix(name, "/"), Version: version})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(schemas, func(i, j int) bool {
+		if schemas[i].Name != schemas[j].Name {
+			return schemas[i].Name < schemas[j].Name
+		}
+		return schemas[i].Version < schemas[j].Version
+	})
+	return schemas, nil
+}
+
+// Lookup returns the schema with a name, optionally versioned, i.e. ohi or ohi@2.
+func Lookup(name string) (Schema, error) {
+	schema := Schema{Name: name, Version: defaultVersion}
+	if base, version, ok := strings.Cut(name, versionSeparator); ok {
+		v, err := strconv.Atoi(version)
+		if err != nil || v < 1 {
+			return Schema{}, fmt.Errorf("%w: %s, the version should be a positive number", ErrUnknownSchema, name)
+		}
+		schema = Schema{Name: base, Version: v}
+	}
+
+	schemas, err := List()
+	if err != nil {
+		return Schema{}, err
+	}
+	var versions []string
+	for _, s := range schemas {
+		if s == schema {
+			return schema, nil
+		}
+		if s.Name == schema.Name {
+			versions = append(versions, s.String())
+		}
+	}
+	if len(versions) > 0 {
+		return Schema{}, fmt.Errorf("%w: %s, available versions: %s", ErrUnknownSchema, name, strings.Join(versions, ", "))
+	}
+	return Schema{}, fmt.Errorf("%w: %s, see 'publisher schema list'", ErrUnknownSchema, name)
+}
+
+// IsLocation returns whether the location is a file of the registry.
+func IsLocation(location string) bool {
+	return strings.HasPrefix(location, LocationPrefix)
+}
+
+// ReadFile reads a file of the registry.
+func ReadFile(location string) ([]byte, error) {
+	content, err := files.ReadFile(path.Join(schemasDir, strings.TrimPrefix(location, LocationPrefix)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: no file %s", ErrUnknownSchema, location)
+	}
+	return content, err
+}
+
+// IncludeLocation resolves an include relative to a file of the registry.
+func IncludeLocation(including, included string) string {
+	return LocationPrefix + path.Join(path.Dir(strings.TrimPrefix(including, LocationPrefix)), included)
+}
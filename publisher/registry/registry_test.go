@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	schemas, err := List()
+	require.NoError(t, err)
+
+	assert.Contains(t, schemas, Schema{Name: "ohi", Version: 1})
+	assert.Contains(t, schemas, Schema{Name: "nrjmx-fips", Version: 1})
+	for _, schema := range schemas {
+		assert.NotEqual(t, "include", schema.Name)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Schema
+		err      string
+	}{
+		{name: "ohi", expected: Schema{Name: "ohi", Version: 1}},
+		{name: "ohi@1", expected: Schema{Name: "ohi", Version: 1}},
+		{name: "ohi@99", err: "unknown schema: ohi@99, available versions: ohi@1"},
+		{name: "ohi@latest", err: "unknown schema: ohi@latest, the version should be a positive number"},
+		{name: "foo", err: "unknown schema: foo, see 'publisher schema list'"},
+		{name: "include", err: "unknown schema: include, see 'publisher schema list'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := Lookup(tt.name)
+			if tt.err != "" {
+				assert.ErrorIs(t, err, ErrUnknownSchema)
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, schema)
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	schema := Schema{Name: "ohi", Version: 1}
+	assert.Equal(t, "builtin://ohi/1.yml", schema.Location())
+
+	content, err := ReadFile(schema.Location())
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "../include/os-sets.yml")
+
+	include := IncludeLocation(schema.Location(), "../include/os-sets.yml")
+	assert.Equal(t, "builtin://include/os-sets.yml", include)
+	_, err = ReadFile(include)
+	require.NoError(t, err)
+
+	_, err = ReadFile("builtin://ohi/2.yml")
+	assert.ErrorIs(t, err, ErrUnknownSchema)
+}
@@ -0,0 +1,87 @@
+package release
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// listedMark is a mark as written by WriteMarks in JSON.
+type listedMark struct {
+	*Mark
+	NeverEnded bool `json:"never_ended,omitempty"`
+}
+
+// WriteMarks writes the marks as a table, JSON or CSV, flagging the ones never ended.
+func WriteMarks(w io.Writer, marks []Mark, format string) error {
+	switch format {
+	case FormatTable:
+		return writeMarksTable(w, marks)
+	case FormatJSON:
+		listed := make([]listedMark, 0, len(marks))
+		for i := range marks {
+			listed = append(listed, listedMark{Mark: &marks[i], NeverEnded: marks[i].NeverEnded()})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	case FormatCSV:
+		return writeMarksCSV(w, marks)
+	}
+	return fmt.Errorf("%w: '%s', valid formats: %s, %s, %s", ErrUnknownFormat, format, FormatTable, FormatJSON, FormatCSV)
+}
+
+func writeMarksTable(w io.Writer, marks []Mark) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "APP\tTAG\tRUN ID\tSTART\tEND\tSTATUS")
+	for _, mark := range marks {
+		end := formatEnd(mark)
+		if end == "" {
+			end = "never ended"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", mark.AppName, mark.Tag, mark.RunID, mark.Start.Format(ctLayout), end, mark.Outcome())
+	}
+	return tw.Flush()
+}
+
+func writeMarksCSV(w io.Writer, marks []Mark) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"app_name", "tag", "run_id", "start", "end", "status", "never_ended", "error", "repo_name", "schema", "publisher_version"})
+	for _, mark := range marks {
+		cw.Write([]string{
+			mark.AppName,
+			mark.Tag,
+			mark.RunID,
+			mark.Start.Format(ctLayout),
+			formatEnd(mark),
+			mark.Outcome(),
+			strconv.FormatBool(mark.NeverEnded()),
+			mark.Error,
+			mark.RepoName,
+			mark.Schema,
+			mark.PublisherVersion,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatEnd returns the end of the mark, empty when never ended.
+func formatEnd(mark Mark) string {
+	if mark.NeverEnded() {
+		return ""
+	}
+	return mark.End.Format(ctLayout)
+}
@@ -0,0 +1,63 @@
+package release
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMarks() []Mark {
+	return []Mark{
+		{
+			ReleaseInfo: ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.0", RunID: "13549016185", RepoName: "newrelic/nri-redis", Schema: "ohi"},
+			Start:       CustomTime{time.Date(2025, 2, 26, 16, 57, 33, 0, time.UTC)},
+			End:         CustomTime{time.Date(2025, 2, 26, 16, 58, 47, 0, time.UTC)},
+			Status:      StatusSucceeded,
+		},
+		{
+			ReleaseInfo: ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.1", RunID: "13549016186", RepoName: "newrelic/nri-redis", Schema: "ohi"},
+			Start:       CustomTime{time.Date(2025, 2, 27, 10, 0, 0, 0, time.UTC)},
+			Status:      StatusStarted,
+		},
+	}
+}
+
+func TestWriteMarks_table(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteMarks(&out, testMarks(), FormatTable))
+
+	expected := "" +
+		"APP        TAG     RUN ID       START                 END                   STATUS\n" +
+		"nri-redis  v1.9.0  13549016185  2025-02-26T16:57:33Z  2025-02-26T16:58:47Z  succeeded\n" +
+		"nri-redis  v1.9.1  13549016186  2025-02-27T10:00:00Z  never ended           started\n"
+	assert.Equal(t, expected, out.String())
+}
+
+func TestWriteMarks_csv(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteMarks(&out, testMarks(), FormatCSV))
+
+	expected := "" +
+		"app_name,tag,run_id,start,end,status,never_ended,error,repo_name,schema,publisher_version\n" +
+		"nri-redis,v1.9.0,13549016185,2025-02-26T16:57:33Z,2025-02-26T16:58:47Z,succeeded,false,,newrelic/nri-redis,ohi,\n" +
+		"nri-redis,v1.9.1,13549016186,2025-02-27T10:00:00Z,,started,true,,newrelic/nri-redis,ohi,\n"
+	assert.Equal(t, expected, out.String())
+}
+
+func TestWriteMarks_json(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteMarks(&out, testMarks()[1:], FormatJSON))
+
+	assert.JSONEq(t, `[{
+		"app_name": "nri-redis", "tag": "v1.9.1", "run_id": "13549016186", "repo_name": "newrelic/nri-redis", "schema": "ohi", "schema_url": "",
+		"start": "2025-02-27T10:00:00Z", "end": "0001-01-01T00:00:00Z", "status": "started", "never_ended": true
+	}]`, out.String())
+}
+
+func TestWriteMarks_unknownFormat(t *testing.T) {
+	err := WriteMarks(&bytes.Buffer{}, testMarks(), "yaml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -2,9 +2,24 @@ package release
 
 import (
 	"encoding/json"
+	"path"
+	"sort"
 	"time"
 )
 
+const (
+	// StatusStarted is the status of a release being published, or stopped without ending its mark
+	StatusStarted   = "started"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	// StatusAborted is the status of a release stopped by a panic
+	StatusAborted = "aborted"
+)
+
+// PublisherVersion is the version of the publisher recorded in the marks, set at build time with
+// -ldflags "-X github.com/newrelic/infrastructure-publish-action/publisher/release.PublisherVersion=v1.2.3".
+var PublisherVersion = "dev"
+
 type ReleaseInfo struct {
 	AppName   string `json:"app_name"`
 	Tag       string `json:"tag"`
@@ -12,21 +27,164 @@ type ReleaseInfo struct {
 	RepoName  string `json:"repo_name"`
 	Schema    string `json:"schema"`
 	SchemaURL string `json:"schema_url"`
+	// SchemaSHA256 is the checksum of the schema file used, identifying it even when the url content changes
+	SchemaSHA256 string `json:"schema_sha256,omitempty"`
+	// SchemaResolvedSHA256 is the checksum of the schema with its includes resolved, changing with them
+	SchemaResolvedSHA256 string `json:"schema_resolved_sha256,omitempty"`
+	PublisherVersion     string `json:"publisher_version,omitempty"`
+}
+
+// Artifact is a file written into the bucket by a release.
+type Artifact struct {
+	// Key is the path of the file in the bucket
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
 }
 
 // Mark represents a release mark. It will contain the name of the release (appName, tag...)
 // and the start and end of a release
 // When the release has been started, the end will be zero
+// Ended marks record the outcome of the release, with the error when failed, and the artifacts written
 type Mark struct {
 	ReleaseInfo
-	Start CustomTime `json:"start"`
-	End   CustomTime `json:"end"`
+	Start     CustomTime `json:"start"`
+	End       CustomTime `json:"end"`
+	Status    string     `json:"status,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+}
+
+// StatusEnded is the outcome of the marks ended before their status was recorded
+const StatusEnded = "ended"
+
+// Outcome returns the status of the release, derived from the end for marks without one.
+func (m Mark) Outcome() string {
+	switch {
+	case m.End.IsZero():
+		return StatusStarted
+	case m.Status == "" || m.Status == StatusStarted:
+		return StatusEnded
+	default:
+		return m.Status
+	}
+}
+
+// NeverEnded returns whether the release was started but not ended, because it's still being published or its
+// run crashed or was cancelled.
+func (m Mark) NeverEnded() bool {
+	return m.End.IsZero()
+}
+
+// Filter selects marks, empty fields select any.
+type Filter struct {
+	AppName string
+	Tag     string
+	// Since and Until bound the start of the release
+	Since  time.Time
+	Until  time.Time
+	Status string
+}
+
+// Matches returns whether the filter selects the mark.
+func (f Filter) Matches(m Mark) bool {
+	return (f.AppName == "" || f.AppName == m.AppName) &&
+		(f.Tag == "" || f.Tag == m.Tag) &&
+		(f.Since.IsZero() || !m.Start.Before(f.Since)) &&
+		(f.Until.IsZero() || m.Start.Before(f.Until)) &&
+		(f.Status == "" || f.Status == m.Outcome())
 }
 
 // Marker abstracts the persistence of the start and end of a release
 type Marker interface {
 	Start(releaseInfo ReleaseInfo) (Mark, error)
 	End(mark Mark) error
+	// List returns the marks selected by the filter, sorted by start
+	List(filter Filter) ([]Mark, error)
+}
+
+// Migrator maintains the legacy marker file, releases.json, holding the marks of every release in a single
+// array before they were kept one per object.
+type Migrator interface {
+	// Migrate copies the marks of the legacy file to their own objects, skipping the ones already copied, and
+	// returns how many were copied.
+	Migrate() (int, error)
+	// WriteView writes the legacy file with every mark, for the tools still reading it, and returns how many it holds.
+	WriteView() (int, error)
+}
+
+const (
+	// marksDir holds a file per release mark, in a folder per app: releases/<app>/<start>-<run_id>.json
+	marksDir        = "releases"
+	markStartLayout = "20060102T150405Z"
+)
+
+// markPath returns the path of the file of a mark, relative to the markers directory. The start is part of it
+// so the marks of an app are listed in the order they started.
+func markPath(mark Mark) string {
+	name := mark.Start.UTC().Format(markStartLayout)
+	if mark.RunID != "" {
+		name += "-" + mark.RunID
+	}
+	return path.Join(marksDir, mark.AppName, name+".json")
+}
+
+// newMark returns the mark of a release starting now.
+func newMark(releaseInfo ReleaseInfo, now time.Time) Mark {
+	return Mark{
+		ReleaseInfo: releaseInfo,
+		Start:       CustomTime{now},
+		Status:      StatusStarted,
+	}
+}
+
+// endMark records the end of the release of the mark in its started mark, failing if already ended.
+func endMark(started *Mark, mark Mark, now func() time.Time) error {
+	if !started.End.IsZero() {
+		return ErrLastMarkerEnded
+	}
+	started.End = CustomTime{now()}
+	started.Status = mark.Status
+	started.Error = mark.Error
+	started.Artifacts = mark.Artifacts
+	return nil
+}
+
+// selectMarks returns the marks selected by the filter, sorted by start.
+func selectMarks(marks []Mark, filter Filter) []Mark {
+	var selected []Mark
+	for _, mark := range marks {
+		if filter.Matches(mark) {
+			selected = append(selected, mark)
+		}
+	}
+	sortMarks(selected)
+	return selected
+}
+
+// mergeMarks merges the marks of the legacy file with the ones of their own file, which replace the legacy
+// ones of the same release, sorted by start.
+func mergeMarks(legacy, marks []Mark) []Mark {
+	byPath := make(map[string]Mark, len(legacy)+len(marks))
+	for _, mark := range append(append([]Mark{}, legacy...), marks...) {
+		byPath[markPath(mark)] = mark
+	}
+	merged := make([]Mark, 0, len(byPath))
+	for _, mark := range byPath {
+		merged = append(merged, mark)
+	}
+	sortMarks(merged)
+	return merged
+}
+
+// sortMarks sorts marks by start, and by path for the ones started at the same time.
+func sortMarks(marks []Mark) {
+	sort.Slice(marks, func(i, j int) bool {
+		if !marks[i].Start.Equal(marks[j].Start.Time) {
+			return marks[i].Start.Before(marks[j].Start.Time)
+		}
+		return markPath(marks[i]) < markPath(marks[j])
+	})
 }
 
 // CustomTime is a wrapper around time.Time that
@@ -50,7 +208,7 @@ func (ct *CustomTime) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (ct *CustomTime) MarshalJSON() ([]byte, error) {
+func (ct CustomTime) MarshalJSON() ([]byte, error) {
 	return json.Marshal(ct.Time.Format(ctLayout))
 }
 
@@ -5,23 +5,35 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"time"
 )
 
-type Logf func(format string, args ...interface{})
+const (
+	// markerName is the legacy marker file, see Migrator
+	markerName = "releases.json"
 
-const markerName = "releases.json"
+	// markerWriteAttempts bounds the read-modify-write cycles of an update of the legacy marker file conflicting
+	// with the ones of other runs
+	markerWriteAttempts = 5
+	markerConflictDelay = 500 * time.Millisecond
+)
 
-var ErrLastMarkerEnded = errors.New("last marker is already ended")
-var ErrNoStartedMarkersFound = errors.New("no started markers found")
+var ErrLastMarkerEnded = errors.New("marker is already ended")
 var ErrNoStartedMarkerFoundForApp = errors.New("no started marker found for app")
 var ErrCannotWriteMarkerFile = errors.New("cannot write marker file")
 var ErrNotStartedMark = errors.New("not started mark")
+var ErrMarkerConflict = errors.New("marker file modified concurrently")
 
 // S3Config markerAWS lock config DTO.
 type S3Config struct {
@@ -33,8 +45,25 @@ type S3Config struct {
 
 // S3Client aws client interface for testing
 type S3Client interface {
-	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	// PutObjectIfMatch writes the object only if its ETag is still etag, or if it doesn't exist when etag is empty.
+	PutObjectIfMatch(input *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error)
 	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+}
+
+// conditionalS3Client adds the conditional writes to the S3 client, the SDK version in use doesn't model their headers.
+type conditionalS3Client struct {
+	*s3.S3
+}
+
+func (c conditionalS3Client) PutObjectIfMatch(input *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error) {
+	req, output := c.PutObjectRequest(input)
+	if etag == "" {
+		req.HTTPRequest.Header.Set("If-None-Match", "*")
+	} else {
+		req.HTTPRequest.Header.Set("If-Match", etag)
+	}
+	return output, req.Send()
 }
 
 type TimeProvider interface {
@@ -51,14 +80,25 @@ type markerAWS struct {
 	client       S3Client
 	conf         S3Config
 	timeProvider TimeProvider
-	logfn        Logf
+	logger       *slog.Logger
+	// conflictDelay is the base delay before retrying an update conflicting with another run
+	conflictDelay time.Duration
 }
 
 // NewMarkerAWS creates a new marker using AWS S3
 // it returns an interface on purpose, so this way
 // we can have markerAWS unexported and force the
 // usage of the constructor
-func NewMarkerAWS(s3Config S3Config, logfn Logf) (Marker, error) {
+func NewMarkerAWS(s3Config S3Config, logger *slog.Logger) (Marker, error) {
+	return newMarkerAWS(s3Config, logger)
+}
+
+// NewMigratorAWS creates a migrator of the legacy marker file in AWS S3.
+func NewMigratorAWS(s3Config S3Config, logger *slog.Logger) (Migrator, error) {
+	return newMarkerAWS(s3Config, logger)
+}
+
+func newMarkerAWS(s3Config S3Config, logger *slog.Logger) (*markerAWS, error) {
 	sess, err := session.NewSession()
 	if err != nil {
 		return nil, err
@@ -71,119 +111,260 @@ func NewMarkerAWS(s3Config S3Config, logfn Logf) (Marker, error) {
 	}
 
 	return &markerAWS{
-		client:       s3.New(sess, &awsCfg),
-		conf:         s3Config,
-		timeProvider: RealTimeProvider{},
-		logfn:        logfn,
+		client:        conditionalS3Client{s3.New(sess, &awsCfg)},
+		conf:          s3Config,
+		timeProvider:  RealTimeProvider{},
+		logger:        logger,
+		conflictDelay: markerConflictDelay,
 	}, nil
 }
 
 // Start will:
-// load all the markers from the file
-// append a new started marker
-// write the markers back to the file
+// create the object of a new started mark, failing if another run of the app started at the same time
+// add it to the legacy file, see updateView
 func (s *markerAWS) Start(releaseInfo ReleaseInfo) (Mark, error) {
-	s.logfn("[marker] starting %s", releaseInfo.AppName)
-	markers, err := s.readMarkers()
-	if err != nil {
-		// Do not return error if the file does not exist. The first time we will create a new one.
-		if !isNoSuchKeyError(err) {
-			return Mark{}, err
-		}
-	}
-
-	mark := Mark{
-		ReleaseInfo: releaseInfo,
-		Start:       CustomTime{s.now()},
+	s.logger.Info("starting release mark", "app", releaseInfo.AppName)
+	mark := newMark(releaseInfo, s.now())
+	err := s.writeObject(s.key(markPath(mark)), &mark, "")
+	if isConflictError(err) {
+		return mark, fmt.Errorf("%w: %s was already started at %s", ErrMarkerConflict, mark.AppName, mark.Start)
 	}
-
-	markers = append(markers, mark)
-	if err = s.writeMarkers(markers); err != nil {
+	if err != nil {
 		return mark, err
 	}
 
+	s.updateView(mark)
 	return mark, nil
 }
 
 // End will:
-// load all the markers from the file
-// find the last started marker
-// append the end time to the last started marker
-// write the markers back to the file
+// load the object of the started mark
+// record the end time and the outcome of the release in it
+// write it back, unless modified meanwhile
+// update it in the legacy file, see updateView
 func (s *markerAWS) End(mark Mark) error {
-	s.logfn("[marker] ending %s", mark.AppName)
+	s.logger.Info("ending release mark", "app", mark.AppName)
 	if mark.Start.IsZero() {
 		return ErrNotStartedMark
 	}
 
-	markers, err := s.readMarkers()
+	var started Mark
+	etag, err := s.readObject(s.key(markPath(mark)), &started)
+	if isNoSuchKeyError(err) {
+		return fmt.Errorf("%w started:%s appName:%s runID:%s", ErrNoStartedMarkerFoundForApp, mark.Start, mark.AppName, mark.RunID)
+	}
+	if err != nil {
+		return err
+	}
+	if err = endMark(&started, mark, s.now); err != nil {
+		return err
+	}
+
+	err = s.writeObject(s.key(markPath(mark)), &started, etag)
+	if isConflictError(err) {
+		return fmt.Errorf("%w: mark of %s started at %s", ErrMarkerConflict, mark.AppName, mark.Start)
+	}
 	if err != nil {
 		return err
 	}
-	//ensure the latest marker is the one being ended
-	if len(markers) == 0 {
-		return ErrNoStartedMarkersFound
+
+	s.updateView(started)
+	return nil
+}
+
+// updateView merges a mark into the legacy file, keeping it current for the tools still reading it. The mark
+// objects are the source of truth, so failing to do it is only logged, `markers view` rebuilds the file.
+func (s *markerAWS) updateView(mark Mark) {
+	err := s.update(func(markers []Mark) ([]Mark, error) {
+		return mergeMarks(markers, []Mark{mark}), nil
+	})
+	if err != nil {
+		s.logger.Warn("cannot update the legacy release marks", "key", s.key(markerName), "error", err)
 	}
+}
 
-	lastMarker := markers[len(markers)-1]
-	if !lastMarker.End.IsZero() {
-		return ErrLastMarkerEnded
+// Migrate will:
+// load all the markers from the legacy file
+// create the object of every mark, unless it already exists
+func (s *markerAWS) Migrate() (int, error) {
+	markers, _, err := s.readMarkers()
+	if err != nil {
+		return 0, err
 	}
 
-	if lastMarker.AppName != mark.AppName || !lastMarker.Start.Equals(mark.Start) {
-		return fmt.Errorf("%w started:%s appName:%s", ErrNoStartedMarkerFoundForApp, mark.Start, mark.AppName)
+	migrated := 0
+	for _, mark := range markers {
+		key := s.key(markPath(mark))
+		err = s.writeObject(key, &mark, "")
+		if isConflictError(err) {
+			s.logger.Info("release mark already migrated", "key", key)
+			continue
+		}
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
 	}
 
-	lastMarker.End = CustomTime{s.now()}
-	markers[len(markers)-1] = lastMarker
+	return migrated, nil
+}
 
-	err = s.writeMarkers(markers)
+// WriteView will:
+// load every mark object
+// merge them into the legacy file, where marks not migrated yet are kept
+// write the legacy file, unless modified meanwhile, starting over then
+func (s *markerAWS) WriteView() (int, error) {
+	marks, err := s.listMarks(marksDir + "/")
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrCannotWriteMarkerFile, err)
+		return 0, err
 	}
 
-	return nil
+	var view []Mark
+	err = s.update(func(markers []Mark) ([]Mark, error) {
+		view = mergeMarks(markers, marks)
+		return view, nil
+	})
+
+	return len(view), err
 }
 
-func (s *markerAWS) writeMarkers(markers []Mark) error {
-	markersBytes, err := json.MarshalIndent(markers, "", "  ")
+// List will:
+// load the mark objects, only the ones of the app when filtering by it
+// merge them with the ones of the legacy file not migrated yet
+// return the ones selected by the filter
+func (s *markerAWS) List(filter Filter) ([]Mark, error) {
+	prefix := marksDir + "/"
+	if filter.AppName != "" {
+		prefix = path.Join(marksDir, filter.AppName) + "/"
+	}
+	marks, err := s.listMarks(prefix)
 	if err != nil {
-		return fmt.Errorf("cannot encode marker file: %w", err)
+		return nil, err
+	}
+	legacy, _, err := s.readMarkers()
+	if err != nil {
+		return nil, err
 	}
 
-	s.logfn("[marker] writing bucket:%s key:%s", s.conf.Bucket, s.markerPath())
-	_, err = s.client.PutObject(&s3.PutObjectInput{
+	return selectMarks(mergeMarks(legacy, marks), filter), nil
+}
+
+// listMarks loads the mark objects with a prefix, relative to the markers directory.
+func (s *markerAWS) listMarks(prefix string) ([]Mark, error) {
+	var keys []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
 		Bucket: aws.String(s.conf.Bucket),
-		Key:    aws.String(s.markerPath()),
-		Body:   aws.ReadSeekCloser(bytes.NewReader(markersBytes)),
+		Prefix: aws.String(s.key(prefix)),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			if strings.HasSuffix(aws.StringValue(object.Key), ".json") {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+		}
+		return true
 	})
 	if err != nil {
-		return fmt.Errorf("cannot write marker file: %w", err)
+		return nil, fmt.Errorf("cannot list marks: %w", err)
+	}
+
+	marks := make([]Mark, 0, len(keys))
+	for _, key := range keys {
+		var mark Mark
+		if _, err = s.readObject(key, &mark); err != nil {
+			return nil, err
+		}
+		marks = append(marks, mark)
+	}
+
+	return marks, nil
+}
+
+// update applies a modification to the legacy marker file, reading it again and reapplying it when another run
+// wrote it in between.
+func (s *markerAWS) update(modify func(markers []Mark) ([]Mark, error)) error {
+	for attempt := 1; ; attempt++ {
+		markers, etag, err := s.readMarkers()
+		if err != nil {
+			return err
+		}
+
+		markers, err = modify(markers)
+		if err != nil {
+			return err
+		}
+
+		err = s.writeObject(s.key(markerName), markers, etag)
+		if err == nil || !isConflictError(err) {
+			return err
+		}
+		if attempt == markerWriteAttempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrMarkerConflict, attempt, err)
+		}
+
+		// runs conflicting once would likely do it again retrying at the same time
+		delay := s.conflictDelay*time.Duration(attempt) + time.Duration(rand.Int63n(int64(s.conflictDelay)+1))
+		s.logger.Warn("release marks modified by another run, retrying", "key", s.key(markerName), "delay", delay)
+		time.Sleep(delay)
+	}
+}
+
+// readMarkers returns the markers of the legacy file with its ETag, no markers nor ETag when it doesn't exist.
+func (s *markerAWS) readMarkers() ([]Mark, string, error) {
+	var markers []Mark
+	etag, err := s.readObject(s.key(markerName), &markers)
+	if isNoSuchKeyError(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return markers, etag, nil
+}
+
+// writeObject writes the value as JSON unless the object changed since read with the etag, or exists when the
+// etag is empty.
+func (s *markerAWS) writeObject(key string, v interface{}, etag string) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode marker file: %w", err)
+	}
+
+	s.logger.Info("writing release mark", "bucket", s.conf.Bucket, "key", key)
+	_, err = s.client.PutObjectIfMatch(&s3.PutObjectInput{
+		Bucket: aws.String(s.conf.Bucket),
+		Key:    aws.String(key),
+		Body:   aws.ReadSeekCloser(bytes.NewReader(content)),
+	}, etag)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotWriteMarkerFile, err)
 	}
 
 	return nil
 }
 
-func (s *markerAWS) readMarkers() ([]Mark, error) {
+// readObject decodes the JSON of an object into v, returning its ETag.
+func (s *markerAWS) readObject(key string, v interface{}) (string, error) {
 	objOutput, err := s.client.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(s.conf.Bucket),
-		Key:    aws.String(s.markerPath()),
+		Key:    aws.String(key),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("cannot read marker file: %w", err)
+		return "", fmt.Errorf("cannot read marker file: %w", err)
 	}
+	defer objOutput.Body.Close()
 
-	var markers []Mark
-	err = json.NewDecoder(objOutput.Body).Decode(&markers)
+	err = json.NewDecoder(objOutput.Body).Decode(v)
 	if err != nil {
-		return nil, fmt.Errorf("cannot decode marker file: %w", err)
+		return "", fmt.Errorf("cannot decode marker file %s: %w", key, err)
 	}
 
-	return markers, nil
+	return aws.StringValue(objOutput.ETag), nil
 }
 
-func (s *markerAWS) markerPath() string {
-	return s.conf.Directory + "/" + markerName
+// key returns the key of a file of the markers directory.
+func (s *markerAWS) key(name string) string {
+	return s.conf.Directory + "/" + name
 }
 
 func (s *markerAWS) now() time.Time {
@@ -198,3 +379,13 @@ func isNoSuchKeyError(err error) bool {
 	}
 	return false
 }
+
+// isConflictError returns whether a conditional write failed because the object changed, or was being changed
+// by another conditional write.
+func isConflictError(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode() == http.StatusPreconditionFailed || reqErr.StatusCode() == http.StatusConflict
+	}
+	return false
+}
@@ -4,162 +4,110 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 	"io"
+	"log/slog"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-var nolog = func(format string, args ...interface{}) {}
+var nolog = slog.New(slog.NewTextHandler(io.Discard, nil))
 
-func Test_Start(t *testing.T) {
-	s3ClientMock := &S3ClientMock{}
-	timeProviderMock := &TimeProviderMock{}
+const (
+	markersETag = `"3858f62230ac3c915f300c664312c63f"`
+	markKey     = "directory/releases/my-app/20230102T000000Z-run3.json"
+	legacyKey   = "directory/releases.json"
+)
 
-	s3Config := S3Config{
+var (
+	s3Config = S3Config{
 		Bucket:    "bucket",
 		RoleARN:   "role",
 		Region:    "region",
 		Directory: "directory",
 	}
+	releaseInfo = ReleaseInfo{
+		AppName:   "my-app",
+		Tag:       "v1.2",
+		RunID:     "run3",
+		RepoName:  "repo3",
+		Schema:    "schema3",
+		SchemaURL: "url3",
+	}
+	startTime = time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	// startedMark is the object of the release started by releaseInfo at startTime
+	startedMark = `{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "0001-01-01T00:00:00Z", "repo_name": "repo3", "schema": "schema3", "schema_url": "url3", "status": "started"}`
+)
 
-	// It should read existing markers
-	existingMarkers := `
-		[
-			{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "repo_name": "repo1", "schema": "schema1", "schema_url": "url1"},
-			{"app_name": "app2", "tag": "v1.1", "run_id": "run2", "start": "2023-01-02T00:00:00Z", "end": "2023-01-02T01:00:00Z", "repo_name": "repo2", "schema": "schema2", "schema_url": "url2"}
-		]`
+func getInput(key string) *s3.GetObjectInput {
+	return &s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(key)}
+}
 
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
+func getOutput(content string) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte(content))), ETag: aws.String(markersETag)}
+}
 
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
+func putInput(key, content string) *s3.PutObjectInput {
+	return &s3.PutObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(key), Body: aws.ReadSeekCloser(bytes.NewReader([]byte(content)))}
+}
+
+func conflictError() error {
+	return awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), 412, "request")
+}
+
+func Test_Start(t *testing.T) {
+	s3ClientMock := &S3ClientMock{}
+	timeProviderMock := &TimeProviderMock{}
 
 	// It should get current time for the new marker
-	startTime := time.Date(2025, 3, 4, 11, 12, 13, 0, time.UTC)
 	timeProviderMock.ShouldProvideNow(startTime)
 
-	expectedMarkers := mustPrettify(`[
-		{"app_name":"app1","tag":"v1.0","run_id":"run1","start":"2023-01-01T00:00:00Z","end":"2023-01-01T01:00:00Z","repo_name":"repo1","schema":"schema1","schema_url":"url1"},
-		{"app_name":"app2","tag":"v1.1","run_id":"run2","start":"2023-01-02T00:00:00Z","end":"2023-01-02T01:00:00Z","repo_name":"repo2","schema":"schema2","schema_url":"url2"},
-		{"app_name":"my-app","tag":"v1.2","run_id":"run3","start":"2025-03-04T11:12:13Z","end":"0001-01-01T00:00:00Z","repo_name":"repo3","schema":"schema3","schema_url":"url3"}
-	]`)
-
-	putBody := aws.ReadSeekCloser(bytes.NewReader([]byte(expectedMarkers)))
-	s3ClientMock.ShouldPutObject(
-		&s3.PutObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName)), Body: putBody},
-		&s3.PutObjectOutput{},
-	)
+	// It should create the object of the mark, only if it doesn't exist
+	s3ClientMock.ShouldPutObject(putInput(markKey, mustPrettifyMark(startedMark)), "", &s3.PutObjectOutput{})
 
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
+	// It should add it to the legacy file, creating it when missing
+	s3ClientMock.ShouldReturnErrorOnGetObject(getInput(legacyKey), awserr.New("NoSuchKey", "The specified key does not exist.", nil))
+	s3ClientMock.ShouldPutObject(putInput(legacyKey, mustPrettify("["+startedMark+"]")), "", &s3.PutObjectOutput{})
 
-	releaseInfo := ReleaseInfo{
-		AppName:   "my-app",
-		Tag:       "v1.2",
-		RunID:     "run3",
-		RepoName:  "repo3",
-		Schema:    "schema3",
-		SchemaURL: "url3",
-	}
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
 	mark, err := markerS3.Start(releaseInfo)
 	require.NoError(t, err)
 	require.Equal(t, releaseInfo, mark.ReleaseInfo)
+	require.Equal(t, StatusStarted, mark.Status)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
-func Test_StartErrorReadingMarkers(t *testing.T) {
-	releaseInfo := ReleaseInfo{
-		AppName:   "my-app",
-		Tag:       "v1.2",
-		RunID:     "run3",
-		RepoName:  "repo3",
-		Schema:    "schema3",
-		SchemaURL: "url3",
-	}
-	timeProviderMock := &TimeProviderMock{}
+func Test_StartErrorWritingMarker(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
+	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:  "bucket",
-		RoleARN: "role",
-		Region:  "region",
-	}
-
-	var someError = errors.New("error reading markers")
-	s3ClientMock.ShouldReturnErrorOnGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		someError)
+	timeProviderMock.ShouldProvideNow(startTime)
+	var someError = errors.New("error writing markers")
+	s3ClientMock.ShouldReturnErrorOnPutObject(putInput(markKey, mustPrettifyMark(startedMark)), "", someError)
 
-	markerS3 := &markerAWS{timeProvider: timeProviderMock, conf: s3Config, client: s3ClientMock, logfn: nolog}
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
 	_, err := markerS3.Start(releaseInfo)
 	assert.ErrorIs(t, err, someError)
+	assert.ErrorIs(t, err, ErrCannotWriteMarkerFile)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
-func Test_StartErrorWritingMarkers(t *testing.T) {
-	releaseInfo := ReleaseInfo{
-		AppName:   "my-app",
-		Tag:       "v1.2",
-		RunID:     "run3",
-		RepoName:  "repo3",
-		Schema:    "schema3",
-		SchemaURL: "url3",
-	}
-	timeProviderMock := &TimeProviderMock{}
+func Test_StartFailsIfAlreadyStarted(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
+	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:  "bucket",
-		RoleARN: "role",
-		Region:  "region",
-	}
-
-	// It should read existing markers
-	existingMarkers := `
-		[
-			{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "repo_name": "repo1", "schema": "schema1", "schema_url": "url1"},
-			{"app_name": "app2", "tag": "v1.1", "run_id": "run2", "start": "2023-01-02T00:00:00Z", "end": "2023-01-02T01:00:00Z", "repo_name": "repo2", "schema": "schema2", "schema_url": "url2"}
-		]`
-
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
-
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
-
-	// It should get current time for the new marker
-	startTime := time.Date(2025, 3, 4, 11, 12, 13, 0, time.UTC)
 	timeProviderMock.ShouldProvideNow(startTime)
+	s3ClientMock.ShouldReturnErrorOnPutObject(putInput(markKey, mustPrettifyMark(startedMark)), "", conflictError())
 
-	expectedMarkers := mustPrettify(`[
-		{"app_name":"app1","tag":"v1.0","run_id":"run1","start":"2023-01-01T00:00:00Z","end":"2023-01-01T01:00:00Z","repo_name":"repo1","schema":"schema1","schema_url":"url1"},
-		{"app_name":"app2","tag":"v1.1","run_id":"run2","start":"2023-01-02T00:00:00Z","end":"2023-01-02T01:00:00Z","repo_name":"repo2","schema":"schema2","schema_url":"url2"},
-		{"app_name":"my-app","tag":"v1.2","run_id":"run3","start":"2025-03-04T11:12:13Z","end":"0001-01-01T00:00:00Z","repo_name":"repo3","schema":"schema3","schema_url":"url3"}
-	]`)
-
-	putBody := aws.ReadSeekCloser(bytes.NewReader([]byte(expectedMarkers)))
-	var someError = errors.New("error writing markers")
-	s3ClientMock.ShouldReturnErrorOnPutObject(
-		&s3.PutObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName)), Body: putBody},
-		someError)
-
-	markerS3 := &markerAWS{timeProvider: timeProviderMock, conf: s3Config, client: s3ClientMock, logfn: nolog}
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
 	_, err := markerS3.Start(releaseInfo)
-	assert.ErrorIs(t, err, someError)
+	assert.ErrorIs(t, err, ErrMarkerConflict)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
@@ -167,64 +115,35 @@ func Test_End(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
 	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:  "bucket",
-		RoleARN: "role",
-		Region:  "region",
-	}
-
-	// It should read existing markers
-	existingMarkers := `
-	[
-		{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "repo_name": "repo1", "schema": "schema1", "schema_url": "url1"},
-		{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "0001-01-01T00:00:00Z", "repo_name": "repo3", "schema": "schema3", "schema_url": "url3"}
-	]`
-
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
-
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
+	// It should read the started mark
+	s3ClientMock.ShouldGetObject(getInput(markKey), getOutput(startedMark))
 
 	// It should get current time for the end of the started marker
 	endTime := time.Date(2025, 3, 4, 11, 12, 13, 0, time.UTC)
 	timeProviderMock.ShouldProvideNow(endTime)
 
-	expectedMarkers := mustPrettify(`[
-		{"app_name":"app1","tag":"v1.0","run_id":"run1","start":"2023-01-01T00:00:00Z","end":"2023-01-01T01:00:00Z","repo_name":"repo1","schema":"schema1","schema_url":"url1"},
-		{"app_name":"my-app","tag":"v1.2","run_id":"run3","start":"2023-01-02T00:00:00Z","end":"2025-03-04T11:12:13Z","repo_name":"repo3","schema":"schema3","schema_url":"url3"}
-	]`)
+	// It should write it back only if not modified meanwhile
+	expectedMark := mustPrettifyMark(`{"app_name":"my-app","tag":"v1.2","run_id":"run3","start":"2023-01-02T00:00:00Z","end":"2025-03-04T11:12:13Z","repo_name":"repo3","schema":"schema3","schema_url":"url3",
+		"status":"failed","error":"some error","artifacts":[{"key":"amd64/my-app.tar.gz","size":4,"sha256":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}]}`)
+	s3ClientMock.ShouldPutObject(putInput(markKey, expectedMark), markersETag, &s3.PutObjectOutput{})
 
-	putBody := aws.ReadSeekCloser(bytes.NewReader([]byte(expectedMarkers)))
-	s3ClientMock.ShouldPutObject(
-		&s3.PutObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName)), Body: putBody},
-		&s3.PutObjectOutput{},
-	)
+	// It should update it in the legacy file, failing to do it doesn't fail the release
+	s3ClientMock.ShouldGetObject(getInput(legacyKey), getOutput("["+startedMark+"]"))
+	s3ClientMock.ShouldReturnErrorOnPutObject(putInput(legacyKey, mustPrettify("["+expectedMark+"]")), markersETag, errors.New("access denied"))
 
-	releaseInfo := ReleaseInfo{
-		AppName:   "my-app",
-		Tag:       "v1.2",
-		RunID:     "run3",
-		RepoName:  "repo3",
-		Schema:    "schema3",
-		SchemaURL: "url3",
-	}
-	startTime := time.Date(2023, 1, 2, 00, 00, 00, 0, time.UTC)
 	mark := Mark{
 		ReleaseInfo: releaseInfo,
 		Start:       CustomTime{startTime},
+		Status:      StatusFailed,
+		Error:       "some error",
+		Artifacts: []Artifact{
+			{Key: "amd64/my-app.tar.gz", Size: 4, SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+		},
 	}
 
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
 	err := markerS3.End(mark)
 	require.NoError(t, err)
-	require.Equal(t, releaseInfo, mark.ReleaseInfo)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
@@ -232,64 +151,24 @@ func Test_End_ErrorOnWriting(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
 	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:  "bucket",
-		RoleARN: "role",
-		Region:  "region",
-	}
-
-	// It should read existing markers
-	existingMarkers := `
-	[
-		{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "repo_name": "repo1", "schema": "schema1", "schema_url": "url1"},
-		{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "0001-01-01T00:00:00Z", "repo_name": "repo3", "schema": "schema3", "schema_url": "url3"}
-	]`
-
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
-
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
-
-	// It should get current time for the end of the started marker
+	s3ClientMock.ShouldGetObject(getInput(markKey), getOutput(startedMark))
 	endTime := time.Date(2025, 3, 4, 11, 12, 13, 0, time.UTC)
 	timeProviderMock.ShouldProvideNow(endTime)
 
-	expectedMarkers := mustPrettify(`[
-		{"app_name":"app1","tag":"v1.0","run_id":"run1","start":"2023-01-01T00:00:00Z","end":"2023-01-01T01:00:00Z","repo_name":"repo1","schema":"schema1","schema_url":"url1"},
-		{"app_name":"my-app","tag":"v1.2","run_id":"run3","start":"2023-01-02T00:00:00Z","end":"2025-03-04T11:12:13Z","repo_name":"repo3","schema":"schema3","schema_url":"url3"}
-	]`)
-
-	putBody := aws.ReadSeekCloser(bytes.NewReader([]byte(expectedMarkers)))
+	expectedMark := mustPrettifyMark(`{"app_name":"my-app","tag":"v1.2","run_id":"run3","start":"2023-01-02T00:00:00Z","end":"2025-03-04T11:12:13Z","repo_name":"repo3","schema":"schema3","schema_url":"url3","status":"succeeded"}`)
 	var someError = errors.New("error writing markers")
-	s3ClientMock.ShouldReturnErrorOnPutObject(
-		&s3.PutObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName)), Body: putBody},
-		someError)
+	s3ClientMock.ShouldReturnErrorOnPutObject(putInput(markKey, expectedMark), markersETag, someError)
 
-	startTime := time.Date(2023, 1, 2, 00, 00, 00, 0, time.UTC)
-
-	releaseInfo := ReleaseInfo{
-		AppName:   "my-app",
-		Tag:       "v1.2",
-		RunID:     "run3",
-		RepoName:  "repo3",
-		Schema:    "schema3",
-		SchemaURL: "url3",
-	}
 	mark := Mark{
 		ReleaseInfo: releaseInfo,
 		Start:       CustomTime{startTime},
+		Status:      StatusSucceeded,
 	}
 
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
 	err := markerS3.End(mark)
 	assert.ErrorIs(t, err, someError)
+	assert.ErrorIs(t, err, ErrCannotWriteMarkerFile)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
@@ -297,44 +176,11 @@ func Test_End_ErrorIfNoMarkerFound(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
 	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:    "bucket",
-		RoleARN:   "role",
-		Region:    "region",
-		Directory: "directory",
-	}
-
-	// It should read existing markers
-	existingMarkers := `[]`
-
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
-
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
-
-	startTime := time.Date(2023, 1, 2, 00, 00, 00, 0, time.UTC)
-	mark := Mark{
-		ReleaseInfo: ReleaseInfo{
-			AppName:   "my-app",
-			Tag:       "v1.2",
-			RunID:     "run3",
-			RepoName:  "repo3",
-			Schema:    "schema3",
-			SchemaURL: "url3",
-		},
-		Start: CustomTime{startTime},
-	}
+	s3ClientMock.ShouldReturnErrorOnGetObject(getInput(markKey), awserr.New("NoSuchKey", "The specified key does not exist.", nil))
 
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
-	err := markerS3.End(mark)
-	assert.ErrorIs(t, err, ErrNoStartedMarkersFound)
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
+	err := markerS3.End(Mark{ReleaseInfo: releaseInfo, Start: CustomTime{startTime}})
+	assert.ErrorIs(t, err, ErrNoStartedMarkerFoundForApp)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
@@ -342,222 +188,156 @@ func Test_End_ErrorOnReadingMarkers(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
 	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:    "bucket",
-		RoleARN:   "role",
-		Region:    "region",
-		Directory: "directory",
-	}
-
 	var someError = errors.New("error reading markers")
-	s3ClientMock.ShouldReturnErrorOnGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		someError)
-
-	startTime := time.Date(2023, 1, 2, 00, 00, 00, 0, time.UTC)
-	mark := Mark{
-		ReleaseInfo: ReleaseInfo{
-			AppName:   "my-app",
-			Tag:       "v1.2",
-			RunID:     "run3",
-			RepoName:  "repo3",
-			Schema:    "schema3",
-			SchemaURL: "url3",
-		},
-		Start: CustomTime{startTime},
-	}
+	s3ClientMock.ShouldReturnErrorOnGetObject(getInput(markKey), someError)
 
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
-	err := markerS3.End(mark)
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
+	err := markerS3.End(Mark{ReleaseInfo: releaseInfo, Start: CustomTime{startTime}})
 	assert.ErrorIs(t, err, someError)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
-func Test_EndFailsIfLatestMarkerIsEnded(t *testing.T) {
+func Test_EndFailsIfMarkerIsEnded(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
 	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:    "bucket",
-		RoleARN:   "role",
-		Region:    "region",
-		Directory: "directory",
-	}
-
-	// It should read existing markers
-	existingMarkers := `
-	[
-		{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "repo_name": "repo1", "schema": "schema1", "schema_url": "url1"},
-		{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "2023-01-02T01:00:00Z", "repo_name": "repo3", "schema": "schema3", "schema_url": "url3"}
-	]`
+	endedMark := `{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "2023-01-02T01:00:00Z", "status": "succeeded"}`
+	s3ClientMock.ShouldGetObject(getInput(markKey), getOutput(endedMark))
 
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
-
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
-
-	startTime := time.Date(2023, 1, 2, 00, 00, 00, 0, time.UTC)
-	mark := Mark{
-		ReleaseInfo: ReleaseInfo{
-			AppName:   "my-app",
-			Tag:       "v1.2",
-			RunID:     "run3",
-			RepoName:  "repo3",
-			Schema:    "schema3",
-			SchemaURL: "url3",
-		},
-		Start: CustomTime{startTime},
-	}
-
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
-	err := markerS3.End(mark)
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
+	err := markerS3.End(Mark{ReleaseInfo: releaseInfo, Start: CustomTime{startTime}})
 	assert.ErrorIs(t, err, ErrLastMarkerEnded)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
-func Test_EndFailsIfMarkerForAppNotFound(t *testing.T) {
+func Test_EndFailsIfMarkerStartIsZero(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
 	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:    "bucket",
-		RoleARN:   "role",
-		Region:    "region",
-		Directory: "directory",
-	}
-
-	// It should read existing markers
-	existingMarkers := `
-	[
-		{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "repo_name": "repo1", "schema": "schema1", "schema_url": "url1"},
-		{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "0001-01-01T00:00:00Z", "repo_name": "repo3", "schema": "schema3", "schema_url": "url3"}
-	]`
-
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
-
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
-
-	startTime := time.Date(2023, 1, 2, 00, 00, 00, 0, time.UTC)
-	mark := Mark{
-		ReleaseInfo: ReleaseInfo{
-			AppName:   "another-app",
-			Tag:       "v1.2",
-			RunID:     "run3",
-			RepoName:  "repo3",
-			Schema:    "schema3",
-			SchemaURL: "url3",
-		},
-		Start: CustomTime{startTime},
-	}
-
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
-	err := markerS3.End(mark)
-	assert.ErrorIs(t, err, ErrNoStartedMarkerFoundForApp)
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, timeProvider: timeProviderMock, logger: nolog}
+	err := markerS3.End(Mark{ReleaseInfo: releaseInfo})
+	assert.ErrorIs(t, err, ErrNotStartedMark)
 	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
 }
 
-func Test_EndFailsIfMarkerStartTimeIsDifferent(t *testing.T) {
+func Test_Migrate(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
-	timeProviderMock := &TimeProviderMock{}
-
-	s3Config := S3Config{
-		Bucket:    "bucket",
-		RoleARN:   "role",
-		Region:    "region",
-		Directory: "directory",
-	}
 
-	// It should read existing markers
-	existingMarkers := `
-	[
+	// It should read the legacy marker file
+	s3ClientMock.ShouldGetObject(getInput(legacyKey), getOutput(`[
 		{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "repo_name": "repo1", "schema": "schema1", "schema_url": "url1"},
-		{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T11:00:00Z", "end": "0001-01-01T00:00:00Z", "repo_name": "repo3", "schema": "schema3", "schema_url": "url3"}
-	]`
+		{"app_name": "app2", "tag": "v1.1", "run_id": "run2", "start": "2023-01-02T00:00:00Z", "end": "2023-01-02T01:00:00Z", "repo_name": "repo2", "schema": "schema2", "schema_url": "url2"}
+	]`))
 
-	reader := bytes.NewReader([]byte(existingMarkers))
-	readCloser := io.NopCloser(reader)
+	// It should create the object of every mark, skipping the ones already migrated
+	s3ClientMock.ShouldReturnErrorOnPutObject(
+		putInput("directory/releases/app1/20230101T000000Z-run1.json", mustPrettifyMark(`{"app_name":"app1","tag":"v1.0","run_id":"run1","start":"2023-01-01T00:00:00Z","end":"2023-01-01T01:00:00Z","repo_name":"repo1","schema":"schema1","schema_url":"url1"}`)),
+		"",
+		conflictError())
+	s3ClientMock.ShouldPutObject(
+		putInput("directory/releases/app2/20230102T000000Z-run2.json", mustPrettifyMark(`{"app_name":"app2","tag":"v1.1","run_id":"run2","start":"2023-01-02T00:00:00Z","end":"2023-01-02T01:00:00Z","repo_name":"repo2","schema":"schema2","schema_url":"url2"}`)),
+		"",
+		&s3.PutObjectOutput{})
 
-	s3ClientMock.ShouldGetObject(
-		&s3.GetObjectInput{Bucket: &s3Config.Bucket, Key: aws.String(fmt.Sprintf("%s/%s", s3Config.Directory, markerName))},
-		&s3.GetObjectOutput{Body: readCloser})
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, logger: nolog}
+	migrated, err := markerS3.Migrate()
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+	mock.AssertExpectationsForObjects(t, s3ClientMock)
+}
 
-	startTime := time.Date(2023, 1, 2, 00, 00, 00, 0, time.UTC)
-	mark := Mark{
-		ReleaseInfo: ReleaseInfo{
-			AppName:   "my-app",
-			Tag:       "v1.2",
-			RunID:     "run3",
-			RepoName:  "repo3",
-			Schema:    "schema3",
-			SchemaURL: "url3",
-		},
-		Start: CustomTime{startTime},
-	}
+func Test_WriteView(t *testing.T) {
+	s3ClientMock := &S3ClientMock{}
 
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
-	err := markerS3.End(mark)
-	assert.ErrorIs(t, err, ErrNoStartedMarkerFoundForApp)
-	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
+	// It should read every mark
+	s3ClientMock.ShouldListObjects(
+		&s3.ListObjectsV2Input{Bucket: &s3Config.Bucket, Prefix: aws.String("directory/releases/")},
+		"directory/releases/my-app/20230102T000000Z-run3.json",
+		"directory/releases/app2/20230101T000000Z-run2.json",
+	)
+	ended := `{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "2023-01-02T01:00:00Z", "status": "succeeded"}`
+	s3ClientMock.ShouldGetObject(getInput("directory/releases/my-app/20230102T000000Z-run3.json"), getOutput(ended))
+	s3ClientMock.ShouldGetObject(getInput("directory/releases/app2/20230101T000000Z-run2.json"), getOutput(
+		`{"app_name": "app2", "tag": "v1.1", "run_id": "run2", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z", "status": "succeeded"}`))
+
+	// It should keep the marks not migrated, replacing the migrated ones, retrying when the file is modified
+	legacy := `[
+		{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2022-12-31T00:00:00Z", "end": "2022-12-31T01:00:00Z"}
+	]`
+	s3ClientMock.ShouldGetObject(getInput(legacyKey), getOutput(legacy))
+	expectedMarkers := mustPrettify(`[
+		{"app_name":"app1","tag":"v1.0","run_id":"run1","start":"2022-12-31T00:00:00Z","end":"2022-12-31T01:00:00Z","repo_name":"","schema":"","schema_url":""},
+		{"app_name":"app2","tag":"v1.1","run_id":"run2","start":"2023-01-01T00:00:00Z","end":"2023-01-01T01:00:00Z","repo_name":"","schema":"","schema_url":"","status":"succeeded"},
+		{"app_name":"my-app","tag":"v1.2","run_id":"run3","start":"2023-01-02T00:00:00Z","end":"2023-01-02T01:00:00Z","repo_name":"","schema":"","schema_url":"","status":"succeeded"}
+	]`)
+	s3ClientMock.ShouldReturnErrorOnPutObject(putInput(legacyKey, expectedMarkers), markersETag, conflictError())
+
+	conflictETag := `"9c1185a5c5e9fc54612808977ee8f548"`
+	s3ClientMock.ShouldGetObject(getInput(legacyKey), &s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`[
+			{"app_name": "app1", "tag": "v1.0", "run_id": "run1", "start": "2022-12-31T00:00:00Z", "end": "2022-12-31T01:00:00Z"},
+			{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "0001-01-01T00:00:00Z", "status": "started"}
+		]`))),
+		ETag: aws.String(conflictETag),
+	})
+	s3ClientMock.ShouldPutObject(putInput(legacyKey, expectedMarkers), conflictETag, &s3.PutObjectOutput{})
+
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, logger: nolog}
+	marks, err := markerS3.WriteView()
+	require.NoError(t, err)
+	assert.Equal(t, 3, marks)
+	mock.AssertExpectationsForObjects(t, s3ClientMock)
 }
 
-func Test_EndFailsIfMarkerStartIsZero(t *testing.T) {
+func Test_List(t *testing.T) {
 	s3ClientMock := &S3ClientMock{}
-	timeProviderMock := &TimeProviderMock{}
 
-	s3Config := S3Config{
-		Bucket:    "bucket",
-		RoleARN:   "role",
-		Region:    "region",
-		Directory: "directory",
-	}
+	// It should only read the marks of the app
+	s3ClientMock.ShouldListObjects(
+		&s3.ListObjectsV2Input{Bucket: &s3Config.Bucket, Prefix: aws.String("directory/releases/my-app/")},
+		"directory/releases/my-app/20230102T000000Z-run3.json",
+		"directory/releases/my-app/20230103T000000Z-run4.json",
+	)
+	s3ClientMock.ShouldGetObject(getInput("directory/releases/my-app/20230102T000000Z-run3.json"), getOutput(
+		`{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "2023-01-02T01:00:00Z", "status": "failed"}`))
+	s3ClientMock.ShouldGetObject(getInput("directory/releases/my-app/20230103T000000Z-run4.json"), getOutput(
+		`{"app_name": "my-app", "tag": "v1.2", "run_id": "run4", "start": "2023-01-03T00:00:00Z", "end": "0001-01-01T00:00:00Z", "status": "started"}`))
+
+	// It should include the marks of the legacy file not migrated yet
+	s3ClientMock.ShouldGetObject(getInput(legacyKey), getOutput(`[
+		{"app_name": "my-app", "tag": "v1.1", "run_id": "run1", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z"},
+		{"app_name": "other-app", "tag": "v1.2", "run_id": "run2", "start": "2023-01-01T00:00:00Z", "end": "2023-01-01T01:00:00Z"},
+		{"app_name": "my-app", "tag": "v1.2", "run_id": "run3", "start": "2023-01-02T00:00:00Z", "end": "0001-01-01T00:00:00Z"}
+	]`))
+
+	markerS3 := &markerAWS{client: s3ClientMock, conf: s3Config, logger: nolog}
+	marks, err := markerS3.List(Filter{AppName: "my-app", Tag: "v1.2"})
+	require.NoError(t, err)
+	require.Len(t, marks, 2)
+	assert.Equal(t, "run3", marks[0].RunID)
+	assert.Equal(t, StatusFailed, marks[0].Outcome())
+	assert.Equal(t, "run4", marks[1].RunID)
+	assert.True(t, marks[1].NeverEnded())
+	mock.AssertExpectationsForObjects(t, s3ClientMock)
+}
 
-	startTime := time.Time{}
+func TestFilter_Matches(t *testing.T) {
 	mark := Mark{
-		ReleaseInfo: ReleaseInfo{
-			AppName:   "my-app",
-			Tag:       "v1.2",
-			RunID:     "run3",
-			RepoName:  "repo3",
-			Schema:    "schema3",
-			SchemaURL: "url3",
-		},
-		Start: CustomTime{startTime},
+		ReleaseInfo: ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.0"},
+		Start:       CustomTime{time.Date(2025, 2, 26, 16, 57, 33, 0, time.UTC)},
 	}
 
-	markerS3 := &markerAWS{
-		client:       s3ClientMock,
-		conf:         s3Config,
-		timeProvider: timeProviderMock,
-		logfn:        nolog,
-	}
-	err := markerS3.End(mark)
-	assert.ErrorIs(t, err, ErrNotStartedMark)
-	mock.AssertExpectationsForObjects(t, s3ClientMock, timeProviderMock)
+	assert.True(t, Filter{}.Matches(mark))
+	assert.True(t, Filter{AppName: "nri-redis", Tag: "v1.9.0", Status: StatusStarted}.Matches(mark))
+	assert.True(t, Filter{Since: time.Date(2025, 2, 26, 0, 0, 0, 0, time.UTC), Until: time.Date(2025, 2, 27, 0, 0, 0, 0, time.UTC)}.Matches(mark))
+	assert.False(t, Filter{AppName: "nri-mysql"}.Matches(mark))
+	assert.False(t, Filter{Since: time.Date(2025, 2, 27, 0, 0, 0, 0, time.UTC)}.Matches(mark))
+	assert.False(t, Filter{Until: mark.Start.Time}.Matches(mark))
+	assert.False(t, Filter{Status: StatusSucceeded}.Matches(mark))
+
+	// marks ended before recording their status
+	mark.End = CustomTime{time.Date(2025, 2, 26, 16, 58, 47, 0, time.UTC)}
+	assert.True(t, Filter{Status: StatusEnded}.Matches(mark))
 }
 
 ///////////////////////////////////////////////////////////////
@@ -568,8 +348,8 @@ type S3ClientMock struct {
 	mock.Mock
 }
 
-func (m *S3ClientMock) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
-	args := m.Called(input)
+func (m *S3ClientMock) PutObjectIfMatch(input *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error) {
+	args := m.Called(input, etag)
 
 	return args.Get(0).(*s3.PutObjectOutput), args.Error(1)
 }
@@ -580,16 +360,23 @@ func (m *S3ClientMock) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput,
 	return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
 }
 
-func (m *S3ClientMock) ShouldPutObject(input *s3.PutObjectInput, output *s3.PutObjectOutput) {
+func (m *S3ClientMock) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	args := m.Called(input)
+	fn(args.Get(0).(*s3.ListObjectsV2Output), true)
+
+	return args.Error(1)
+}
+
+func (m *S3ClientMock) ShouldPutObject(input *s3.PutObjectInput, etag string, output *s3.PutObjectOutput) {
 	m.
-		On("PutObject", input).
+		On("PutObjectIfMatch", input, etag).
 		Once().
 		Return(output, nil)
 }
 
-func (m *S3ClientMock) ShouldReturnErrorOnPutObject(input *s3.PutObjectInput, err error) {
+func (m *S3ClientMock) ShouldReturnErrorOnPutObject(input *s3.PutObjectInput, etag string, err error) {
 	m.
-		On("PutObject", input).
+		On("PutObjectIfMatch", input, etag).
 		Once().
 		Return(&s3.PutObjectOutput{}, err)
 }
@@ -608,6 +395,17 @@ func (m *S3ClientMock) ShouldReturnErrorOnGetObject(input *s3.GetObjectInput, er
 		Return(&s3.GetObjectOutput{}, err)
 }
 
+func (m *S3ClientMock) ShouldListObjects(input *s3.ListObjectsV2Input, keys ...string) {
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	m.
+		On("ListObjectsV2Pages", input).
+		Once().
+		Return(output, nil)
+}
+
 ///////////////////////////////////////////////////////////////
 // Time provider Mock
 ///////////////////////////////////////////////////////////////
@@ -629,6 +427,21 @@ func (m *TimeProviderMock) ShouldProvideNow(now time.Time) {
 		Return(now)
 }
 
+func mustPrettifyMark(jsonStr string) string {
+	var mark Mark
+	err := json.Unmarshal([]byte(jsonStr), &mark)
+	if err != nil {
+		panic(err)
+	}
+
+	prettyJSON, err := json.MarshalIndent(&mark, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return string(prettyJSON)
+}
+
 func mustPrettify(jsonStr string) string {
 	var jsonObj []Mark
 	err := json.Unmarshal([]byte(jsonStr), &jsonObj)
@@ -0,0 +1,156 @@
+package release
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// markerDir keeps the marks in a directory, with the layout of the bucket, for publishing into a local folder.
+type markerDir struct {
+	dir          string
+	timeProvider TimeProvider
+	logger       *slog.Logger
+}
+
+// NewMarkerDir creates a marker keeping the marks in a directory, in a file per release.
+func NewMarkerDir(dir string, logger *slog.Logger) Marker {
+	return &markerDir{
+		dir:          dir,
+		timeProvider: RealTimeProvider{},
+		logger:       logger,
+	}
+}
+
+// Start will:
+// create the file of a new started mark, failing if another run of the app started at the same time
+func (m *markerDir) Start(releaseInfo ReleaseInfo) (Mark, error) {
+	m.logger.Info("starting release mark", "app", releaseInfo.AppName)
+	mark := newMark(releaseInfo, m.now())
+
+	file := filepath.Join(m.dir, filepath.FromSlash(markPath(mark)))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return mark, fmt.Errorf("%w: %w", ErrCannotWriteMarkerFile, err)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return mark, fmt.Errorf("%w: %s was already started at %s", ErrMarkerConflict, mark.AppName, mark.Start)
+	}
+	if err != nil {
+		return mark, fmt.Errorf("%w: %w", ErrCannotWriteMarkerFile, err)
+	}
+	defer f.Close()
+
+	if err = writeMarkFile(f, &mark); err != nil {
+		return mark, err
+	}
+
+	return mark, nil
+}
+
+// End will:
+// load the file of the started mark
+// record the end time and the outcome of the release in it
+// replace the file
+func (m *markerDir) End(mark Mark) error {
+	m.logger.Info("ending release mark", "app", mark.AppName)
+	if mark.Start.IsZero() {
+		return ErrNotStartedMark
+	}
+
+	file := filepath.Join(m.dir, filepath.FromSlash(markPath(mark)))
+	started, err := readMarkFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w started:%s appName:%s runID:%s", ErrNoStartedMarkerFoundForApp, mark.Start, mark.AppName, mark.RunID)
+	}
+	if err != nil {
+		return err
+	}
+	if err = endMark(&started, mark, m.now); err != nil {
+		return err
+	}
+
+	// written aside and renamed, so the file is never left half written
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".mark-*")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotWriteMarkerFile, err)
+	}
+	defer os.Remove(tmp.Name())
+	err = writeMarkFile(tmp, &started)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotWriteMarkerFile, err)
+	}
+
+	return nil
+}
+
+// List will:
+// load the mark files, only the ones of the app when filtering by it
+// return the ones selected by the filter
+func (m *markerDir) List(filter Filter) ([]Mark, error) {
+	root := filepath.Join(m.dir, marksDir)
+	if filter.AppName != "" {
+		root = filepath.Join(root, filter.AppName)
+	}
+
+	var marks []Mark
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && file == root {
+			// nothing was released yet
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() || !strings.HasSuffix(file, ".json") {
+			return err
+		}
+		mark, err := readMarkFile(file)
+		if err != nil {
+			return err
+		}
+		marks = append(marks, mark)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return selectMarks(marks, filter), nil
+}
+
+func (m *markerDir) now() time.Time {
+	return m.timeProvider.Now().UTC()
+}
+
+func readMarkFile(file string) (Mark, error) {
+	var mark Mark
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return mark, fmt.Errorf("cannot read marker file: %w", err)
+	}
+	if err = json.Unmarshal(content, &mark); err != nil {
+		return mark, fmt.Errorf("cannot decode marker file %s: %w", file, err)
+	}
+	return mark, nil
+}
+
+func writeMarkFile(f *os.File, mark *Mark) error {
+	content, err := json.MarshalIndent(mark, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode marker file: %w", err)
+	}
+	if _, err = f.Write(content); err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotWriteMarkerFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package release
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// markerMemory keeps the marks in memory, for publishing without keeping track of the releases, i.e. dry runs.
+type markerMemory struct {
+	mu           sync.Mutex
+	marks        map[string]Mark
+	timeProvider TimeProvider
+}
+
+// NewMarkerInMemory creates a marker keeping the marks in memory, lost when the publisher exits.
+func NewMarkerInMemory() Marker {
+	return &markerMemory{
+		marks:        make(map[string]Mark),
+		timeProvider: RealTimeProvider{},
+	}
+}
+
+func (m *markerMemory) Start(releaseInfo ReleaseInfo) (Mark, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mark := newMark(releaseInfo, m.now())
+	if _, ok := m.marks[markPath(mark)]; ok {
+		return mark, fmt.Errorf("%w: %s was already started at %s", ErrMarkerConflict, mark.AppName, mark.Start)
+	}
+	m.marks[markPath(mark)] = mark
+
+	return mark, nil
+}
+
+func (m *markerMemory) End(mark Mark) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mark.Start.IsZero() {
+		return ErrNotStartedMark
+	}
+	started, ok := m.marks[markPath(mark)]
+	if !ok {
+		return fmt.Errorf("%w started:%s appName:%s runID:%s", ErrNoStartedMarkerFoundForApp, mark.Start, mark.AppName, mark.RunID)
+	}
+	if err := endMark(&started, mark, m.now); err != nil {
+		return err
+	}
+	m.marks[markPath(mark)] = started
+
+	return nil
+}
+
+func (m *markerMemory) List(filter Filter) ([]Mark, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	marks := make([]Mark, 0, len(m.marks))
+	for _, mark := range m.marks {
+		marks = append(marks, mark)
+	}
+
+	return selectMarks(marks, filter), nil
+}
+
+func (m *markerMemory) now() time.Time {
+	return m.timeProvider.Now().UTC()
+}
@@ -0,0 +1,219 @@
+package release
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMarker is the behaviour shared by every Marker, created by newMarker with a clock.
+func testMarker(t *testing.T, newMarker func(t *testing.T, clock TimeProvider) Marker) {
+	t.Run("start and end", func(t *testing.T) {
+		marker := newMarker(t, newStepClock())
+
+		mark, err := marker.Start(ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.0", RunID: "run1"})
+		require.NoError(t, err)
+		assert.Equal(t, StatusStarted, mark.Status)
+
+		marks, err := marker.List(Filter{})
+		require.NoError(t, err)
+		require.Len(t, marks, 1)
+		assert.True(t, marks[0].NeverEnded())
+
+		mark.Status = StatusSucceeded
+		mark.Artifacts = []Artifact{{Key: "nri-redis.tar.gz", Size: 4, SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}}
+		require.NoError(t, marker.End(mark))
+
+		marks, err = marker.List(Filter{})
+		require.NoError(t, err)
+		require.Len(t, marks, 1)
+		assert.Equal(t, "v1.9.0", marks[0].Tag)
+		assert.Equal(t, StatusSucceeded, marks[0].Status)
+		assert.Equal(t, mark.Artifacts, marks[0].Artifacts)
+		assert.True(t, marks[0].End.After(marks[0].Start.Time))
+	})
+
+	t.Run("releases started meanwhile are kept", func(t *testing.T) {
+		marker := newMarker(t, newStepClock())
+
+		first, err := marker.Start(ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.0", RunID: "run1"})
+		require.NoError(t, err)
+		second, err := marker.Start(ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.1", RunID: "run2"})
+		require.NoError(t, err)
+		_, err = marker.Start(ReleaseInfo{AppName: "nri-mysql", Tag: "v1.0.0", RunID: "run3"})
+		require.NoError(t, err)
+
+		first.Status, first.Error = StatusFailed, "some error"
+		require.NoError(t, marker.End(first))
+
+		marks, err := marker.List(Filter{AppName: "nri-redis"})
+		require.NoError(t, err)
+		require.Len(t, marks, 2)
+		assert.Equal(t, StatusFailed, marks[0].Outcome())
+		assert.Equal(t, "some error", marks[0].Error)
+		assert.Equal(t, second.RunID, marks[1].RunID)
+		assert.True(t, marks[1].NeverEnded())
+
+		marks, err = marker.List(Filter{Status: StatusStarted})
+		require.NoError(t, err)
+		assert.Len(t, marks, 2)
+	})
+
+	t.Run("marks are ended once", func(t *testing.T) {
+		marker := newMarker(t, newStepClock())
+
+		mark, err := marker.Start(ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.0", RunID: "run1"})
+		require.NoError(t, err)
+		require.NoError(t, marker.End(mark))
+		assert.ErrorIs(t, marker.End(mark), ErrLastMarkerEnded)
+	})
+
+	t.Run("only started marks are ended", func(t *testing.T) {
+		marker := newMarker(t, newStepClock())
+
+		assert.ErrorIs(t, marker.End(Mark{ReleaseInfo: ReleaseInfo{AppName: "nri-redis"}}), ErrNotStartedMark)
+
+		notStarted := Mark{ReleaseInfo: ReleaseInfo{AppName: "nri-redis", RunID: "run1"}, Start: CustomTime{time.Now()}}
+		assert.ErrorIs(t, marker.End(notStarted), ErrNoStartedMarkerFoundForApp)
+	})
+
+	t.Run("nothing released", func(t *testing.T) {
+		marker := newMarker(t, newStepClock())
+
+		marks, err := marker.List(Filter{})
+		require.NoError(t, err)
+		assert.Empty(t, marks)
+	})
+}
+
+func TestMarkerAWS(t *testing.T) {
+	testMarker(t, func(t *testing.T, clock TimeProvider) Marker {
+		return &markerAWS{client: newFakeS3Client(), conf: s3Config, timeProvider: clock, logger: nolog}
+	})
+}
+
+func TestMarkerAWS_view(t *testing.T) {
+	client := newFakeS3Client()
+	marker := &markerAWS{client: client, conf: s3Config, timeProvider: newStepClock(), logger: nolog}
+	view := func() []Mark {
+		var marks []Mark
+		require.NoError(t, json.Unmarshal(client.objects[legacyKey], &marks))
+		return marks
+	}
+
+	first, err := marker.Start(ReleaseInfo{AppName: "nri-redis", Tag: "v1.9.0", RunID: "run1"})
+	require.NoError(t, err)
+	_, err = marker.Start(ReleaseInfo{AppName: "nri-mysql", Tag: "v1.0.0", RunID: "run2"})
+	require.NoError(t, err)
+	require.Len(t, view(), 2)
+	assert.True(t, view()[0].NeverEnded())
+
+	first.Status = StatusSucceeded
+	require.NoError(t, marker.End(first))
+	marks := view()
+	require.Len(t, marks, 2)
+	assert.Equal(t, "run1", marks[0].RunID)
+	assert.Equal(t, StatusSucceeded, marks[0].Status)
+	assert.False(t, marks[0].End.IsZero())
+	assert.True(t, marks[1].NeverEnded())
+}
+
+func TestMarkerDir(t *testing.T) {
+	testMarker(t, func(t *testing.T, clock TimeProvider) Marker {
+		return &markerDir{dir: t.TempDir(), timeProvider: clock, logger: nolog}
+	})
+}
+
+func TestMarkerInMemory(t *testing.T) {
+	testMarker(t, func(t *testing.T, clock TimeProvider) Marker {
+		return &markerMemory{marks: make(map[string]Mark), timeProvider: clock}
+	})
+}
+
+// stepClock advances a minute every time it's read.
+type stepClock struct {
+	now time.Time
+}
+
+func newStepClock() *stepClock {
+	return &stepClock{now: time.Date(2025, 2, 26, 16, 57, 33, 0, time.UTC)}
+}
+
+func (c *stepClock) Now() time.Time {
+	c.now = c.now.Add(time.Minute)
+	return c.now
+}
+
+// fakeS3Client keeps the objects in memory, honouring the conditional writes.
+type fakeS3Client struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3Client() *fakeS3Client {
+	return &fakeS3Client{objects: make(map[string][]byte)}
+}
+
+func (c *fakeS3Client) PutObjectIfMatch(input *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current, exists := c.objects[*input.Key]
+	if (etag == "" && exists) || (etag != "" && (!exists || etag != objectETag(current))) {
+		return nil, awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), 412, "request")
+	}
+	content, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.objects[*input.Key] = content
+	return &s3.PutObjectOutput{ETag: aws.String(objectETag(content))}, nil
+}
+
+func (c *fakeS3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content, ok := c.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New("NoSuchKey", "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(content)), ETag: aws.String(objectETag(content))}, nil
+}
+
+func (c *fakeS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	c.mu.Lock()
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.Unlock()
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(output, true)
+	return nil
+}
+
+func objectETag(content []byte) string {
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,163 @@
+// Package report describes what a publishing put where: every upload with its source, destinations in the
+// bucket, size, duration and result, written as JSON for tools and as Markdown for reviewers, i.e. in the
+// summary of the GitHub workflow run.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+// Duration is a time.Duration written in JSON as seconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).Seconds())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(b, &seconds); err != nil {
+		return err
+	}
+	*d = Duration(seconds * float64(time.Second))
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).Round(time.Millisecond).String()
+}
+
+// Upload is the upload of a source file for an arch and os version. Packages added to apt repositories include
+// the publishing of the distribution in their duration and result.
+type Upload struct {
+	Type      string `json:"type"`
+	Src       string `json:"src"`
+	OsVersion string `json:"os_version,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+	// Dest holds the keys of the files written into the bucket, repository metadata regenerated excluded
+	Dest     []string  `json:"dest"`
+	Bytes    int64     `json:"bytes"`
+	Start    time.Time `json:"start"`
+	Duration Duration  `json:"duration_seconds"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Report is the outcome of a publishing, with its uploads in the order they were performed. Uploads not
+// attempted because of a previous failure are not part of it.
+type Report struct {
+	AppName  string    `json:"app_name"`
+	Tag      string    `json:"tag"`
+	Version  string    `json:"version"`
+	RunID    string    `json:"run_id"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Start    time.Time `json:"start"`
+	Duration Duration  `json:"duration_seconds"`
+	Uploads  []Upload  `json:"uploads"`
+}
+
+// Bytes returns the size of the files written by the uploads.
+func (r Report) Bytes() int64 {
+	var bytes int64
+	for _, upload := range r.Uploads {
+		bytes += upload.Bytes
+	}
+	return bytes
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	if r.Uploads == nil {
+		r.Uploads = []Upload{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as a Markdown table of the uploads, with the errors of the failed ones.
+func (r Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s %s %s %s\n\n", resultIcon(r.Status), r.AppName, r.Tag, r.Status)
+	fmt.Fprintf(&b, "%d uploads, %s written in %s", len(r.Uploads), formatBytes(r.Bytes()), r.Duration)
+	if r.RunID != "" {
+		fmt.Fprintf(&b, ", run %s", r.RunID)
+	}
+	b.WriteString(".\n\n")
+	if r.Error != "" {
+		fmt.Fprintf(&b, "> %s\n\n", markdownEscape(r.Error))
+	}
+	if len(r.Uploads) == 0 {
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	b.WriteString("| | Type | OS version | Arch | Source | Destination | Size | Duration |\n")
+	b.WriteString("|---|---|---|---|---|---|---:|---:|\n")
+	var failed []Upload
+	for _, upload := range r.Uploads {
+		dests := make([]string, 0, len(upload.Dest))
+		for _, dest := range upload.Dest {
+			dests = append(dests, "`"+dest+"`")
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | `%s` | %s | %s | %s |\n", resultIcon(upload.Result), upload.Type,
+			upload.OsVersion, upload.Arch, upload.Src, strings.Join(dests, "<br>"), formatBytes(upload.Bytes), upload.Duration)
+		if upload.Result == ResultFailed {
+			failed = append(failed, upload)
+		}
+	}
+	for _, upload := range failed {
+		fmt.Fprintf(&b, "\n❌ %s upload of `%s`%s: %s\n", upload.Type, upload.Src, target(upload), markdownEscape(upload.Error))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func target(upload Upload) string {
+	switch {
+	case upload.OsVersion != "":
+		return fmt.Sprintf(" for %s/%s", upload.OsVersion, upload.Arch)
+	case upload.Arch != "":
+		return " for " + upload.Arch
+	}
+	return ""
+}
+
+func resultIcon(result string) string {
+	switch result {
+	case ResultSucceeded:
+		return "✅"
+	case ResultFailed:
+		return "❌"
+	}
+	return "⚠️"
+}
+
+// markdownEscape keeps errors in a single table cell or line.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("\n", " ", "|", "\\|").Replace(s)
+}
+
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
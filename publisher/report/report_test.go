@@ -0,0 +1,87 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testReport = Report{
+	AppName:  "nri-foo",
+	Tag:      "v1.2.3",
+	Version:  "1.2.3",
+	RunID:    "42",
+	Status:   "failed",
+	Error:    "cannot publish",
+	Start:    time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	Duration: Duration(90 * time.Second),
+	Uploads: []Upload{
+		{
+			Type:     "file",
+			Src:      "/srv/assets/nri-foo_linux_1.2.3_amd64.tar.gz",
+			Arch:     "amd64",
+			Dest:     []string{"infrastructure_agent/binaries/linux/amd64/nri-foo_linux_1.2.3_amd64.tar.gz"},
+			Bytes:    2048,
+			Start:    time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC),
+			Duration: Duration(1500 * time.Millisecond),
+			Result:   ResultSucceeded,
+		},
+		{
+			Type:      "yum",
+			Src:       "/srv/assets/nri-foo-1.2.3-1.el8.x86_64.rpm",
+			OsVersion: "8",
+			Arch:      "x86_64",
+			Dest:      []string{},
+			Start:     time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC),
+			Duration:  Duration(time.Second),
+			Result:    ResultFailed,
+			Error:     "createrepo failed\nexit status 1",
+		},
+	},
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, testReport.WriteJSON(&out))
+
+	var written map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &written))
+	assert.Equal(t, 90.0, written["duration_seconds"])
+	uploads := written["uploads"].([]interface{})
+	require.Len(t, uploads, 2)
+	assert.Equal(t, 1.5, uploads[0].(map[string]interface{})["duration_seconds"])
+	assert.Equal(t, "8", uploads[1].(map[string]interface{})["os_version"])
+
+	var read Report
+	require.NoError(t, json.Unmarshal(out.Bytes(), &read))
+	assert.Equal(t, testReport, read)
+
+	out.Reset()
+	require.NoError(t, Report{}.WriteJSON(&out))
+	assert.Contains(t, out.String(), `"uploads": []`)
+}
+
+func TestReport_WriteMarkdown(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, testReport.WriteMarkdown(&out))
+
+	expected := "### ❌ nri-foo v1.2.3 failed\n\n" +
+		"2 uploads, 2.0 KiB written in 1m30s, run 42.\n\n" +
+		"> cannot publish\n\n" +
+		"| | Type | OS version | Arch | Source | Destination | Size | Duration |\n" +
+		"|---|---|---|---|---|---|---:|---:|\n" +
+		"| ✅ | file |  | amd64 | `/srv/assets/nri-foo_linux_1.2.3_amd64.tar.gz` | `infrastructure_agent/binaries/linux/amd64/nri-foo_linux_1.2.3_amd64.tar.gz` | 2.0 KiB | 1.5s |\n" +
+		"| ❌ | yum | 8 | x86_64 | `/srv/assets/nri-foo-1.2.3-1.el8.x86_64.rpm` |  | 0 B | 1s |\n" +
+		"\n❌ yum upload of `/srv/assets/nri-foo-1.2.3-1.el8.x86_64.rpm` for 8/x86_64: createrepo failed exit status 1\n"
+	assert.Equal(t, expected, out.String())
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "19.0 MiB", formatBytes(19*1024*1024))
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidVersion = errors.New("invalid semantic version")
+
+// Version is a semantic version (https://semver.org) as found in release tags, i.e. v1.2.3-rc.1+build.5
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease string
+	Build      string
+}
+
+// Parse parses a semantic version. A single leading "v" is accepted, as commonly used in tags.
+func Parse(s string) (Version, error) {
+	var v Version
+	str := strings.TrimPrefix(s, "v")
+
+	if i := strings.Index(str, "+"); i >= 0 {
+		v.Build = str[i+1:]
+		str = str[:i]
+		if err := validateIdentifiers(v.Build, false); err != nil {
+			return Version{}, fmt.Errorf("%w: '%s' build: %v", ErrInvalidVersion, s, err)
+		}
+	}
+
+	if i := strings.Index(str, "-"); i >= 0 {
+		v.Prerelease = str[i+1:]
+		str = str[:i]
+		if err := validateIdentifiers(v.Prerelease, true); err != nil {
+			return Version{}, fmt.Errorf("%w: '%s' prerelease: %v", ErrInvalidVersion, s, err)
+		}
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("%w: '%s' should be MAJOR.MINOR.PATCH", ErrInvalidVersion, s)
+	}
+
+	nums := make([]uint64, len(parts))
+	for i, part := range parts {
+		if !isNumeric(part) || hasLeadingZero(part) {
+			return Version{}, fmt.Errorf("%w: '%s' invalid number '%s'", ErrInvalidVersion, s, part)
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("%w: '%s' invalid number '%s'", ErrInvalidVersion, s, part)
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+
+	return v, nil
+}
+
+// IsPrerelease returns true when the version has prerelease identifiers, i.e. 1.0.0-rc.1
+func (v Version) IsPrerelease() bool {
+	return v.Prerelease != ""
+}
+
+// String returns the version without the leading "v".
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// validateIdentifiers checks dot separated identifiers are non-empty and only contain [0-9A-Za-z-].
+// Numeric prerelease identifiers must not include leading zeroes.
+func validateIdentifiers(s string, prerelease bool) error {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return errors.New("empty identifier")
+		}
+		for _, r := range id {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return fmt.Errorf("invalid character '%c' in identifier '%s'", r, id)
+			}
+		}
+		if prerelease && isNumeric(id) && hasLeadingZero(id) {
+			return fmt.Errorf("leading zero in numeric identifier '%s'", id)
+		}
+	}
+	return nil
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func hasLeadingZero(s string) bool {
+	return len(s) > 1 && s[0] == '0'
+}
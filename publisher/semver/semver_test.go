@@ -0,0 +1,59 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected Version
+		str      string
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, "1.2.3"},
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, "1.2.3"},
+		{"v1.0.0-dev", Version{Major: 1, Prerelease: "dev"}, "1.0.0-dev"},
+		{"v10.20.30-rc.1+build.5", Version{Major: 10, Minor: 20, Patch: 30, Prerelease: "rc.1", Build: "build.5"}, "10.20.30-rc.1+build.5"},
+		{"v1.0.0+20230101.sha-0ab", Version{Major: 1, Build: "20230101.sha-0ab"}, "1.0.0+20230101.sha-0ab"},
+		{"1.0.0-alpha-beta.0", Version{Major: 1, Prerelease: "alpha-beta.0"}, "1.0.0-alpha-beta.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			v, err := Parse(tt.tag)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+			assert.Equal(t, tt.str, v.String())
+			assert.Equal(t, tt.expected.Prerelease != "", v.IsPrerelease())
+		})
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"v",
+		"vFooBar",
+		"1.2",
+		"1.2.3.4",
+		"vv1.2.3",
+		"01.2.3",
+		"1.2.x",
+		"1.2.3-",
+		"1.2.3-rc..1",
+		"1.2.3-01",
+		"1.2.3+",
+		"1.2.3-rc_1",
+		"-1.2.3",
+	}
+
+	for _, tag := range tests {
+		t.Run(tag, func(t *testing.T) {
+			_, err := Parse(tag)
+			assert.ErrorIs(t, err, ErrInvalidVersion)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package trace
+
+import (
+	"encoding/hex"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+)
+
+const (
+	spanKindInternal = 1
+	statusCodeOk     = 1
+	statusCodeError  = 2
+)
+
+// ExportOTLP exports the spans ended to an OpenTelemetry collector, with the attributes of the resource.
+func (t *Tracer) ExportOTLP(client *otlp.Client, attrs ...otlp.KeyValue) error {
+	return client.Export(otlp.TracesPath, t.otlpPayload(attrs))
+}
+
+type otlpTracesPayload struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlp.Resource    `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlp.Scope `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlp.KeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (t *Tracer) otlpPayload(attrs []otlp.KeyValue) otlpTracesPayload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := make([]otlpSpan, 0, len(t.ended))
+	for _, s := range t.ended {
+		parentID := s.parentID
+		if parentID == (SpanID{}) {
+			parentID = t.remoteParentID
+		}
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(t.traceID[:]),
+			SpanID:            hex.EncodeToString(s.id[:]),
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: otlp.UnixNano(s.start),
+			EndTimeUnixNano:   otlp.UnixNano(s.end),
+			Attributes:        s.attrs,
+			Status:            otlpStatus{Code: statusCodeOk},
+		}
+		if parentID != (SpanID{}) {
+			span.ParentSpanID = hex.EncodeToString(parentID[:])
+		}
+		if s.err != "" {
+			span.Status = otlpStatus{Code: statusCodeError, Message: s.err}
+		}
+		spans = append(spans, span)
+	}
+
+	return otlpTracesPayload{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlp.NewResource(attrs...),
+		ScopeSpans: []otlpScopeSpans{{Scope: otlp.Scope{Name: otlp.ScopeName}, Spans: spans}},
+	}}}
+}
@@ -0,0 +1,31 @@
+package trace
+
+import (
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+)
+
+// marker traces the writes of the release markers recorded by another marker.
+type marker struct {
+	release.Marker
+	tracer *Tracer
+}
+
+// NewMarker returns a marker recording the releases with the given one in spans of the tracer.
+func NewMarker(m release.Marker, tracer *Tracer) release.Marker {
+	return &marker{Marker: m, tracer: tracer}
+}
+
+func (m *marker) Start(releaseInfo release.ReleaseInfo) (release.Mark, error) {
+	span := m.tracer.Start("release marker start")
+	mark, err := m.Marker.Start(releaseInfo)
+	span.End(err)
+	return mark, err
+}
+
+func (m *marker) End(mark release.Mark) error {
+	span := m.tracer.Start("release marker end", otlp.String("status", mark.Status))
+	err := m.Marker.End(mark)
+	span.End(err)
+	return err
+}
@@ -0,0 +1,159 @@
+// Package trace records the spans of a publishing, like its phases, uploads and commands, to find where its time
+// goes. They are kept in memory and exported once the publishing ends to an OpenTelemetry collector.
+//
+// The publishing is sequential, so spans are parented to the span in progress when started instead of passing a
+// context around. A trace started by the calling workflow is continued with its W3C traceparent, and the span of
+// every command is propagated to it in the TRACEPARENT environment variable.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+)
+
+// EnvTraceparent is the environment variable propagating the trace context to commands.
+const EnvTraceparent = "TRACEPARENT"
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+// Span is a timed operation, failed when ended with an error.
+type Span struct {
+	tracer   *Tracer
+	parent   *Span
+	id       SpanID
+	parentID SpanID
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    []otlp.KeyValue
+	err      string
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...otlp.KeyValue) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End ends the span, failed when err is not nil. The span it was started in is in progress again.
+func (s *Span) End(err error) {
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = t.now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	if t.current == s {
+		t.current = s.parent
+	}
+	t.ended = append(t.ended, s)
+}
+
+// Traceparent returns the W3C traceparent of the span, to continue the trace in other processes.
+func (s *Span) Traceparent() string {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	return traceparent(s.tracer.traceID, s.id)
+}
+
+// Tracer records the spans of a trace.
+type Tracer struct {
+	mu      sync.Mutex
+	traceID TraceID
+	// remoteParentID is the span of the calling workflow the spans without parent are children of
+	remoteParentID SpanID
+	current        *Span
+	ended          []*Span
+	now            func() time.Time
+}
+
+// NewTracer returns a tracer starting a new trace.
+func NewTracer() *Tracer {
+	t := &Tracer{now: time.Now}
+	_, _ = rand.Read(t.traceID[:])
+	return t
+}
+
+// Default records the spans of the publisher.
+var Default = NewTracer()
+
+// Start starts a span of the default tracer, see Tracer.Start.
+func Start(name string, attrs ...otlp.KeyValue) *Span {
+	return Default.Start(name, attrs...)
+}
+
+// Start starts a span child of the span in progress, being the one in progress until it ends.
+func (t *Tracer) Start(name string, attrs ...otlp.KeyValue) *Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &Span{tracer: t, parent: t.current, name: name, start: t.now(), attrs: attrs}
+	_, _ = rand.Read(s.id[:])
+	if t.current != nil {
+		s.parentID = t.current.id
+	}
+	t.current = s
+	return s
+}
+
+// SetParent continues the trace of the W3C traceparent, version 00, i.e. of the calling workflow. The spans
+// recorded without parent become children of its span.
+func (t *Tracer) SetParent(tp string) error {
+	traceID, parentID, err := parseTraceparent(tp)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.traceID, t.remoteParentID = traceID, parentID
+	return nil
+}
+
+// Traceparent returns the W3C traceparent of the span in progress, the parent one when none.
+func (t *Tracer) Traceparent() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil {
+		return traceparent(t.traceID, t.current.id)
+	}
+	if t.remoteParentID != (SpanID{}) {
+		return traceparent(t.traceID, t.remoteParentID)
+	}
+	return ""
+}
+
+func traceparent(traceID TraceID, spanID SpanID) string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(traceID[:]), hex.EncodeToString(spanID[:]))
+}
+
+func parseTraceparent(tp string) (traceID TraceID, parentID SpanID, err error) {
+	parts := strings.Split(strings.TrimSpace(tp), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, fmt.Errorf("%w '%s', expected 00-<trace id>-<parent id>-<flags>", ErrInvalidTraceparent, tp)
+	}
+	if _, err = hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, fmt.Errorf("%w '%s': %v", ErrInvalidTraceparent, tp, err)
+	}
+	if _, err = hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, fmt.Errorf("%w '%s': %v", ErrInvalidTraceparent, tp, err)
+	}
+	if traceID == (TraceID{}) || parentID == (SpanID{}) {
+		return traceID, parentID, fmt.Errorf("%w '%s': zero trace or parent id", ErrInvalidTraceparent, tp)
+	}
+	return traceID, parentID, nil
+}
@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const workflowTraceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func newTestTracer() *Tracer {
+	t := NewTracer()
+	tick := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	t.now = func() time.Time {
+		tick = tick.Add(time.Second)
+		return tick
+	}
+	return t
+}
+
+// exportSpans exports the spans of the tracer to a collector stand-in, returning them by name.
+func exportSpans(t *testing.T, tracer *Tracer) map[string]otlpSpan {
+	var payload otlpTracesPayload
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, otlp.TracesPath, r.URL.Path)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &payload))
+	}))
+	defer collector.Close()
+
+	require.NoError(t, tracer.ExportOTLP(otlp.NewClient(collector.URL, nil), otlp.String("app", "nri-foo")))
+	require.Len(t, payload.ResourceSpans, 1)
+	assert.Contains(t, payload.ResourceSpans[0].Resource.Attributes, otlp.String("app", "nri-foo"))
+	spans := map[string]otlpSpan{}
+	for _, span := range payload.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTracer(t *testing.T) {
+	tracer := newTestTracer()
+	assert.Empty(t, tracer.Traceparent())
+
+	root := tracer.Start("publish")
+	phase := tracer.Start("upload")
+	cmd := tracer.Start("exec createrepo", otlp.String("cmd", "createrepo"))
+	assert.Equal(t, cmd.Traceparent(), tracer.Traceparent())
+	cmd.End(errors.New("exit status 1"))
+	assert.Equal(t, phase.Traceparent(), tracer.Traceparent(), "the parent span is in progress again")
+	tracer.Start("exec gpg").End(nil)
+	phase.End(nil)
+	root.End(nil)
+
+	spans := exportSpans(t, tracer)
+	require.Len(t, spans, 4)
+	assert.Empty(t, spans["publish"].ParentSpanID)
+	assert.Equal(t, spans["publish"].SpanID, spans["upload"].ParentSpanID)
+	assert.Equal(t, spans["upload"].SpanID, spans["exec createrepo"].ParentSpanID)
+	assert.Equal(t, spans["upload"].SpanID, spans["exec gpg"].ParentSpanID)
+	assert.Equal(t, spans["publish"].TraceID, spans["exec gpg"].TraceID)
+
+	failed := spans["exec createrepo"]
+	assert.Equal(t, otlpStatus{Code: statusCodeError, Message: "exit status 1"}, failed.Status)
+	assert.Equal(t, []otlp.KeyValue{otlp.String("cmd", "createrepo")}, failed.Attributes)
+	assert.Equal(t, "1714557603000000000", failed.StartTimeUnixNano)
+	assert.Equal(t, "1714557604000000000", failed.EndTimeUnixNano)
+	assert.Equal(t, otlpStatus{Code: statusCodeOk}, spans["exec gpg"].Status)
+}
+
+func TestTracer_SetParent(t *testing.T) {
+	tracer := newTestTracer()
+	root := tracer.Start("publish")
+	require.NoError(t, tracer.SetParent(workflowTraceparent))
+	assert.Regexp(t, "^00-0af7651916cd43dd8448eb211c80319c-[0-9a-f]{16}-01$", root.Traceparent())
+	root.End(nil)
+	assert.Equal(t, workflowTraceparent, tracer.Traceparent())
+
+	spans := exportSpans(t, tracer)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans["publish"].TraceID)
+	assert.Equal(t, "b7ad6b7169203331", spans["publish"].ParentSpanID)
+
+	for _, invalid := range []string{
+		"",
+		"01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-0af7651916cd43dd8448eb211c80319z-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+	} {
+		assert.ErrorIs(t, tracer.SetParent(invalid), ErrInvalidTraceparent, invalid)
+	}
+}
+
+func TestMarker(t *testing.T) {
+	tracer := newTestTracer()
+	m := NewMarker(release.NewMarkerInMemory(), tracer)
+
+	mark, err := m.Start(release.ReleaseInfo{AppName: "nri-foo", Tag: "v1.2.3"})
+	require.NoError(t, err)
+	mark.Status = release.StatusSucceeded
+	require.NoError(t, m.End(mark))
+	assert.ErrorIs(t, m.End(mark), release.ErrLastMarkerEnded)
+
+	spans := exportSpans(t, tracer)
+	require.Len(t, spans, 2)
+	assert.Equal(t, otlpStatus{Code: statusCodeOk}, spans["release marker start"].Status)
+	end := spans["release marker end"]
+	assert.Equal(t, statusCodeError, end.Status.Code, "ending the release twice fails its span")
+	assert.Equal(t, []otlp.KeyValue{otlp.String("status", release.StatusSucceeded)}, end.Attributes)
+}
@@ -0,0 +1,93 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/config"
+	"github.com/newrelic/infrastructure-publish-action/publisher/metrics"
+	"github.com/newrelic/infrastructure-publish-action/publisher/release"
+	"github.com/newrelic/infrastructure-publish-action/publisher/report"
+)
+
+// manifest collects the artifacts copied into the bucket, recorded in the release marker, and the uploads
+// copying them, for the report. Repository metadata regenerated by the publishing is not part of it.
+type manifest struct {
+	destFolder string
+	artifacts  []release.Artifact
+	uploads    []*report.Upload
+	// current is the upload the artifacts added belong to
+	current *report.Upload
+}
+
+// begin records the start of the upload of the source file of a target, the artifacts added until the next
+// one belong to it.
+func (m *manifest) begin(uploadType string, target config.Target, srcPath string) *report.Upload {
+	m.current = &report.Upload{
+		Type:      uploadType,
+		Src:       srcPath,
+		OsVersion: target.OsVersion,
+		Arch:      target.Arch,
+		Dest:      []string{},
+		Start:     time.Now(),
+	}
+	m.uploads = append(m.uploads, m.current)
+	return m.current
+}
+
+// end records the result of uploads, failed when err is not nil.
+func (m *manifest) end(err error, uploads ...*report.Upload) {
+	for _, upload := range uploads {
+		upload.Duration = report.Duration(time.Since(upload.Start))
+		upload.Result = report.ResultSucceeded
+		if err != nil {
+			upload.Result, upload.Error = report.ResultFailed, err.Error()
+		}
+		metrics.UploadSeconds.Add(time.Duration(upload.Duration).Seconds(), upload.Type, upload.OsVersion, upload.Arch)
+		metrics.Uploads.Add(1, upload.Type, upload.Result)
+		metrics.UploadedBytes.Add(float64(upload.Bytes), upload.Type)
+	}
+}
+
+// report returns the uploads recorded.
+func (m *manifest) report() []report.Upload {
+	uploads := make([]report.Upload, 0, len(m.uploads))
+	for _, upload := range m.uploads {
+		uploads = append(uploads, *upload)
+	}
+	return uploads
+}
+
+// add records the source file copied into destPath, a path in the mounted bucket.
+func (m *manifest) add(srcPath, destPath string) error {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+
+	key, err := filepath.Rel(m.destFolder, destPath)
+	if err != nil {
+		return err
+	}
+	m.artifacts = append(m.artifacts, release.Artifact{
+		Key:    filepath.ToSlash(key),
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	if m.current != nil {
+		m.current.Dest = append(m.current.Dest, filepath.ToSlash(key))
+		m.current.Bytes += size
+	}
+	return nil
+}
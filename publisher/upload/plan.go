@@ -0,0 +1,83 @@
+package upload
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/config"
+)
+
+// PlannedUpload is a source file the publishing copies into a repository.
+type PlannedUpload struct {
+	Type      string
+	Src       string
+	Dest      string
+	Arch      string
+	OsVersion string
+}
+
+func (p PlannedUpload) String() string {
+	target := p.Arch
+	if p.OsVersion != "" {
+		target = fmt.Sprintf("%s/%s", p.OsVersion, p.Arch)
+	}
+	return fmt.Sprintf("%-4s %-16s %s -> %s", p.Type, target, p.Src, p.Dest)
+}
+
+// Plan lists the uploads UploadArtifacts performs for the schemas, in the same order, with the destination
+// of the package in the bucket, relative to the artifacts destination folder. Templates that can't be rendered,
+// i.e. with unknown placeholders, are errors.
+func Plan(conf config.Config, schemas config.UploadArtifactSchemas) ([]PlannedUpload, error) {
+	var plan []PlannedUpload
+	for _, schema := range schemas {
+		for _, upload := range schema.Uploads {
+			targets := schema.Targets(upload)
+			if upload.Type == config.TypeApt {
+				// packages of every arch are added to each distribution in turn
+				var sorted []config.Target
+				osVersions, archs := targetsByOsVersion(targets)
+				for _, osVersion := range osVersions {
+					for _, arch := range archs[osVersion] {
+						sorted = append(sorted, config.Target{Arch: arch, OsVersion: osVersion})
+					}
+				}
+				targets = sorted
+			}
+
+			if upload.Type == config.TypeApt && !conf.AptSkipMirror {
+				if _, err := upload.SrcRepoURL(conf.TemplateContext(config.Target{}), conf.MirrorHost); err != nil {
+					return nil, fmt.Errorf("src_repo of %s upload of %s: %w", upload.Type, schema.Src, err)
+				}
+			}
+			for _, target := range targets {
+				planned, err := planUpload(conf, schema, upload, target)
+				if err != nil {
+					return nil, err
+				}
+				plan = append(plan, planned)
+			}
+		}
+	}
+	return plan, nil
+}
+
+func planUpload(conf config.Config, schema config.UploadArtifactSchema, upload config.Upload, target config.Target) (PlannedUpload, error) {
+	planned := PlannedUpload{Type: upload.Type, Arch: target.Arch, OsVersion: target.OsVersion}
+	ctx := conf.TemplateContext(target)
+
+	var err error
+	if planned.Src, err = schema.SrcFile(ctx); err != nil {
+		return PlannedUpload{}, fmt.Errorf("src of %s: %w", schema.Src, err)
+	}
+	if planned.Dest, err = upload.DestPath(ctx, planned.Src); err != nil {
+		return PlannedUpload{}, fmt.Errorf("dest of %s upload of %s: %w", upload.Type, schema.Src, err)
+	}
+
+	switch upload.Type {
+	case config.TypeYum, config.TypeZypp:
+		planned.Dest = path.Join(planned.Dest, planned.Src)
+	case config.TypeApt:
+		planned.Dest = path.Join(planned.Dest, aptPoolMain, string(planned.Src[0]), conf.AppName, planned.Src)
+	}
+	return planned, nil
+}
@@ -0,0 +1,125 @@
+package upload
+
+import (
+	"testing"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/config"
+	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	conf := config.Config{AppName: "nri-foo", Tag: "v1.2.3", Version: "1.2.3", DestPrefix: "infrastructure_agent/"}
+	schemas := config.UploadArtifactSchemas{
+		{
+			Src:  "{app_name}_linux_{version}_{arch}.tar.gz",
+			Arch: []string{"amd64"},
+			Uploads: []config.Upload{
+				{Type: config.TypeFile, Dest: "{dest_prefix}binaries/linux/{arch}/{src}"},
+			},
+		},
+		{
+			Src:     "{app_name}-{version}-1.el{os_version}.{arch}.rpm",
+			Arch:    []string{"amd64", "arm64"},
+			Exclude: []config.MatrixRule{{Arch: "arm64", OsVersion: "6"}},
+			Uploads: []config.Upload{
+				{Type: config.TypeYum, Dest: "{dest_prefix}linux/yum/el/{os_version}/{arch}/", OsVersion: []string{"6", "7"}},
+			},
+		},
+		{
+			Src:     "{app_name}_{version}-1_{arch}.deb",
+			Arch:    []string{"amd64", "arm64"},
+			Exclude: []config.MatrixRule{{Arch: "arm64", OsVersion: "bionic"}},
+			Uploads: []config.Upload{
+				{Type: config.TypeApt, Dest: "{dest_prefix}linux/apt/", OsVersion: []string{"bionic", "noble"}},
+			},
+		},
+	}
+
+	expected := []PlannedUpload{
+		{Type: "file", Arch: "amd64", Src: "nri-foo_linux_1.2.3_amd64.tar.gz", Dest: "infrastructure_agent/binaries/linux/amd64/nri-foo_linux_1.2.3_amd64.tar.gz"},
+		{Type: "yum", Arch: "amd64", OsVersion: "6", Src: "nri-foo-1.2.3-1.el6.amd64.rpm", Dest: "infrastructure_agent/linux/yum/el/6/amd64/nri-foo-1.2.3-1.el6.amd64.rpm"},
+		{Type: "yum", Arch: "amd64", OsVersion: "7", Src: "nri-foo-1.2.3-1.el7.amd64.rpm", Dest: "infrastructure_agent/linux/yum/el/7/amd64/nri-foo-1.2.3-1.el7.amd64.rpm"},
+		{Type: "yum", Arch: "arm64", OsVersion: "7", Src: "nri-foo-1.2.3-1.el7.arm64.rpm", Dest: "infrastructure_agent/linux/yum/el/7/aarch64/nri-foo-1.2.3-1.el7.arm64.rpm"},
+		{Type: "apt", Arch: "amd64", OsVersion: "bionic", Src: "nri-foo_1.2.3-1_amd64.deb", Dest: "infrastructure_agent/linux/apt/pool/main/n/nri-foo/nri-foo_1.2.3-1_amd64.deb"},
+		{Type: "apt", Arch: "amd64", OsVersion: "noble", Src: "nri-foo_1.2.3-1_amd64.deb", Dest: "infrastructure_agent/linux/apt/pool/main/n/nri-foo/nri-foo_1.2.3-1_amd64.deb"},
+		{Type: "apt", Arch: "arm64", OsVersion: "noble", Src: "nri-foo_1.2.3-1_arm64.deb", Dest: "infrastructure_agent/linux/apt/pool/main/n/nri-foo/nri-foo_1.2.3-1_arm64.deb"},
+	}
+
+	plan, err := Plan(conf, schemas)
+	require.NoError(t, err)
+	assert.Equal(t, expected, plan)
+}
+
+func Test_targetsByOsVersion(t *testing.T) {
+	osVersions, archs := targetsByOsVersion([]config.Target{
+		{Arch: "amd64", OsVersion: "bionic"},
+		{Arch: "amd64", OsVersion: "noble"},
+		{Arch: "arm64", OsVersion: "noble"},
+		{Arch: "386", OsVersion: "bionic"},
+	})
+
+	assert.Equal(t, []string{"bionic", "noble"}, osVersions)
+	assert.Equal(t, map[string][]string{"bionic": {"amd64", "386"}, "noble": {"amd64", "arm64"}}, archs)
+}
+
+func TestPlan_archMap(t *testing.T) {
+	conf := config.Config{AppName: "nri-foo", Tag: "v1.2.3", Version: "1.2.3"}
+	schemas := config.UploadArtifactSchemas{
+		{
+			Src:  "{app_name}-{version}.{arch}.rpm",
+			Arch: []string{"arm", "arm64"},
+			Uploads: []config.Upload{
+				{Type: config.TypeYum, Dest: "yum/{os_version}/{arch}/", OsVersion: []string{"9"}, ArchMap: map[string]string{"arm": "armv7hl"}},
+				{Type: config.TypeFile, Dest: "binaries/{dest_arch}/{src}", ArchMap: map[string]string{"arm64": "aarch64"}},
+			},
+		},
+	}
+
+	plan, err := Plan(conf, schemas)
+	require.NoError(t, err)
+	var dests []string
+	for _, planned := range plan {
+		dests = append(dests, planned.Dest)
+	}
+
+	expected := []string{
+		"yum/9/armv7hl/nri-foo-1.2.3.arm.rpm",
+		"yum/9/aarch64/nri-foo-1.2.3.arm64.rpm",
+		"binaries/arm/nri-foo-1.2.3.arm.rpm",
+		"binaries/aarch64/nri-foo-1.2.3.arm64.rpm",
+	}
+	assert.Equal(t, expected, dests)
+}
+
+func TestPlan_unresolvedPlaceholders(t *testing.T) {
+	conf := config.Config{AppName: "nri-foo", Tag: "v1.2.3", Version: "1.2.3", MirrorHost: "https://download.newrelic.com"}
+	tests := []struct {
+		name    string
+		upload  config.Upload
+		message string
+	}{
+		{
+			name:    "dest",
+			upload:  config.Upload{Type: config.TypeFile, Dest: "/{flavour}/{src}"},
+			message: "dest of file upload of {app_name}_{version}_{arch}.tar.gz: unresolved placeholder {flavour} in /{flavour}/{src}",
+		},
+		{
+			name:    "src_repo",
+			upload:  config.Upload{Type: config.TypeApt, SrcRepo: "{access_point}/apt", Dest: "/apt", OsVersion: []string{"noble"}},
+			message: "src_repo of apt upload of {app_name}_{version}_{arch}.tar.gz: unresolved placeholder {access_point} in {access_point}/apt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemas := config.UploadArtifactSchemas{
+				{Src: "{app_name}_{version}_{arch}.tar.gz", Arch: []string{"amd64"}, Uploads: []config.Upload{tt.upload}},
+			}
+			_, err := Plan(conf, schemas)
+			require.ErrorIs(t, err, utils.ErrUnresolvedPlaceholder)
+			assert.EqualError(t, err, tt.message)
+		})
+	}
+}
@@ -9,12 +9,14 @@ import (
 	"os"
 	"path"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/newrelic/infrastructure-publish-action/publisher/config"
-	"github.com/newrelic/infrastructure-publish-action/publisher/download"
 	"github.com/newrelic/infrastructure-publish-action/publisher/lock"
+	"github.com/newrelic/infrastructure-publish-action/publisher/metrics"
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+	"github.com/newrelic/infrastructure-publish-action/publisher/report"
+	"github.com/newrelic/infrastructure-publish-action/publisher/trace"
 	"github.com/newrelic/infrastructure-publish-action/publisher/utils"
 )
 
@@ -28,35 +30,27 @@ const (
 	s3Retries = 10
 )
 
-func uploadArtifact(conf config.Config, schema config.UploadArtifactSchema, upload config.Upload) (err error) {
+func uploadArtifact(conf config.Config, schema config.UploadArtifactSchema, upload config.Upload, written *manifest) (err error) {
+	targets := schema.Targets(upload)
 	if upload.Type == config.TypeFile {
-		utils.Logger.Println("Uploading file artifact")
-		for _, arch := range schema.Arch {
-			if len(upload.OsVersion) == 0 {
-				err = uploadFileArtifact(conf, schema, upload, arch, "")
-				if err != nil {
-					return err
-				}
-			} else {
-				for _, osVersion := range upload.OsVersion {
-					err = uploadFileArtifact(conf, schema, upload, arch, osVersion)
-					if err != nil {
-						return err
-					}
-				}
+		utils.Logger.Info("uploading file artifact", "src", schema.Src)
+		for _, target := range targets {
+			err = uploadFileArtifact(conf, schema, upload, target, written)
+			if err != nil {
+				return err
 			}
 		}
 	} else if upload.Type == config.TypeYum || upload.Type == config.TypeZypp {
-		utils.Logger.Println("Uploading rpm as yum or zypp")
-		for _, arch := range schema.Arch {
-			err = uploadRpm(conf, schema.Src, upload, arch)
+		utils.Logger.Info("uploading rpm", "type", upload.Type, "src", schema.Src)
+		for _, target := range targets {
+			err = uploadRpm(conf, schema, upload, target, written)
 			if err != nil {
 				return err
 			}
 		}
 	} else if upload.Type == config.TypeApt {
-		utils.Logger.Println("Uploading apt")
-		err = uploadApt(conf, schema.Src, upload, schema.Arch)
+		utils.Logger.Info("uploading apt", "src", schema.Src)
+		err = uploadApt(conf, schema, upload, targets, written)
 		if err != nil {
 			return err
 		}
@@ -65,29 +59,66 @@ func uploadArtifact(conf config.Config, schema config.UploadArtifactSchema, uplo
 	return nil
 }
 
-func UploadArtifacts(conf config.Config, schema config.UploadArtifactSchemas, bucketLock lock.BucketLock, releaseMarker release.Marker) (err error) {
+// UploadArtifacts publishes the artifacts of the schemas holding the lock of the bucket, recording the release with
+// the marker. The report, when not nil, is filled with the outcome of the release once started.
+func UploadArtifacts(conf config.Config, schema config.UploadArtifactSchemas, bucketLock lock.BucketLock, releaseMarker release.Marker, rep *report.Report) (err error) {
+	lockStart := time.Now()
+	lockSpan := trace.Start("lock")
 	if err = bucketLock.Lock(); err != nil {
+		lockSpan.End(err)
 		return
 	}
+	lockSpan.End(nil)
+	metrics.LockWait.Set(time.Since(lockStart).Seconds())
 	// Write the release marker
 	mark, err := releaseMarker.Start(
 		release.ReleaseInfo{
-			AppName:   conf.AppName,
-			Tag:       conf.Tag,
-			RunID:     conf.RunID,
-			RepoName:  conf.RepoName,
-			Schema:    conf.Schema,
-			SchemaURL: conf.SchemaURL,
+			AppName:              conf.AppName,
+			Tag:                  conf.Tag,
+			RunID:                conf.RunID,
+			RepoName:             conf.RepoName,
+			Schema:               conf.Schema,
+			SchemaURL:            conf.SchemaURL,
+			SchemaSHA256:         conf.SchemaSHA256,
+			SchemaResolvedSHA256: conf.SchemaResolvedSHA256,
+			PublisherVersion:     release.PublisherVersion,
 		},
 	)
 	if err != nil {
 		return fmt.Errorf("cannot start release marker: %w", err)
 	}
 
+	started := time.Now()
+	written := &manifest{destFolder: conf.ArtifactsDestFolder}
 	defer func() {
+		// the outcome of the release is recorded even when panicking, before going on with it
+		recovered := recover()
+		switch {
+		case recovered != nil:
+			mark.Status, mark.Error = release.StatusAborted, fmt.Sprint(recovered)
+		case err != nil:
+			mark.Status, mark.Error = release.StatusFailed, err.Error()
+		default:
+			mark.Status = release.StatusSucceeded
+		}
+		mark.Artifacts = written.artifacts
+		if rep != nil {
+			*rep = report.Report{
+				AppName:  conf.AppName,
+				Tag:      conf.Tag,
+				Version:  conf.Version,
+				RunID:    conf.RunID,
+				Status:   mark.Status,
+				Error:    mark.Error,
+				Start:    started,
+				Duration: report.Duration(time.Since(started)),
+				Uploads:  written.report(),
+			}
+		}
+
 		markerErr := releaseMarker.End(mark)
 		if markerErr != nil {
-			utils.Logger.Printf("ERROR: cannot end release marker %v", markerErr)
+			utils.Logger.Error("cannot end release marker", "error", markerErr)
 		}
 
 		errRelease := bucketLock.Release()
@@ -96,12 +127,14 @@ func UploadArtifacts(conf config.Config, schema config.UploadArtifactSchemas, bu
 		} else if errRelease != nil {
 			err = fmt.Errorf("got 2 errors: uploading: \"%v\", releasing lock: \"%v\"", err, errRelease)
 		}
-		return
+		if recovered != nil {
+			panic(recovered)
+		}
 	}()
 
 	for _, artifactSchema := range schema {
 		for _, upload := range artifactSchema.Uploads {
-			err := uploadArtifact(conf, artifactSchema, upload)
+			err := uploadArtifact(conf, artifactSchema, upload, written)
 			if err != nil {
 				return err
 			}
@@ -111,162 +144,161 @@ func UploadArtifacts(conf config.Config, schema config.UploadArtifactSchemas, bu
 	return nil
 }
 
-func uploadRpm(conf config.Config, srcTemplate string, uploadConf config.Upload, arch string) (err error) {
-
-	// RPM specific architecture variables
-	destPathArch := arch
-	switch destPathArch {
-	case "arm64":
-		destPathArch = "aarch64"
-	}
-
-	for _, osVersion := range uploadConf.OsVersion {
-		utils.Logger.Printf("[ ] Start uploading rpm for os %s/%s", osVersion, arch)
-
-		downloadedRpmFileName := download.GenerateDownloadFileName(
-			srcTemplate,
-			conf.RepoName,
-			conf.AppName,
-			arch,
-			conf.Tag,
-			conf.Version,
-			conf.DestPrefix,
-			osVersion)
-
-		destPath := generateDestinationAssetsPath(
-			downloadedRpmFileName,
-			uploadConf.Dest,
-			conf.RepoName,
-			conf.AppName,
-			destPathArch,
-			conf.Tag,
-			conf.Version,
-			conf.DestPrefix,
-			osVersion)
-
-		downloadedRpmFilePath := path.Join(conf.ArtifactsSrcFolder, downloadedRpmFileName)
-		s3RepoPath := path.Join(conf.ArtifactsDestFolder, destPath)
-		s3DotRepoFilepath := path.Join(s3RepoPath, "newrelic-infra.repo")
-		s3RepoData := path.Join(s3RepoPath, "repodata")
-		rpmDestinationPath := path.Join(s3RepoPath, downloadedRpmFileName)
-		s3RepomdFilepath := path.Join(s3RepoPath, repodataRpmPath)
-		signaturePath := path.Join(s3RepoPath, signatureRpmPath)
-
-		// copy rpm file to be able to add it into the index later
-		err = utils.CopyFile(downloadedRpmFilePath, rpmDestinationPath, uploadConf.Override, commandTimeout)
-		if err != nil {
-			return err
-		}
+func uploadRpm(conf config.Config, schema config.UploadArtifactSchema, uploadConf config.Upload, target config.Target, written *manifest) (err error) {
 
-		// check for repo and create if missing
-		if _, err = os.Stat(s3RepomdFilepath); os.IsNotExist(err) {
+	utils.Logger.Info("[ ] start uploading rpm", "os_version", target.OsVersion, "arch", target.Arch)
 
-			utils.Logger.Printf("[ ] Didn't find repo for %s, run repo init command", s3RepoPath)
+	downloadedRpmFileName, destPath, err := renderUpload(conf, schema, uploadConf, target)
+	if err != nil {
+		return err
+	}
 
-			if err := utils.ExecLogOutput(utils.Logger, "createrepo", commandTimeout, s3RepoPath, "-o", os.TempDir()); err != nil {
-				return err
-			}
+	downloadedRpmFilePath := path.Join(conf.ArtifactsSrcFolder, downloadedRpmFileName)
+	uploaded := written.begin(uploadConf.Type, target, downloadedRpmFilePath)
+	span := startUploadSpan(uploadConf.Type, target, downloadedRpmFilePath)
+	defer func() {
+		written.end(err, uploaded)
+		span.End(err)
+	}()
 
-			utils.Logger.Printf("[✔] Repo created: %s", s3RepoPath)
-		} else {
-			_ = os.Remove(signaturePath)
-		}
+	s3RepoPath := path.Join(conf.ArtifactsDestFolder, destPath)
+	s3DotRepoFilepath := path.Join(s3RepoPath, "newrelic-infra.repo")
+	s3RepoData := path.Join(s3RepoPath, "repodata")
+	rpmDestinationPath := path.Join(s3RepoPath, downloadedRpmFileName)
+	s3RepomdFilepath := path.Join(s3RepoPath, repodataRpmPath)
+	signaturePath := path.Join(s3RepoPath, signatureRpmPath)
 
-		// create .repo file
-		utils.Logger.Println(fmt.Sprintf("creating 'newrelic-infra.repo' file in %s", s3RepoPath))
-		repoFileContent := generateRepoFileContent(conf.AccessPointHost, destPath)
-		err = ioutil.WriteFile(s3DotRepoFilepath, []byte(repoFileContent), 0644)
-		if err != nil {
-			return err
-		}
+	// copy rpm file to be able to add it into the index later
+	err = utils.CopyFile(downloadedRpmFilePath, rpmDestinationPath, uploadConf.Override, commandTimeout)
+	if err != nil {
+		return err
+	}
+	if err = written.add(downloadedRpmFilePath, rpmDestinationPath); err != nil {
+		return err
+	}
 
-		// "cache" the repodata from s3 to local so it doesnt have to process all again
-		if _, err = os.Stat(s3RepoData + "/"); err == nil {
-			if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "cp", commandTimeout, "-rf", s3RepoData+"/", os.TempDir()+"/repodata/"); err != nil {
-				return err
-			}
-		}
+	// check for repo and create if missing
+	if _, err = os.Stat(s3RepomdFilepath); os.IsNotExist(err) {
 
-		if err = utils.ExecLogOutput(utils.Logger, "createrepo", commandTimeout, "--update", "-s", "sha", s3RepoPath, "-o", os.TempDir()); err != nil {
-			return err
-		}
+		utils.Logger.Info("[ ] repo not found, creating it", "repo", s3RepoPath)
 
-		// remove the 'old' repodata from s3
-		if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "rm", commandTimeout, "-rf", s3RepoData+"/"); err != nil {
+		if err := utils.ExecLogOutput(utils.Logger, "createrepo", commandTimeout, s3RepoPath, "-o", os.TempDir()); err != nil {
 			return err
 		}
 
-		// copy from temp repodata to repo repodata in s3
-		if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "cp", commandTimeout, "-rf", os.TempDir()+"/repodata/", s3RepoPath); err != nil {
-			return err
-		}
+		utils.Logger.Info("[✔] repo created", "repo", s3RepoPath)
+	} else {
+		_ = os.Remove(signaturePath)
+	}
 
-		// remove temp repodata so the next repo doesn't get confused
-		if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "rm", commandTimeout, "-rf", os.TempDir()+"/repodata/"); err != nil {
+	// create .repo file
+	utils.Logger.Info("creating newrelic-infra.repo file", "repo", s3RepoPath)
+	repoFileContent := generateRepoFileContent(conf.AccessPointHost, destPath)
+	err = ioutil.WriteFile(s3DotRepoFilepath, []byte(repoFileContent), 0644)
+	if err != nil {
+		return err
+	}
+
+	// "cache" the repodata from s3 to local so it doesnt have to process all again
+	if _, err = os.Stat(s3RepoData + "/"); err == nil {
+		if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "cp", commandTimeout, "-rf", s3RepoData+"/", os.TempDir()+"/repodata/"); err != nil {
 			return err
 		}
+	}
 
-		// verify that metadata copied to s3
-		if _, err = os.Stat(s3RepomdFilepath); err != nil {
-			return fmt.Errorf("error while creating repository %s for source %s and destination %s", err.Error(), downloadedRpmFilePath, destPath)
-		}
+	if err = utils.ExecLogOutput(utils.Logger, "createrepo", commandTimeout, "--update", "-s", "sha", s3RepoPath, "-o", os.TempDir()); err != nil {
+		return err
+	}
 
-		// sign metadata with GPG key
-		if err := utils.ExecLogOutput(utils.Logger, "gpg", commandTimeout, "--batch", "--pinentry-mode=loopback", "--passphrase", conf.GpgPassphrase, "--keyring", conf.GpgKeyRing, "--detach-sign", "--armor", s3RepomdFilepath); err != nil {
-			return err
-		}
+	// remove the 'old' repodata from s3
+	if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "rm", commandTimeout, "-rf", s3RepoData+"/"); err != nil {
+		return err
+	}
+
+	// copy from temp repodata to repo repodata in s3
+	if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "cp", commandTimeout, "-rf", os.TempDir()+"/repodata/", s3RepoPath); err != nil {
+		return err
+	}
+
+	// remove temp repodata so the next repo doesn't get confused
+	if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "rm", commandTimeout, "-rf", os.TempDir()+"/repodata/"); err != nil {
+		return err
+	}
+
+	// verify that metadata copied to s3
+	if _, err = os.Stat(s3RepomdFilepath); err != nil {
+		return fmt.Errorf("error while creating repository %s for source %s and destination %s", err.Error(), downloadedRpmFilePath, destPath)
+	}
 
-		utils.Logger.Printf("[✔] Uploading RPM succeded for src %s and dest %s \n", downloadedRpmFilePath, destPath)
+	// sign metadata with GPG key
+	signSpan := trace.Start("sign repodata", otlp.String("os_version", target.OsVersion), otlp.String("arch", target.Arch))
+	err = utils.ExecLogOutput(utils.Logger, "gpg", commandTimeout, "--batch", "--pinentry-mode=loopback", "--passphrase", conf.GpgPassphrase, "--keyring", conf.GpgKeyRing, "--detach-sign", "--armor", s3RepomdFilepath)
+	signSpan.End(err)
+	if err != nil {
+		return err
 	}
 
+	utils.Logger.Info("[✔] uploaded rpm", "src", downloadedRpmFilePath, "dest", destPath)
+
 	return nil
 }
 
-func uploadApt(conf config.Config, srcTemplate string, upload config.Upload, archs []string) (err error) {
+func uploadApt(conf config.Config, schema config.UploadArtifactSchema, upload config.Upload, targets []config.Target, written *manifest) (err error) {
 
 	// the dest path for apt is the same for each distribution since it does not depend on it
 	var destPath string
-	for _, osVersion := range upload.OsVersion {
-		utils.Logger.Printf("[ ] Start uploading deb for os %s", osVersion)
+	// packages are uploaded once their distribution is published
+	var pending []*report.Upload
+	// the distribution being uploaded
+	var span *trace.Span
+	defer func() {
+		written.end(err, pending...)
+		if span != nil {
+			span.End(err)
+		}
+	}()
 
-		utils.Logger.Printf("[ ] Create local repo for os %s", osVersion)
+	osVersions, archs := targetsByOsVersion(targets)
+	for _, osVersion := range osVersions {
+		utils.Logger.Info("[ ] start uploading deb", "os_version", osVersion)
+		span = startUploadSpan(upload.Type, config.Target{OsVersion: osVersion}, schema.Src)
+
+		utils.Logger.Debug("creating local repo", "os_version", osVersion)
 		// aptly repo create --distribution=${DISTRO} ${DISTRO}
 		if err = utils.ExecLogOutput(utils.Logger, "aptly", commandTimeout, "repo", "create", "--distribution="+osVersion, osVersion); err != nil {
 			return err
 		}
-		utils.Logger.Printf("[✔] Local repo created for os %s", osVersion)
+		utils.Logger.Debug("local repo created", "os_version", osVersion)
 
 		if !conf.AptSkipMirror {
 			// Mirror repo start
-			srcRepo := generateAptSrcRepoUrl(upload.SrcRepo, conf.MirrorHost)
+			srcRepo, err := upload.SrcRepoURL(conf.TemplateContext(config.Target{OsVersion: osVersion}), conf.MirrorHost)
+			if err != nil {
+				return err
+			}
 			err = mirrorAPTRepo(conf, srcRepo, osVersion)
 			if err != nil {
 				return err
 			}
 		}
 
-		for _, arch := range archs {
-			fileName, dest := replaceSrcDestTemplates(
-				srcTemplate,
-				upload.Dest,
-				conf.RepoName,
-				conf.AppName,
-				arch,
-				conf.Tag,
-				conf.Version,
-				conf.DestPrefix,
-				osVersion)
+		for _, arch := range archs[osVersion] {
+			fileName, dest, err := renderUpload(conf, schema, upload, config.Target{Arch: arch, OsVersion: osVersion})
+			if err != nil {
+				return err
+			}
 
 			srcPath := path.Join(conf.ArtifactsSrcFolder, fileName)
+			pending = append(pending, written.begin(upload.Type, config.Target{Arch: arch, OsVersion: osVersion}, srcPath))
 			destPath = path.Join(conf.ArtifactsDestFolder, dest, aptDists)
 			// path where the package will be located expected by aplty (write metadata with this path)
 			filePath := path.Join(conf.ArtifactsDestFolder, dest, aptPoolMain, string(fileName[0]), "/", conf.AppName, fileName)
 
-			utils.Logger.Printf("[ ] Add package %s into deb repo for %s/%s", srcPath, osVersion, arch)
+			utils.Logger.Info("[ ] adding package into deb repo", "src", srcPath, "os_version", osVersion, "arch", arch)
 			if err = utils.ExecLogOutput(utils.Logger, "aptly", commandTimeout, "repo", "add", "-force-replace=true", osVersion, srcPath); err != nil {
 				return err
 			}
-			utils.Logger.Printf("[✔] Added successfully package into deb repo for %s/%s", osVersion, arch)
+			utils.Logger.Info("[✔] added package into deb repo", "src", srcPath, "os_version", osVersion, "arch", arch)
 
 			// Create the directory and copy the binary
 			if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "mkdir", commandTimeout, "-p", path.Dir(filePath)); err != nil {
@@ -275,23 +307,47 @@ func uploadApt(conf config.Config, srcTemplate string, upload config.Upload, arc
 			if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "cp", commandTimeout, "-f", srcPath, filePath); err != nil {
 				return err
 			}
+			if err = written.add(srcPath, filePath); err != nil {
+				return err
+			}
 		}
 
-		utils.Logger.Printf("[ ] Publish deb repo for %s", osVersion)
-		if err = utils.ExecLogOutput(utils.Logger, "aptly", commandTimeout, "publish", "repo", "-origin=New Relic", "-keyring", conf.GpgKeyRing, "-passphrase", conf.GpgPassphrase, "-batch", osVersion); err != nil {
+		utils.Logger.Info("[ ] publishing deb repo", "os_version", osVersion)
+		// aptly signs the Release files of the distribution while publishing it
+		signSpan := trace.Start("sign deb repo", otlp.String("os_version", osVersion))
+		err = utils.ExecLogOutput(utils.Logger, "aptly", commandTimeout, "publish", "repo", "-origin=New Relic", "-keyring", conf.GpgKeyRing, "-passphrase", conf.GpgPassphrase, "-batch", osVersion)
+		signSpan.End(err)
+		if err != nil {
 			return err
 		}
 
-		utils.Logger.Printf("[✔] Published successfully deb repo for %s", osVersion)
+		utils.Logger.Info("[✔] published deb repo", "os_version", osVersion)
 		if err = syncAPTMetadata(conf, destPath, osVersion); err != nil {
 			return err
 		}
-		utils.Logger.Printf("[✔] Synced successfully local repo for %s into s3", osVersion)
+		utils.Logger.Info("[✔] synced deb repo into s3", "os_version", osVersion)
+		written.end(nil, pending...)
+		pending = nil
+		span.End(nil)
+		span = nil
 	}
 
 	return nil
 }
 
+// targetsByOsVersion groups the arch of the targets by os version, keeping the order of the os versions,
+// as every distribution is published once with all its packages.
+func targetsByOsVersion(targets []config.Target) (osVersions []string, archs map[string][]string) {
+	archs = make(map[string][]string)
+	for _, target := range targets {
+		if _, ok := archs[target.OsVersion]; !ok {
+			osVersions = append(osVersions, target.OsVersion)
+		}
+		archs[target.OsVersion] = append(archs[target.OsVersion], target.Arch)
+	}
+	return osVersions, archs
+}
+
 func syncAPTMetadata(conf config.Config, destPath string, osVersion string) (err error) {
 	if _, err = os.Stat(destPath); os.IsNotExist(err) {
 		// set right permissions
@@ -300,7 +356,7 @@ func syncAPTMetadata(conf config.Config, destPath string, osVersion string) (err
 			return err
 		}
 	}
-	utils.Logger.Printf("[ ] Sync local repo for %s into s3", osVersion)
+	utils.Logger.Info("[ ] syncing deb repo into s3", "os_version", osVersion, "dest", destPath)
 	if err = utils.ExecLogOutput(utils.Logger, "cp", commandTimeout, "-rf", conf.AptlyFolder+"/public/"+aptDists+osVersion, destPath); err != nil {
 		return err
 	}
@@ -332,7 +388,7 @@ func syncAPTMetadata(conf config.Config, destPath string, osVersion string) (err
 	if err = utils.ExecLogOutput(utils.Logger, "rm", commandTimeout, "-rf", conf.AptlyFolder+"/public/"+aptDists+osVersion); err != nil {
 		return err
 	}
-	utils.Logger.Printf("[✔] Sync local repo was successful for %s into s3", osVersion)
+	utils.Logger.Debug("local deb repo dropped", "os_version", osVersion)
 
 	return err
 }
@@ -351,65 +407,66 @@ func mirrorAPTRepo(conf config.Config, repoUrl string, osVersion string) (err er
 		return err
 	}
 	if resp.StatusCode == http.StatusNotFound {
-		utils.Logger.Printf("[X] Mirroring skipped since since %s was not present in mounted repo", u.String())
+		utils.Logger.Info("[X] mirroring skipped, repo not found", "url", u.String())
 		return nil
 	}
 
-	utils.Logger.Printf("[ ] Mirror create APT repo %s for %s", osVersion, repoUrl)
+	utils.Logger.Info("[ ] creating apt mirror", "os_version", osVersion, "url", repoUrl)
 	if err = utils.ExecLogOutput(utils.Logger, "aptly", commandTimeout, "mirror", "create", "-keyring", conf.GpgKeyRing, "mirror-"+osVersion, repoUrl, osVersion, "main"); err != nil {
 		return err
 	}
-	utils.Logger.Printf("[✔] Mirror create succesfully APT repo for %s", osVersion)
+	utils.Logger.Info("[✔] apt mirror created", "os_version", osVersion)
 
-	utils.Logger.Printf("[ ] Mirror update APT repo for %s", osVersion)
+	utils.Logger.Info("[ ] updating apt mirror", "os_version", osVersion)
 	if err = utils.ExecWithRetries(s3Retries, utils.S3RemountFn, utils.Logger, "aptly", commandTimeout, "mirror", "update", "-max-tries", strconv.Itoa(s3Retries), "-keyring", conf.GpgKeyRing, "mirror-"+osVersion); err != nil {
 		return err
 	}
 
-	utils.Logger.Printf("[✔] Mirror update succesfully APT repo for %s", osVersion)
+	utils.Logger.Info("[✔] apt mirror updated", "os_version", osVersion)
 
 	// The last parameter is `Name` that means a query matches all the packages (as it means “package name is not empty”).
-	utils.Logger.Printf("[ ] Mirror repo import APT repo for %s", osVersion)
+	utils.Logger.Info("[ ] importing apt mirror", "os_version", osVersion)
 	if err = utils.ExecLogOutput(utils.Logger, "aptly", commandTimeout, "repo", "import", "mirror-"+osVersion, osVersion, "Name"); err != nil {
 		return err
 	}
-	utils.Logger.Printf("[✔] Mirror repo import succesfully APT repo for %s", osVersion)
+	utils.Logger.Info("[✔] apt mirror imported", "os_version", osVersion)
 
 	return nil
 }
 
-func uploadFileArtifact(conf config.Config, schema config.UploadArtifactSchema, upload config.Upload, arch, osVersion string) (err error) {
-	srcPath, destPath := replaceSrcDestTemplates(
-		schema.Src,
-		upload.Dest,
-		conf.RepoName,
-		conf.AppName,
-		arch,
-		conf.Tag,
-		conf.Version,
-		conf.DestPrefix,
-		osVersion)
+func uploadFileArtifact(conf config.Config, schema config.UploadArtifactSchema, upload config.Upload, target config.Target, written *manifest) (err error) {
+	srcPath, destPath, err := renderUpload(conf, schema, upload, target)
+	if err != nil {
+		return err
+	}
 
 	srcPath = path.Join(conf.ArtifactsSrcFolder, srcPath)
 	destPath = path.Join(conf.ArtifactsDestFolder, destPath)
+	uploaded := written.begin(upload.Type, target, srcPath)
+	span := startUploadSpan(upload.Type, target, srcPath)
+	defer func() {
+		written.end(err, uploaded)
+		span.End(err)
+	}()
 
 	err = utils.CopyFile(srcPath, destPath, upload.Override, commandTimeout)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func generateDestinationAssetsPath(downloadedFileName, destPathTemplate, repoName, appName, arch, tag, version, destPrefix, osVersion string) string {
-	destPath := utils.ReplacePlaceholders(destPathTemplate, repoName, appName, arch, tag, version, destPrefix, osVersion)
-	return strings.Replace(destPath, utils.PlaceholderForSrc, downloadedFileName, -1)
+	return written.add(srcPath, destPath)
 }
 
-func generateAptSrcRepoUrl(template, accessPointHost string) (url string) {
-	url = strings.Replace(template, utils.PlaceholderForAccessPointHost, accessPointHost, -1)
-
-	return
+// startUploadSpan starts the span of the upload of the source file into the repository of a type for a target.
+func startUploadSpan(uploadType string, target config.Target, srcPath string) *trace.Span {
+	attrs := []otlp.KeyValue{otlp.String("type", uploadType), otlp.String("src", srcPath)}
+	if target.OsVersion != "" {
+		attrs = append(attrs, otlp.String("os_version", target.OsVersion))
+	}
+	if target.Arch != "" {
+		attrs = append(attrs, otlp.String("arch", target.Arch))
+	}
+	return trace.Start("upload "+uploadType, attrs...)
 }
 
 func generateRepoFileContent(accessPointHost, destPath string) (repoFileContent string) {
@@ -426,11 +483,14 @@ repo_gpgcheck=1`
 	return
 }
 
-// @TODO: deprecate this function and use generateDestinationAssetsPath() generateDownloadFileName()
-func replaceSrcDestTemplates(srcFileTemplate, destPathTemplate, repoName, appName, arch, tag, version, destPrefix, osVersion string) (srcFile string, destPath string) {
-	srcFile = utils.ReplacePlaceholders(srcFileTemplate, repoName, appName, arch, tag, version, destPrefix, osVersion)
-	destPath = utils.ReplacePlaceholders(destPathTemplate, repoName, appName, arch, tag, version, destPrefix, osVersion)
-	destPath = strings.Replace(destPath, utils.PlaceholderForSrc, srcFile, -1)
-
-	return
+// renderUpload renders the source file name and the destination of the upload of a target.
+func renderUpload(conf config.Config, schema config.UploadArtifactSchema, upload config.Upload, target config.Target) (srcFile, destPath string, err error) {
+	ctx := conf.TemplateContext(target)
+	if srcFile, err = schema.SrcFile(ctx); err != nil {
+		return "", "", err
+	}
+	if destPath, err = upload.DestPath(ctx, srcFile); err != nil {
+		return "", "", err
+	}
+	return srcFile, destPath, nil
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/newrelic/infrastructure-publish-action/publisher/config"
 	"github.com/newrelic/infrastructure-publish-action/publisher/lock"
+	"github.com/newrelic/infrastructure-publish-action/publisher/report"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,14 +84,22 @@ func TestReplacePlaceholders(t *testing.T) {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			tag := "v" + tt.version
-			src, dest := replaceSrcDestTemplates(tt.srcTemplate, tt.destTemplate, "newrelic/foobar", tt.appName, tt.arch, tag, tt.version, tt.destPrefix, tt.osVersion)
+			conf := config.Config{RepoName: "newrelic/foobar", AppName: tt.appName, Tag: "v" + tt.version, Version: tt.version, DestPrefix: tt.destPrefix}
+			schema := config.UploadArtifactSchema{Src: tt.srcTemplate}
+			upload := config.Upload{Type: config.TypeFile, Dest: tt.destTemplate}
+			src, dest, err := renderUpload(conf, schema, upload, config.Target{Arch: tt.arch, OsVersion: tt.osVersion})
+			assert.NoError(t, err)
 			assert.EqualValues(t, tt.srcOutput, src)
 			assert.EqualValues(t, tt.destOutput, dest)
 		})
 	}
 }
 
+const (
+	dummyFileContent = "test"
+	dummyFileSHA256  = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
 func writeDummyFile(path string) error {
 	file, err := os.Create(path)
 	if err != nil {
@@ -98,7 +107,7 @@ func writeDummyFile(path string) error {
 	}
 	defer file.Close()
 
-	_, err = file.Write([]byte("test"))
+	_, err = file.Write([]byte(dummyFileContent))
 	if err != nil {
 		return err
 	}
@@ -116,13 +125,13 @@ func TestUploadArtifacts(t *testing.T) {
 		{
 			name: "AppName, arch and app version expansion",
 			schema: []config.UploadArtifactSchema{
-				{"{app_name}-{arch}-{version}.txt", []string{"amd64", "386"}, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: []string{"amd64", "386"}, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
 					},
 				}},
-				{"{app_name}-{arch}-{version}.txt", nil, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: nil, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
@@ -135,7 +144,7 @@ func TestUploadArtifacts(t *testing.T) {
 		{
 			name: "AppName, arch, app version and os version expansion",
 			schema: []config.UploadArtifactSchema{
-				{"{app_name}-{version}-1.amazonlinux-{os_version}.{arch}.rpm.sum", []string{"x86_64"}, []config.Upload{
+				{Src: "{app_name}-{version}-1.amazonlinux-{os_version}.{arch}.rpm.sum", Arch: []string{"x86_64"}, Uploads: []config.Upload{
 					{
 						Type:      "file",
 						Dest:      "{arch}/{app_name}/{os_version}/{src}",
@@ -170,25 +179,45 @@ func TestUploadArtifacts(t *testing.T) {
 
 			marker := &MarkerMock{}
 			releaseInfo := release.ReleaseInfo{
-				AppName:   cfg.AppName,
-				Tag:       cfg.Tag,
-				RunID:     cfg.RunID,
-				RepoName:  cfg.RepoName,
-				Schema:    cfg.Schema,
-				SchemaURL: cfg.SchemaURL,
+				AppName:          cfg.AppName,
+				Tag:              cfg.Tag,
+				RunID:            cfg.RunID,
+				RepoName:         cfg.RepoName,
+				Schema:           cfg.Schema,
+				SchemaURL:        cfg.SchemaURL,
+				PublisherVersion: release.PublisherVersion,
 			}
 			mark := release.Mark{}
 			marker.ShouldStart(releaseInfo, mark)
-			marker.ShouldEnd(mark)
+			marker.ShouldEnd(release.StatusSucceeded)
 
-			err := UploadArtifacts(cfg, artifact.schema, lock.NewInMemory(), marker)
+			var rep report.Report
+			err := UploadArtifacts(cfg, artifact.schema, lock.NewInMemory(), marker, &rep)
 			assert.NoError(t, err)
 
 			for _, expectedFile := range artifact.expectedFiles {
 				_, err = os.Stat(path.Join(dest, expectedFile))
 				assert.NoError(t, err)
 			}
+			var written []string
+			for _, a := range marker.ended.Artifacts {
+				written = append(written, a.Key)
+				assert.Equal(t, int64(len(dummyFileContent)), a.Size)
+				assert.Equal(t, dummyFileSHA256, a.SHA256)
+			}
+			assert.ElementsMatch(t, artifact.expectedFiles, written)
 			mock.AssertExpectationsForObjects(t, marker)
+
+			assert.Equal(t, release.StatusSucceeded, rep.Status)
+			var reported []string
+			for _, upload := range rep.Uploads {
+				assert.Equal(t, report.ResultSucceeded, upload.Result)
+				assert.Equal(t, config.TypeFile, upload.Type)
+				assert.Equal(t, int64(len(dummyFileContent)), upload.Bytes)
+				assert.Equal(t, path.Base(upload.Dest[0]), path.Base(upload.Src))
+				reported = append(reported, upload.Dest...)
+			}
+			assert.Equal(t, written, reported)
 		})
 	}
 
@@ -204,13 +233,13 @@ func TestUploadArtifactsShouldFailIfMarkerCannotBeStarted(t *testing.T) {
 		{
 			name: "AppName, arch and app version expansion",
 			schema: []config.UploadArtifactSchema{
-				{"{app_name}-{arch}-{version}.txt", []string{"amd64", "386"}, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: []string{"amd64", "386"}, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
 					},
 				}},
-				{"{app_name}-{arch}-{version}.txt", nil, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: nil, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
@@ -233,15 +262,16 @@ func TestUploadArtifactsShouldFailIfMarkerCannotBeStarted(t *testing.T) {
 			markerErr := errors.New("some error")
 			marker := &MarkerMock{}
 			marker.ShouldFailOnStart(release.ReleaseInfo{
-				AppName:   cfg.AppName,
-				Tag:       cfg.Tag,
-				RunID:     cfg.RunID,
-				RepoName:  cfg.RepoName,
-				Schema:    cfg.Schema,
-				SchemaURL: cfg.SchemaURL,
+				AppName:          cfg.AppName,
+				Tag:              cfg.Tag,
+				RunID:            cfg.RunID,
+				RepoName:         cfg.RepoName,
+				Schema:           cfg.Schema,
+				SchemaURL:        cfg.SchemaURL,
+				PublisherVersion: release.PublisherVersion,
 			}, markerErr)
 
-			err := UploadArtifacts(cfg, artifact.schema, lock.NewInMemory(), marker)
+			err := UploadArtifacts(cfg, artifact.schema, lock.NewInMemory(), marker, nil)
 			assert.ErrorIs(t, err, markerErr)
 			mock.AssertExpectationsForObjects(t, marker)
 		})
@@ -258,13 +288,13 @@ func TestUploadArtifactsShouldNotFailIfMarkerCannotBeEnded(t *testing.T) {
 		{
 			name: "AppName, arch and app version expansion",
 			schema: []config.UploadArtifactSchema{
-				{"{app_name}-{arch}-{version}.txt", []string{"amd64", "386"}, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: []string{"amd64", "386"}, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
 					},
 				}},
-				{"{app_name}-{arch}-{version}.txt", nil, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: nil, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
@@ -277,7 +307,7 @@ func TestUploadArtifactsShouldNotFailIfMarkerCannotBeEnded(t *testing.T) {
 		{
 			name: "AppName, arch, app version and os version expansion",
 			schema: []config.UploadArtifactSchema{
-				{"{app_name}-{version}-1.amazonlinux-{os_version}.{arch}.rpm.sum", []string{"x86_64"}, []config.Upload{
+				{Src: "{app_name}-{version}-1.amazonlinux-{os_version}.{arch}.rpm.sum", Arch: []string{"x86_64"}, Uploads: []config.Upload{
 					{
 						Type:      "file",
 						Dest:      "{arch}/{app_name}/{os_version}/{src}",
@@ -313,18 +343,19 @@ func TestUploadArtifactsShouldNotFailIfMarkerCannotBeEnded(t *testing.T) {
 			markerErr := errors.New("some error")
 			marker := &MarkerMock{}
 			releaseInfo := release.ReleaseInfo{
-				AppName:   cfg.AppName,
-				Tag:       cfg.Tag,
-				RunID:     cfg.RunID,
-				RepoName:  cfg.RepoName,
-				Schema:    cfg.Schema,
-				SchemaURL: cfg.SchemaURL,
+				AppName:          cfg.AppName,
+				Tag:              cfg.Tag,
+				RunID:            cfg.RunID,
+				RepoName:         cfg.RepoName,
+				Schema:           cfg.Schema,
+				SchemaURL:        cfg.SchemaURL,
+				PublisherVersion: release.PublisherVersion,
 			}
 			mark := release.Mark{}
 			marker.ShouldStart(releaseInfo, mark)
-			marker.ShouldFailOnEnd(mark, markerErr)
+			marker.ShouldFailOnEnd(release.StatusSucceeded, markerErr)
 
-			err := UploadArtifacts(cfg, artifact.schema, lock.NewInMemory(), marker)
+			err := UploadArtifacts(cfg, artifact.schema, lock.NewInMemory(), marker, nil)
 			assert.NoError(t, err)
 
 			for _, expectedFile := range artifact.expectedFiles {
@@ -338,13 +369,13 @@ func TestUploadArtifactsShouldNotFailIfMarkerCannotBeEnded(t *testing.T) {
 
 func TestUploadArtifacts_cantBeRunInParallel(t *testing.T) {
 	schema := []config.UploadArtifactSchema{
-		{"{app_name}-{arch}-{version}.txt", []string{"amd64"}, []config.Upload{
+		{Src: "{app_name}-{arch}-{version}.txt", Arch: []string{"amd64"}, Uploads: []config.Upload{
 			{
 				Type: "file",
 				Dest: "{arch}/{app_name}/{src}",
 			},
 		}},
-		{"{app_name}-{arch}-{version}.txt", nil, []config.Upload{
+		{Src: "{app_name}-{arch}-{version}.txt", Arch: nil, Uploads: []config.Upload{
 			{
 				Type: "file",
 				Dest: "{arch}/{app_name}/{src}",
@@ -374,17 +405,18 @@ func TestUploadArtifacts_cantBeRunInParallel(t *testing.T) {
 		<-ready
 		marker := &MarkerMock{}
 		releaseInfo := release.ReleaseInfo{
-			AppName:   cfg.AppName,
-			Tag:       cfg.Tag,
-			RunID:     cfg.RunID,
-			RepoName:  cfg.RepoName,
-			Schema:    cfg.Schema,
-			SchemaURL: cfg.SchemaURL,
+			AppName:          cfg.AppName,
+			Tag:              cfg.Tag,
+			RunID:            cfg.RunID,
+			RepoName:         cfg.RepoName,
+			Schema:           cfg.Schema,
+			SchemaURL:        cfg.SchemaURL,
+			PublisherVersion: release.PublisherVersion,
 		}
 		mark := release.Mark{}
 		marker.ShouldStart(releaseInfo, mark)
-		marker.ShouldEnd(mark)
-		err1 = UploadArtifacts(cfg, schema, l, marker)
+		marker.ShouldEnd(release.StatusSucceeded)
+		err1 = UploadArtifacts(cfg, schema, l, marker, nil)
 		mock.AssertExpectationsForObjects(t, marker)
 		wg.Done()
 	}()
@@ -392,7 +424,7 @@ func TestUploadArtifacts_cantBeRunInParallel(t *testing.T) {
 		<-ready
 		time.Sleep(1 * time.Millisecond)
 		marker := &MarkerMock{}
-		err2 = UploadArtifacts(cfg, schema, l, marker)
+		err2 = UploadArtifacts(cfg, schema, l, marker, nil)
 		mock.AssertExpectationsForObjects(t, marker)
 		wg.Done()
 	}()
@@ -415,7 +447,7 @@ func TestUploadArtifacts_errorsIfAnyArchFails(t *testing.T) {
 		{
 			name: "no error uploading file",
 			schema: []config.UploadArtifactSchema{
-				{"{app_name}-{arch}-{version}.txt", []string{"amd64", "386"}, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: []string{"amd64", "386"}, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
@@ -426,7 +458,7 @@ func TestUploadArtifacts_errorsIfAnyArchFails(t *testing.T) {
 		{
 			name: "error uploading file",
 			schema: []config.UploadArtifactSchema{
-				{"{app_name}-{arch}-{version}.txt", []string{"amd64", "NOT_VALID", "386"}, []config.Upload{
+				{Src: "{app_name}-{arch}-{version}.txt", Arch: []string{"amd64", "NOT_VALID", "386"}, Uploads: []config.Upload{
 					{
 						Type: "file",
 						Dest: "{arch}/{app_name}/{src}",
@@ -456,19 +488,34 @@ func TestUploadArtifacts_errorsIfAnyArchFails(t *testing.T) {
 
 			marker := &MarkerMock{}
 			releaseInfo := release.ReleaseInfo{
-				AppName:   cfg.AppName,
-				Tag:       cfg.Tag,
-				RunID:     cfg.RunID,
-				RepoName:  cfg.RepoName,
-				Schema:    cfg.Schema,
-				SchemaURL: cfg.SchemaURL,
+				AppName:          cfg.AppName,
+				Tag:              cfg.Tag,
+				RunID:            cfg.RunID,
+				RepoName:         cfg.RepoName,
+				Schema:           cfg.Schema,
+				SchemaURL:        cfg.SchemaURL,
+				PublisherVersion: release.PublisherVersion,
 			}
 			mark := release.Mark{}
 			marker.ShouldStart(releaseInfo, mark)
-			marker.ShouldEnd(mark)
-			err = UploadArtifacts(cfg, tc.schema, lock.NewNoop(), marker)
+			if tc.expectsError {
+				marker.ShouldEnd(release.StatusFailed)
+			} else {
+				marker.ShouldEnd(release.StatusSucceeded)
+			}
+			var rep report.Report
+			err = UploadArtifacts(cfg, tc.schema, lock.NewNoop(), marker, &rep)
 			if tc.expectsError {
 				assert.Error(t, err)
+				assert.Equal(t, err.Error(), marker.ended.Error)
+				// the upload of 386 is not attempted
+				if assert.Len(t, rep.Uploads, 2) {
+					assert.Equal(t, report.ResultSucceeded, rep.Uploads[0].Result)
+					assert.Equal(t, report.ResultFailed, rep.Uploads[1].Result)
+					assert.Equal(t, "NOT_VALID", rep.Uploads[1].Arch)
+					assert.NotEmpty(t, rep.Uploads[1].Error)
+				}
+				assert.Equal(t, release.StatusFailed, rep.Status)
 			} else {
 				assert.NoError(t, err)
 			}
@@ -477,13 +524,48 @@ func TestUploadArtifacts_errorsIfAnyArchFails(t *testing.T) {
 	}
 }
 
-func Test_generateAptSrcRepoUrl(t *testing.T) {
-	template := "{access_point_host}/infrastructure_agent/linux/apt"
-	accessPointHost := "https://download.newrelic.com"
+func TestUploadArtifacts_prerelease(t *testing.T) {
+	schema := config.UploadArtifactSchemas{
+		{Src: "{app_name}-{version}.txt", Arch: []string{""}, Uploads: []config.Upload{
+			{
+				Type:       "file",
+				Dest:       "stable/{src}",
+				Prerelease: &config.PrereleaseUpload{Dest: "testing/{prerelease}/{src}"},
+			},
+			{
+				Type:       "file",
+				Dest:       "latest/{app_name}.txt",
+				Prerelease: &config.PrereleaseUpload{Skip: true},
+			},
+		}},
+	}
 
-	srcRepo := generateAptSrcRepoUrl(template, accessPointHost)
+	dest := t.TempDir()
+	src := t.TempDir()
+	cfg := config.Config{
+		Tag:                 "v2.0.0-rc.1",
+		Version:             "2.0.0-rc.1",
+		ArtifactsDestFolder: dest,
+		ArtifactsSrcFolder:  src,
+		AppName:             "nri-foobar",
+	}
+	assert.NoError(t, writeDummyFile(path.Join(src, "nri-foobar-2.0.0-rc.1.txt")))
+
+	marker := &MarkerMock{}
+	mark := release.Mark{}
+	marker.ShouldStart(release.ReleaseInfo{AppName: cfg.AppName, Tag: cfg.Tag, PublisherVersion: release.PublisherVersion}, mark)
+	marker.ShouldEnd(release.StatusSucceeded)
+
+	err := UploadArtifacts(cfg, schema.ForRelease(cfg.IsPrerelease()), lock.NewNoop(), marker, nil)
+	assert.NoError(t, err)
 
-	assert.Equal(t, "https://download.newrelic.com/infrastructure_agent/linux/apt", srcRepo)
+	_, err = os.Stat(path.Join(dest, "testing/rc.1/nri-foobar-2.0.0-rc.1.txt"))
+	assert.NoError(t, err)
+	_, err = os.Stat(path.Join(dest, "stable"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(dest, "latest"))
+	assert.True(t, os.IsNotExist(err))
+	mock.AssertExpectationsForObjects(t, marker)
 }
 
 func Test_generateRepoFileContent(t *testing.T) {
@@ -500,6 +582,8 @@ func Test_generateRepoFileContent(t *testing.T) {
 
 type MarkerMock struct {
 	mock.Mock
+	// ended is the mark the release was ended with
+	ended release.Mark
 }
 
 func (m *MarkerMock) Start(releaseInfo release.ReleaseInfo) (release.Mark, error) {
@@ -510,10 +594,17 @@ func (m *MarkerMock) Start(releaseInfo release.ReleaseInfo) (release.Mark, error
 
 func (m *MarkerMock) End(mark release.Mark) error {
 	args := m.Called(mark)
+	m.ended = mark
 
 	return args.Error(0)
 }
 
+func (m *MarkerMock) List(filter release.Filter) ([]release.Mark, error) {
+	args := m.Called(filter)
+
+	return args.Get(0).([]release.Mark), args.Error(1)
+}
+
 func (m *MarkerMock) ShouldStart(releaseInfo release.ReleaseInfo, mark release.Mark) {
 	m.
 		On("Start", releaseInfo).
@@ -528,16 +619,22 @@ func (m *MarkerMock) ShouldFailOnStart(releaseInfo release.ReleaseInfo, err erro
 		Return(release.Mark{}, err)
 }
 
-func (m *MarkerMock) ShouldEnd(mark release.Mark) {
+func (m *MarkerMock) ShouldEnd(status string) {
 	m.
-		On("End", mark).
+		On("End", withStatus(status)).
 		Once().
 		Return(nil)
 }
 
-func (m *MarkerMock) ShouldFailOnEnd(mark release.Mark, err error) {
+func (m *MarkerMock) ShouldFailOnEnd(status string, err error) {
 	m.
-		On("End", mark).
+		On("End", withStatus(status)).
 		Once().
 		Return(err)
 }
+
+func withStatus(status string) interface{} {
+	return mock.MatchedBy(func(mark release.Mark) bool {
+		return mark.Status == status
+	})
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// LogFormatText and LogFormatJSON are the formats of the logs, key=value pairs or a JSON object per line
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	// PhaseConfig, PhasePreflight, PhaseDownload and PhaseUpload are the phases of a publishing, logged as the
+	// phase field, see SetPhase
+	PhaseConfig    = "config"
+	PhasePreflight = "preflight"
+	PhaseDownload  = "download"
+	PhaseUpload    = "upload"
+)
+
+var (
+	// Logger is the logger of the publisher, replaced by SetLogger once the configuration is loaded.
+	Logger = NewLogger(log.Writer(), LogFormatText, slog.LevelInfo)
+
+	phase atomic.Value
+)
+
+// NewLogger returns a logger writing the records of the level and above in the format, text or json, with the
+// current phase. Text records aren't timestamped, as the CI runners already do it.
+func NewLogger(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if format == LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(phaseHandler{handler})
+}
+
+// ParseLogLevel returns the level named debug, info, warn or error.
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil || strings.ContainsAny(name, "+-") {
+		return 0, fmt.Errorf("unknown log level '%s', valid levels: debug, info, warn, error", name)
+	}
+	return level, nil
+}
+
+// SetLogger replaces Logger, i.e. with the format and level configured and the fields of the release.
+func SetLogger(l *slog.Logger) {
+	Logger = l
+}
+
+// SetPhase sets the phase of the publishing logged by every logger from then on, none when empty.
+func SetPhase(p string) {
+	phase.Store(p)
+}
+
+// phaseHandler adds the current phase to the records, so loggers created before a phase starts log it too.
+type phaseHandler struct {
+	slog.Handler
+}
+
+func (h phaseHandler) Handle(ctx context.Context, r slog.Record) error {
+	if p, _ := phase.Load().(string); p != "" {
+		r.AddAttrs(slog.String("phase", p))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h phaseHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return phaseHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h phaseHandler) WithGroup(name string) slog.Handler {
+	return phaseHandler{h.Handler.WithGroup(name)}
+}
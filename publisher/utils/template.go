@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/semver"
+)
+
+var (
+	ErrUnresolvedPlaceholder = errors.New("unresolved placeholder")
+	ErrInvalidTemplate       = errors.New("invalid template")
+)
+
+// TemplateContext holds the values of the placeholders of the schema templates. Source file names,
+// destinations, source repositories and download URLs are all rendered through it, so download and upload
+// always agree on the files.
+type TemplateContext struct {
+	RepoName   string
+	AppName    string
+	Tag        string
+	Version    string
+	DestPrefix string
+	Arch       string
+	OsVersion  string
+
+	// extra holds the placeholders only valid in some templates, like {src} in destinations
+	extra map[string]string
+}
+
+// WithSrc returns a copy of the context replacing {src} by the source file name.
+func (c TemplateContext) WithSrc(src string) TemplateContext {
+	return c.with(PlaceholderForSrc, src)
+}
+
+// WithDestArch returns a copy of the context replacing {dest_arch} by the arch name in the destination.
+func (c TemplateContext) WithDestArch(destArch string) TemplateContext {
+	return c.with(PlaceholderForDestArch, destArch)
+}
+
+// WithAccessPointHost returns a copy of the context replacing {access_point_host} by the host.
+func (c TemplateContext) WithAccessPointHost(host string) TemplateContext {
+	return c.with(PlaceholderForAccessPointHost, host)
+}
+
+func (c TemplateContext) with(placeholder, value string) TemplateContext {
+	extra := make(map[string]string, len(c.extra)+1)
+	for k, v := range c.extra {
+		extra[k] = v
+	}
+	extra[placeholder] = value
+	c.extra = extra
+	return c
+}
+
+// Render replaces the placeholders of a template. Literal braces are written doubled, {{ and }}. Unknown
+// placeholders and unmatched braces are errors, as publishing paths with braces is always a mistake.
+func (c TemplateContext) Render(template string) (string, error) {
+	rendered, unknown, err := expandTemplate(template, true, c.values())
+	if err != nil {
+		return "", err
+	}
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("%w %s in %s", ErrUnresolvedPlaceholder, strings.Join(unknown, ", "), template)
+	}
+	return rendered, nil
+}
+
+// values returns the value of every placeholder. The semantic version components are left empty when the
+// version is not a semantic version, as it can be freely set through app_version.
+func (c TemplateContext) values() map[string]string {
+	var major, minor, patch, prerelease, build string
+	if v, err := semver.Parse(c.Version); err == nil {
+		major = strconv.FormatUint(v.Major, 10)
+		minor = strconv.FormatUint(v.Minor, 10)
+		patch = strconv.FormatUint(v.Patch, 10)
+		prerelease = v.Prerelease
+		build = v.Build
+	}
+
+	values := make(map[string]string)
+	values[placeholderForRepoName] = c.RepoName
+	values[PlaceholderForAppName] = c.AppName
+	values[PlaceholderForArch] = c.Arch
+	values[placeholderForTag] = c.Tag
+	values[placeholderForVersion] = c.Version
+	values[placeholderForMajor] = major
+	values[placeholderForMinor] = minor
+	values[placeholderForPatch] = patch
+	values[placeholderForPrerelease] = prerelease
+	values[placeholderForBuild] = build
+	values[placeholderForDestPrefix] = c.DestPrefix
+	values[PlaceholderForOsVersion] = c.OsVersion
+	for placeholder, value := range c.extra {
+		values[placeholder] = value
+	}
+	return values
+}
+
+// ReplaceVars replaces only the given placeholders, by name without braces, leaving the rest of the
+// template, escaped braces included, as it is.
+func ReplaceVars(template string, vars map[string]string) string {
+	values := make(map[string]string, len(vars))
+	for name, value := range vars {
+		values["{"+name+"}"] = value
+	}
+	rendered, _, _ := expandTemplate(template, false, values)
+	return rendered
+}
+
+// Placeholders returns the placeholders of a template, skipping the escaped braces.
+func Placeholders(template string) ([]string, error) {
+	_, placeholders, err := expandTemplate(template, true, nil)
+	return placeholders, err
+}
+
+// expandTemplate replaces the placeholders with a value, returning the ones without it. Escaped braces are
+// unescaped when rendering, otherwise they are kept as well as the unmatched braces.
+func expandTemplate(template string, render bool, values map[string]string) (string, []string, error) {
+	var out strings.Builder
+	var unknown []string
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '{' && c != '}' {
+			out.WriteByte(c)
+			continue
+		}
+
+		if i+1 < len(template) && template[i+1] == c {
+			if !render {
+				out.WriteByte(c)
+			}
+			out.WriteByte(c)
+			i++
+			continue
+		}
+
+		end := -1
+		if c == '{' {
+			end = strings.IndexAny(template[i+1:], "{}")
+		}
+		if end < 0 || template[i+1+end] != '}' {
+			if render {
+				return "", nil, fmt.Errorf("%w: unmatched %c in %s, write it twice for a literal one", ErrInvalidTemplate, c, template)
+			}
+			out.WriteByte(c)
+			continue
+		}
+
+		placeholder := template[i : i+end+2]
+		if value, ok := values[placeholder]; ok {
+			out.WriteString(value)
+		} else {
+			unknown = append(unknown, placeholder)
+			out.WriteString(placeholder)
+		}
+		i += end + 1
+	}
+	return out.String(), unknown, nil
+}
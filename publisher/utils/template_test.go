@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateContext_Render_versionComponents(t *testing.T) {
+	template := "{app_name}/{major}.{minor}/{patch}/{prerelease}/{build}/{version}"
+
+	tests := []struct {
+		name     string
+		version  string
+		expected string
+	}{
+		{"release", "1.2.3", "nri-foobar/1.2/3///1.2.3"},
+		{"prerelease and build", "1.2.3-rc.1+b5", "nri-foobar/1.2/3/rc.1/b5/1.2.3-rc.1+b5"},
+		{"not semver", "FooBar", "nri-foobar/.////FooBar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := TemplateContext{RepoName: "newrelic/nri-foobar", AppName: "nri-foobar", Arch: "amd64", Tag: "v" + tt.version, Version: tt.version}
+			str, err := ctx.Render(template)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, str)
+		})
+	}
+}
+
+func TestTemplateContext_Render(t *testing.T) {
+	ctx := TemplateContext{
+		RepoName:   "newrelic/nri-foobar",
+		AppName:    "nri-foobar",
+		Tag:        "v1.2.3",
+		Version:    "1.2.3",
+		DestPrefix: "infrastructure_agent/",
+		Arch:       "arm64",
+		OsVersion:  "noble",
+	}
+
+	tests := []struct {
+		name     string
+		ctx      TemplateContext
+		template string
+		expected string
+		err      error
+		message  string
+	}{
+		{
+			name:     "placeholders",
+			ctx:      ctx,
+			template: "{dest_prefix}{repo_name}/{tag}/{app_name}_{version}_{os_version}_{arch}.deb",
+			expected: "infrastructure_agent/newrelic/nri-foobar/v1.2.3/nri-foobar_1.2.3_noble_arm64.deb",
+		},
+		{
+			name:     "destination placeholders",
+			ctx:      ctx.WithSrc("nri-foobar.deb").WithDestArch("aarch64"),
+			template: "/{dest_arch}/{src}",
+			expected: "/aarch64/nri-foobar.deb",
+		},
+		{
+			name:     "values aren't rendered",
+			ctx:      ctx.WithSrc("{arch}.deb"),
+			template: "/{src}",
+			expected: "/{arch}.deb",
+		},
+		{
+			name:     "escaped braces",
+			ctx:      ctx,
+			template: "/{{app_name}}/{{{arch}}}/}}",
+			expected: "/{app_name}/{arm64}/}",
+		},
+		{
+			name:     "unknown placeholders",
+			ctx:      ctx,
+			template: "/{src}/{flavour}",
+			err:      ErrUnresolvedPlaceholder,
+			message:  "unresolved placeholder {src}, {flavour} in /{src}/{flavour}",
+		},
+		{
+			name:     "unmatched brace",
+			ctx:      ctx,
+			template: "/{arch/{src}",
+			err:      ErrInvalidTemplate,
+			message:  "invalid template: unmatched { in /{arch/{src}, write it twice for a literal one",
+		},
+		{
+			name:     "unmatched closing brace",
+			ctx:      ctx,
+			template: "/arch}",
+			err:      ErrInvalidTemplate,
+			message:  "invalid template: unmatched } in /arch}, write it twice for a literal one",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := tt.ctx.Render(tt.template)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				assert.EqualError(t, err, tt.message)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rendered)
+		})
+	}
+}
+
+func TestReplaceVars(t *testing.T) {
+	replaced := ReplaceVars("/{flavor}/{{flavor}}/{arch}/{fips", map[string]string{"flavor": "sysv"})
+	assert.Equal(t, "/sysv/{{flavor}}/{arch}/{fips", replaced)
+}
+
+func TestPlaceholders(t *testing.T) {
+	placeholders, err := Placeholders("{{literal}}/{app_name}/{arch}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"{app_name}", "{arch}"}, placeholders)
+}
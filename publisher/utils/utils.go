@@ -3,25 +3,36 @@ package utils
 import (
 	"bufio"
 	"context"
-	"fmt"
+	"errors"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/newrelic/infrastructure-publish-action/publisher/metrics"
+	"github.com/newrelic/infrastructure-publish-action/publisher/otlp"
+	"github.com/newrelic/infrastructure-publish-action/publisher/trace"
 )
 
 const (
-	placeholderForOsVersion       = "{os_version}"
+	PlaceholderForOsVersion       = "{os_version}"
 	placeholderForDestPrefix      = "{dest_prefix}"
 	placeholderForRepoName        = "{repo_name}"
 	PlaceholderForAppName         = "{app_name}"
-	placeholderForArch            = "{arch}"
+	PlaceholderForArch            = "{arch}"
+	PlaceholderForDestArch        = "{dest_arch}"
 	placeholderForTag             = "{tag}"
 	placeholderForVersion         = "{version}"
+	placeholderForMajor           = "{major}"
+	placeholderForMinor           = "{minor}"
+	placeholderForPatch           = "{patch}"
+	placeholderForPrerelease      = "{prerelease}"
+	placeholderForBuild           = "{build}"
 	PlaceholderForSrc             = "{src}"
 	PlaceholderForAccessPointHost = "{access_point_host}"
 
@@ -30,7 +41,21 @@ const (
 )
 
 var (
-	Logger = log.New(log.Writer(), "", 0)
+	// TemplatePlaceholders are the placeholders of the src and dest templates, see TemplateContext.
+	TemplatePlaceholders = []string{
+		placeholderForRepoName,
+		PlaceholderForAppName,
+		PlaceholderForArch,
+		placeholderForTag,
+		placeholderForVersion,
+		placeholderForMajor,
+		placeholderForMinor,
+		placeholderForPatch,
+		placeholderForPrerelease,
+		placeholderForBuild,
+		placeholderForDestPrefix,
+		PlaceholderForOsVersion,
+	}
 )
 
 func ReadFileContent(filePath string) ([]byte, error) {
@@ -39,25 +64,19 @@ func ReadFileContent(filePath string) ([]byte, error) {
 	return fileContent, err
 }
 
-func ReplacePlaceholders(template, repoName, appName, arch, tag, version, destPrefix, osVersion string) (str string) {
-	str = strings.Replace(template, placeholderForRepoName, repoName, -1)
-	str = strings.Replace(str, PlaceholderForAppName, appName, -1)
-	str = strings.Replace(str, placeholderForArch, arch, -1)
-	str = strings.Replace(str, placeholderForTag, tag, -1)
-	str = strings.Replace(str, placeholderForVersion, version, -1)
-	str = strings.Replace(str, placeholderForDestPrefix, destPrefix, -1)
-	str = strings.Replace(str, placeholderForOsVersion, osVersion, -1)
+// ExecLogOutput executes a command logging its stdout at debug level and its stderr at info level, tagged
+// with the command. The command is traced, its span propagated to it in TRACEPARENT.
+func ExecLogOutput(l *slog.Logger, cmdName string, commandTimeout time.Duration, cmdArgs ...string) (err error) {
+	args := strings.Join(maskSecretArgs(cmdArgs), " ")
+	span := trace.Start("exec "+cmdName, otlp.String("cmd", cmdName), otlp.String("args", args))
+	defer func() { span.End(err) }()
 
-	return
-}
-
-// execLogOutput executes a command writing stdout & stderr to provided Logger.
-func ExecLogOutput(l *log.Logger, cmdName string, commandTimeout time.Duration, cmdArgs ...string) (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, cmdName, cmdArgs...)
+	cmd.Env = append(os.Environ(), trace.EnvTraceparent+"="+span.Traceparent())
 
-	l.Printf("Executing in shell '%s'", cmd.String())
+	l.Info("executing command", "cmd", cmdName, "args", args)
 
 	stdoutR, err := cmd.StdoutPipe()
 	if err != nil {
@@ -70,24 +89,32 @@ func ExecLogOutput(l *log.Logger, cmdName string, commandTimeout time.Duration,
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
-	defer l.Println()
 	if err = cmd.Start(); err != nil {
 		return err
 	}
 
-	go streamAsLog(&wg, l, stdoutR, "stdout")
-	go streamAsLog(&wg, l, stderrR, "stderr")
+	go streamAsLog(&wg, l.With("cmd", cmdName, "stream", "stdout"), slog.LevelInfo, stdoutR)
+	go streamAsLog(&wg, l.With("cmd", cmdName, "stream", "stderr"), slog.LevelInfo, stderrR)
 
 	wg.Wait()
 	return cmd.Wait()
 }
 
-func streamAsLog(wg *sync.WaitGroup, l *log.Logger, r io.ReadCloser, prefix string) {
-	defer wg.Done()
-
-	if prefix != "" {
-		prefix += ": "
+// maskSecretArgs returns the arguments with the values of the passphrase flags masked, so they don't end in
+// logs shipped elsewhere.
+func maskSecretArgs(args []string) []string {
+	masked := append([]string{}, args...)
+	for i := 1; i < len(masked); i++ {
+		if masked[i-1] == "--passphrase" || masked[i-1] == "-passphrase" {
+			masked[i] = "********"
+		}
 	}
+	return masked
+}
+
+// streamAsLog logs every line read at the level.
+func streamAsLog(wg *sync.WaitGroup, l *slog.Logger, level slog.Level, r io.ReadCloser) {
+	defer wg.Done()
 
 	stdoutBufR := bufio.NewReader(r)
 	var err error
@@ -95,13 +122,13 @@ func streamAsLog(wg *sync.WaitGroup, l *log.Logger, r io.ReadCloser, prefix stri
 	for {
 		line, _, err = stdoutBufR.ReadLine()
 		if err != nil {
-			if err == io.EOF {
-				return
+			if err != io.EOF {
+				l.Error("cannot read command output", "error", err)
 			}
-			l.Fatalf("Got unknown error: %s", err)
+			return
 		}
 
-		l.Printf("%s%s\n", prefix, string(line))
+		l.Log(context.Background(), level, string(line))
 	}
 }
 
@@ -109,15 +136,13 @@ func CopyFile(srcPath string, destPath string, override bool, commandTimeout tim
 
 	destDirectory := filepath.Dir(destPath)
 
-	Logger.Println("[ ] Create " + destDirectory)
+	Logger.Info("creating directory", "dir", destDirectory)
 
 	if err = ExecWithRetries(s3Retries, S3RemountFn, Logger, "mkdir", commandTimeout, "-p", destDirectory); err != nil {
 		return err
 	}
 
-	Logger.Println("[✔] Create " + destDirectory)
-
-	Logger.Println("[ ] Copy " + srcPath + " into " + destPath)
+	Logger.Info("copying file", "src", srcPath, "dest", destPath)
 
 	if override {
 		if err = ExecWithRetries(s3Retries, S3RemountFn, Logger, "cp", commandTimeout, "-f", srcPath, destPath); err != nil {
@@ -127,54 +152,78 @@ func CopyFile(srcPath string, destPath string, override bool, commandTimeout tim
 		// Note: we are not doing retries here as this command is not
 		// idempotent. If one copy fails, retry will skip and leave corrupted
 		// file in the repo
-		Logger.Println(fmt.Sprintf("Try to copy file '%s' to %s, but skipping if exists", srcPath, destPath))
+		Logger.Debug("copying file without overriding, skipped if it exists", "src", srcPath, "dest", destPath)
 		if err = ExecLogOutput(Logger, "cp", commandTimeout, "-n", srcPath, destPath); err != nil {
 			return err
 		}
 	}
 
-	Logger.Println("[✔] Copy " + srcPath + " into " + destPath)
+	Logger.Info("[✔] copied file", "src", srcPath, "dest", destPath)
 	return nil
 }
 
-func ExecWithRetries(retries int, s3Remount RetryCallback, l *log.Logger, cmdName string, commandTimeout time.Duration, cmdArgs ...string) error {
+func ExecWithRetries(retries int, s3Remount RetryCallback, l *slog.Logger, cmdName string, commandTimeout time.Duration, cmdArgs ...string) error {
 	var err error
 	for i := 0; i < retries; i++ {
 		err = ExecLogOutput(l, cmdName, commandTimeout, cmdArgs...)
 		if err == nil {
 			break
 		}
+		metrics.CommandRetries.Add(1, cmdName)
 		time.Sleep(s3RetrySleepTimeout)
 		s3Remount(l, commandTimeout)
-		l.Printf("[attempt %v] error executing command %s %s", i, cmdName, strings.Join(cmdArgs, " "))
+		l.Warn("error executing command", "attempt", i, "cmd", cmdName, "args", strings.Join(maskSecretArgs(cmdArgs), " "), "error", err)
 	}
 	return err
 }
 
-type RetryCallback func(l *log.Logger, commandTimeout time.Duration)
+type RetryCallback func(l *slog.Logger, commandTimeout time.Duration)
 
-func S3RemountFn(l *log.Logger, commandTimeout time.Duration) {
+func S3RemountFn(l *slog.Logger, commandTimeout time.Duration) {
+	metrics.S3Remounts.Add(1)
 	err := ExecLogOutput(l, "make", commandTimeout, "unmount-s3")
 	if err != nil {
-		l.Printf("unmounting s3 failed %v", err)
+		l.Warn("unmounting s3 failed", "error", err)
 	}
 
 	err = ExecLogOutput(l, "make", commandTimeout, "mount-s3", "mount-s3-check")
 	if err != nil {
-		l.Printf("mounting s3 failed %v", err)
+		l.Warn("mounting s3 failed", "error", err)
 	}
 }
 
+// noRetryError is an error Retry returns without retrying, see NoRetry.
+type noRetryError struct {
+	err error
+}
+
+func (e noRetryError) Error() string { return e.err.Error() }
+
+func (e noRetryError) Unwrap() error { return e.err }
+
+// NoRetry marks an error of the function passed to Retry as permanent, i.e. a client error of a request.
+func NoRetry(err error) error {
+	return noRetryError{err: err}
+}
+
 // Retry executes the provided function fn until it succeeds or the maximum number of retries is reached.
-// It waits for the specified delay between each retry.
-func Retry(fn func() error, retries int, delay time.Duration, onErr func()) error {
+// It waits for the specified delay between each retry, counting them in the retries metric of the operation.
+// Errors marked with NoRetry are returned right away.
+func Retry(operation string, fn func() error, retries int, delay time.Duration, onErr func()) error {
 	var err error
 	for i := 0; i < retries; i++ {
 		if err = fn(); err == nil {
 			return nil
 		}
+		var permanent noRetryError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
 		onErr()
-		time.Sleep(delay)
+		if i < retries-1 {
+			metrics.Retries.Add(1, operation)
+			time.Sleep(delay)
+		}
 	}
 	return err
 }
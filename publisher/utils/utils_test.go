@@ -2,71 +2,63 @@ package utils
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/newrelic/infrastructure-publish-action/publisher/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"sync"
 	"testing"
 	"time"
 )
 
 func Test_streamAsLog(t *testing.T) {
-	type args struct {
-		content string
-		prefix  string
-	}
 	tests := []struct {
-		name string
-		args args
+		name     string
+		content  string
+		level    slog.Level
+		expected string
 	}{
-		{"empty", args{"", ""}},
-		{"empty with prefix", args{"", "some-prefix"}},
-		{"content", args{"foo", ""}},
-		{"content with prefix", args{"foo", "a-prefix"}},
+		{"empty", "", slog.LevelInfo, ""},
+		{"content", "foo", slog.LevelInfo, "level=INFO msg=foo cmd=ls stream=stdout\n"},
+		{"lines", "foo\nbar baz", slog.LevelInfo, "level=INFO msg=foo cmd=ls stream=stdout\nlevel=INFO msg=\"bar baz\" cmd=ls stream=stdout\n"},
+		{"below level", "foo", slog.LevelDebug - 1, ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var output bytes.Buffer
-			l := log.New(&output, "", 0)
+			l := NewLogger(&output, LogFormatText, slog.LevelDebug).With("cmd", "ls", "stream", "stdout")
 
 			wg := sync.WaitGroup{}
 			wg.Add(1)
-			streamAsLog(&wg, l, reader(tt.args.content), tt.args.prefix)
+			streamAsLog(&wg, l, tt.level, reader(tt.content))
 
-			assert.Equal(t, expectedLog(tt.args.prefix, tt.args.content), output.String())
+			assert.Equal(t, tt.expected, output.String())
 		})
 	}
 }
 
-func expectedLog(prefix, content string) string {
-	if content == "" {
-		return content
-	}
-
-	if prefix != "" {
-		prefix += ": "
-	}
-	return prefix + content + "\n"
-}
-
 func reader(content string) io.ReadCloser {
 	return ioutil.NopCloser(bytes.NewReader([]byte(content)))
 }
 
 func Test_ExecWithRetries_Ok(t *testing.T) {
 	var output, outputRetry bytes.Buffer
-	l := log.New(&output, "", 0)
-	lRetry := log.New(&outputRetry, "", 0)
+	l := NewLogger(&output, LogFormatText, slog.LevelDebug)
+	lRetry := NewLogger(&outputRetry, LogFormatText, slog.LevelDebug)
 
 	err := ExecLogOutput(l, "ls", time.Millisecond*50, "/")
 	assert.Nil(t, err)
-	retryCallback := func(l *log.Logger, commandTimeout time.Duration) {
-		l.Print("remounting")
+	assert.Contains(t, output.String(), "level=INFO msg=\"executing command\" cmd=ls args=/\n")
+	assert.Contains(t, output.String(), "level=INFO msg=usr cmd=ls stream=stdout\n")
+
+	retryCallback := func(l *slog.Logger, commandTimeout time.Duration) {
+		l.Info("remounting")
 	}
 	err = ExecWithRetries(3, retryCallback, lRetry, "ls", time.Millisecond*50, "/")
 	assert.Nil(t, err)
@@ -76,15 +68,16 @@ func Test_ExecWithRetries_Ok(t *testing.T) {
 
 func Test_ExecWithRetries_Fail(t *testing.T) {
 	var output, outputRetry bytes.Buffer
-	l := log.New(&output, "", 0)
-	lRetry := log.New(&outputRetry, "", 0)
+	l := NewLogger(&output, LogFormatText, slog.LevelDebug)
+	lRetry := NewLogger(&outputRetry, LogFormatText, slog.LevelDebug)
 	retries := 3
 
 	err := ExecLogOutput(l, "ls", time.Millisecond*50, "/non_existing_path")
 	assert.Error(t, err, "exit status 1")
+	assert.Contains(t, output.String(), "cmd=ls stream=stderr\n")
 
-	retryCallback := func(l *log.Logger, commandTimeout time.Duration) {
-		l.Print("remounting")
+	retryCallback := func(l *slog.Logger, commandTimeout time.Duration) {
+		l.Info("remounting")
 	}
 	err = ExecWithRetries(retries, retryCallback, lRetry, "ls", time.Millisecond*50, "/non_existing_path")
 	assert.Error(t, err, "exit status 1")
@@ -92,12 +85,46 @@ func Test_ExecWithRetries_Fail(t *testing.T) {
 	var expectedOutput string
 	for i := 0; i < retries; i++ {
 		expectedOutput += output.String()
-		expectedOutput += "remounting\n"
-		expectedOutput += fmt.Sprintf("[attempt %v] error executing command ls /non_existing_path\n", i)
+		expectedOutput += "level=INFO msg=remounting\n"
+		expectedOutput += fmt.Sprintf("level=WARN msg=\"error executing command\" attempt=%v cmd=ls args=/non_existing_path error=%q\n", i, err.Error())
 	}
 	assert.Equal(t, expectedOutput, outputRetry.String())
 }
 
+func TestNewLogger_phase(t *testing.T) {
+	var output bytes.Buffer
+	l := NewLogger(&output, LogFormatJSON, slog.LevelInfo).With("app", "nri-foo")
+	t.Cleanup(func() { SetPhase("") })
+
+	SetPhase(PhaseUpload)
+	l.Debug("hidden")
+	l.Info("uploading", "src", "nri-foo.deb")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &record))
+	assert.Equal(t, "uploading", record["msg"])
+	assert.Equal(t, "nri-foo", record["app"])
+	assert.Equal(t, "nri-foo.deb", record["src"])
+	assert.Equal(t, PhaseUpload, record["phase"])
+}
+
+func Test_maskSecretArgs(t *testing.T) {
+	args := []string{"publish", "repo", "-passphrase", "secret", "--batch", "--passphrase", "secret", "focal"}
+	assert.Equal(t, []string{"publish", "repo", "-passphrase", "********", "--batch", "--passphrase", "********", "focal"}, maskSecretArgs(args))
+	assert.Equal(t, "secret", args[3])
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	for _, invalid := range []string{"verbose", "info+2", ""} {
+		_, err = ParseLogLevel(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
 // A simple mock service to assert on retry functionality
 type Service struct {
 	mock.Mock
@@ -118,7 +145,7 @@ func Test_RetrySuccessWithErrors(t *testing.T) {
 	anotherService.On("Do", mock.Anything).Times(2).Return(nil)
 
 	// We will execute service 3 times. First + 2 retries
-	err = Retry(service.Do, 5, time.Millisecond, func() { _ = anotherService.Do() })
+	err = Retry("test", service.Do, 5, time.Millisecond, func() { _ = anotherService.Do() })
 
 	require.NoError(t, err)
 	mock.AssertExpectationsForObjects(t, service, anotherService)
@@ -131,7 +158,7 @@ func Test_RetryNoError(t *testing.T) {
 	anotherService := &Service{}
 
 	// We will execute service 1 time. No retries
-	err := Retry(service.Do, 5, time.Millisecond, func() { _ = anotherService.Do() })
+	err := Retry("test", service.Do, 5, time.Millisecond, func() { _ = anotherService.Do() })
 
 	require.NoError(t, err)
 	mock.AssertExpectationsForObjects(t, service, anotherService)
@@ -146,8 +173,30 @@ func Test_RetryError(t *testing.T) {
 	anotherService.On("Do", mock.Anything).Times(5).Return(nil)
 
 	// We will execute service all the retries and error will be returned
-	actualErr := Retry(service.Do, 5, time.Millisecond, func() { _ = anotherService.Do() })
+	actualErr := Retry("test", service.Do, 5, time.Millisecond, func() { _ = anotherService.Do() })
 
 	assert.ErrorIs(t, actualErr, err)
 	mock.AssertExpectationsForObjects(t, service, anotherService)
 }
+
+func Test_RetryCountsRetries(t *testing.T) {
+	service := &Service{}
+	service.On("Do", mock.Anything).Times(3).Return(errors.New("some error"))
+
+	before := metrics.Retries.Value("counted")
+	err := Retry("counted", service.Do, 3, time.Millisecond, func() {})
+
+	assert.Error(t, err)
+	assert.Equal(t, before+2, metrics.Retries.Value("counted"), "the last failure is not retried")
+}
+
+func Test_RetryNoRetry(t *testing.T) {
+	service := &Service{}
+	var err = errors.New("not found")
+	service.On("Do", mock.Anything).Times(1).Return(NoRetry(err))
+
+	actualErr := Retry("test", service.Do, 5, time.Millisecond, func() {})
+
+	assert.Equal(t, err, actualErr)
+	mock.AssertExpectationsForObjects(t, service)
+}